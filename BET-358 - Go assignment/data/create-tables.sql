@@ -1,3 +1,9 @@
+DROP TABLE IF EXISTS AuditLog;
+DROP TABLE IF EXISTS ProductReviews;
+DROP TABLE IF EXISTS ProductVariants;
+DROP TABLE IF EXISTS ProductImages;
+DROP TABLE IF EXISTS ApiKeys;
+DROP TABLE IF EXISTS FailedLogins;
 DROP TABLE IF EXISTS Products;
 DROP TABLE IF EXISTS Shops;
 DROP TABLE IF EXISTS Categories;
@@ -8,21 +14,47 @@ CREATE TABLE Users (
     id INT AUTO_INCREMENT NOT NULL,
     name VARCHAR(255) NOT NULL,
     email VARCHAR(255) NOT NULL UNIQUE,
-    password VARCHAR(255) NOT NULL,
+    password VARCHAR(255) NULL,
+    role VARCHAR(32) NOT NULL DEFAULT 'user',
+    oidc_issuer VARCHAR(255) NULL,
+    oidc_subject VARCHAR(255) NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY `oidc_identity` (`oidc_issuer`, `oidc_subject`),
     PRIMARY KEY (`id`)
 );
 
 CREATE TABLE Categories (
     id INT AUTO_INCREMENT NOT NULL,
     name VARCHAR(255) NOT NULL UNIQUE,
-    PRIMARY KEY (`id`)
+    parent_id INT NULL,
+    slug VARCHAR(64) NOT NULL,
+    position INT NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `slug` (`slug`),
+    KEY `children` (`parent_id`, `position`),
+    FOREIGN KEY (`parent_id`) REFERENCES Categories(`id`)
 );
 
 CREATE TABLE Shops (
   id         INT AUTO_INCREMENT NOT NULL,
-  name      VARCHAR(255) NOT NULL UNIQUE,
-  address     VARCHAR(255) NOT NULL UNIQUE,
+  name      VARCHAR(255) NOT NULL,
+  slug      VARCHAR(64) NOT NULL,
+  address     VARCHAR(255) NOT NULL,
+  latitude    DOUBLE NULL,
+  longitude   DOUBLE NULL,
+  opening_hours TEXT NULL,
   owned_by      INT,
+  version     INT NOT NULL DEFAULT 1,
+  created_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  INDEX (`updated_at`),
+  UNIQUE KEY `slug` (`slug`),
+  UNIQUE KEY `name_per_address` (`name`, `address`),
+  INDEX `owner_shops` (`owned_by`, `id`),
+  INDEX `location` (`latitude`, `longitude`),
   PRIMARY KEY (id),
   FOREIGN KEY (`owned_by`) REFERENCES Users(`id`)
 );
@@ -30,14 +62,115 @@ CREATE TABLE Shops (
 CREATE TABLE Products (
     id INT AUTO_INCREMENT NOT NULL,
     shop_id INT,
-    name VARCHAR(255) NOT NULL UNIQUE,
+    name VARCHAR(255) NOT NULL,
     description VARCHAR(255),
     categories VARCHAR(255),
+    version INT NOT NULL DEFAULT 1,
+    rating_count INT NOT NULL DEFAULT 0,
+    rating_sum INT NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX (`updated_at`),
+    UNIQUE KEY `name_per_shop` (`shop_id`, `name`),
+    INDEX `shop_products` (`shop_id`, `id`),
     PRIMARY KEY (`id`),
     FOREIGN KEY (`shop_id`) REFERENCES Shops(`id`)
 );
 
+CREATE TABLE ProductImages (
+    id INT AUTO_INCREMENT NOT NULL,
+    product_id INT NOT NULL,
+    blob_key VARCHAR(255) NOT NULL UNIQUE,
+    content_type VARCHAR(64) NOT NULL,
+    width INT NOT NULL,
+    height INT NOT NULL,
+    size INT NOT NULL,
+    position INT NOT NULL,
+    created_at DATETIME NOT NULL,
+    PRIMARY KEY (`id`),
+    INDEX (`product_id`, `position`),
+    FOREIGN KEY (`product_id`) REFERENCES Products(`id`) ON DELETE CASCADE
+);
+
+CREATE TABLE ProductVariants (
+    id INT AUTO_INCREMENT NOT NULL,
+    product_id INT NOT NULL,
+    shop_id INT NOT NULL,
+    sku VARCHAR(64) NOT NULL,
+    options TEXT NOT NULL,
+    options_hash BINARY(32) NOT NULL,
+    price_cents BIGINT NOT NULL,
+    stock BIGINT NOT NULL,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL,
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `sku_per_shop` (`shop_id`, `sku`),
+    UNIQUE KEY `options_per_product` (`product_id`, `options_hash`),
+    FOREIGN KEY (`product_id`) REFERENCES Products(`id`) ON DELETE CASCADE
+);
+
+CREATE TABLE ProductReviews (
+    id INT AUTO_INCREMENT NOT NULL,
+    product_id INT NOT NULL,
+    user_id INT NOT NULL,
+    rating TINYINT NOT NULL,
+    text TEXT NOT NULL,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL,
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `review_per_user` (`product_id`, `user_id`),
+    INDEX `product_reviews` (`product_id`, `id`),
+    INDEX `product_ratings` (`product_id`, `rating`, `id`),
+    FOREIGN KEY (`product_id`) REFERENCES Products(`id`) ON DELETE CASCADE,
+    FOREIGN KEY (`user_id`) REFERENCES Users(`id`)
+);
+
+CREATE TABLE FailedLogins (
+    id INT AUTO_INCREMENT NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    ip VARCHAR(45) NOT NULL,
+    reason VARCHAR(64) NOT NULL,
+    attempted_at DATETIME NOT NULL,
+    PRIMARY KEY (`id`),
+    INDEX (`email`),
+    INDEX (`ip`)
+);
+
+CREATE TABLE ApiKeys (
+    id INT AUTO_INCREMENT NOT NULL,
+    user_id INT NOT NULL,
+    shop_id INT NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    prefix VARCHAR(32) NOT NULL UNIQUE,
+    key_hash CHAR(64) NOT NULL,
+    scopes VARCHAR(255) NOT NULL,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL,
+    last_used_at DATETIME NULL,
+    revoked_at DATETIME NULL,
+    PRIMARY KEY (`id`),
+    FOREIGN KEY (`user_id`) REFERENCES Users(`id`),
+    FOREIGN KEY (`shop_id`) REFERENCES Shops(`id`) ON DELETE CASCADE
+);
+
+-- Append-only, no foreign keys: entries must outlive the entities and users they mention.
+CREATE TABLE AuditLog (
+    id BIGINT AUTO_INCREMENT NOT NULL,
+    actor_id INT NULL,
+    api_key_id INT NULL,
+    entity VARCHAR(32) NOT NULL,
+    entity_id INT NOT NULL,
+    action VARCHAR(16) NOT NULL,
+    changes JSON NOT NULL,
+    request_id VARCHAR(64) NOT NULL,
+    created_at DATETIME NOT NULL,
+    PRIMARY KEY (`id`),
+    INDEX (`entity`, `entity_id`),
+    INDEX (`actor_id`),
+    INDEX `deletions` (`action`, `entity`, `created_at`)
+);
+
 
 
 
-INSERT INTO Categories (name) VALUES ('Food'),('Electronics'),('Cleaning');
\ No newline at end of file
+INSERT INTO Categories (name, slug, position) VALUES ('Food', 'food', 1),('Electronics', 'electronics', 2),('Cleaning', 'cleaning', 3);
\ No newline at end of file
@@ -0,0 +1,11 @@
+-- Audit of failed login attempts.
+CREATE TABLE FailedLogins (
+    id INT AUTO_INCREMENT NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    ip VARCHAR(45) NOT NULL,
+    reason VARCHAR(64) NOT NULL,
+    attempted_at DATETIME NOT NULL,
+    PRIMARY KEY (`id`),
+    INDEX (`email`),
+    INDEX (`ip`)
+);
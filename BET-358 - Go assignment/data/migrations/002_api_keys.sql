@@ -0,0 +1,16 @@
+-- Shop-scoped API keys for machine clients.
+CREATE TABLE ApiKeys (
+    id INT AUTO_INCREMENT NOT NULL,
+    user_id INT NOT NULL,
+    shop_id INT NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    prefix VARCHAR(32) NOT NULL UNIQUE,
+    key_hash CHAR(64) NOT NULL,
+    scopes VARCHAR(255) NOT NULL,
+    created_at DATETIME NOT NULL,
+    last_used_at DATETIME NULL,
+    revoked_at DATETIME NULL,
+    PRIMARY KEY (`id`),
+    FOREIGN KEY (`user_id`) REFERENCES Users(`id`),
+    FOREIGN KEY (`shop_id`) REFERENCES Shops(`id`) ON DELETE CASCADE
+);
@@ -0,0 +1,2 @@
+-- Accounts created through an OpenID Connect provider have no password.
+ALTER TABLE Users MODIFY password VARCHAR(255) NULL;
@@ -0,0 +1,3 @@
+-- Row versions of shops and products, used as ETags and for optimistic concurrency.
+ALTER TABLE Shops ADD COLUMN version INT NOT NULL DEFAULT 1;
+ALTER TABLE Products ADD COLUMN version INT NOT NULL DEFAULT 1;
@@ -0,0 +1,18 @@
+-- Append-only audit log of the changes made through the API, and user roles for the admin endpoints.
+-- No foreign keys: entries must outlive the entities and users they mention.
+CREATE TABLE AuditLog (
+    id BIGINT AUTO_INCREMENT NOT NULL,
+    actor_id INT NULL,
+    api_key_id INT NULL,
+    entity VARCHAR(32) NOT NULL,
+    entity_id INT NOT NULL,
+    action VARCHAR(16) NOT NULL,
+    changes JSON NOT NULL,
+    request_id VARCHAR(64) NOT NULL,
+    created_at DATETIME NOT NULL,
+    PRIMARY KEY (`id`),
+    INDEX (`entity`, `entity_id`),
+    INDEX (`actor_id`)
+);
+
+ALTER TABLE Users ADD COLUMN role VARCHAR(32) NOT NULL DEFAULT 'user';
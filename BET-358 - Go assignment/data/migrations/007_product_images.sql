@@ -0,0 +1,15 @@
+-- Images of the products, the files themselves are in the blob store.
+CREATE TABLE ProductImages (
+    id INT AUTO_INCREMENT NOT NULL,
+    product_id INT NOT NULL,
+    blob_key VARCHAR(255) NOT NULL UNIQUE,
+    content_type VARCHAR(64) NOT NULL,
+    width INT NOT NULL,
+    height INT NOT NULL,
+    size INT NOT NULL,
+    position INT NOT NULL,
+    created_at DATETIME NOT NULL,
+    PRIMARY KEY (`id`),
+    INDEX (`product_id`, `position`),
+    FOREIGN KEY (`product_id`) REFERENCES Products(`id`) ON DELETE CASCADE
+);
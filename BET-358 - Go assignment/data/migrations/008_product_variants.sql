@@ -0,0 +1,19 @@
+-- Variants of the products, each with its own SKU, price and stock.
+-- shop_id repeats the shop of the product so that SKUs can be unique per shop,
+-- options_hash is the SHA-256 of the options so that they can be unique per product.
+CREATE TABLE ProductVariants (
+    id INT AUTO_INCREMENT NOT NULL,
+    product_id INT NOT NULL,
+    shop_id INT NOT NULL,
+    sku VARCHAR(64) NOT NULL,
+    options TEXT NOT NULL,
+    options_hash BINARY(32) NOT NULL,
+    price_cents BIGINT NOT NULL,
+    stock BIGINT NOT NULL,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL,
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `sku_per_shop` (`shop_id`, `sku`),
+    UNIQUE KEY `options_per_product` (`product_id`, `options_hash`),
+    FOREIGN KEY (`product_id`) REFERENCES Products(`id`) ON DELETE CASCADE
+);
@@ -0,0 +1,26 @@
+-- Product names are unique per shop instead of globally.
+ALTER TABLE Products
+    DROP INDEX `name`,
+    ADD UNIQUE KEY `name_per_shop` (`shop_id`, `name`);
+
+-- Shop names and addresses are no longer unique on their own: chains have many shops with the same name,
+-- and malls many shops at the same address. Only the same name at the same address is refused,
+-- and shops get a slug as their global handle.
+ALTER TABLE Shops
+    DROP INDEX `name`,
+    DROP INDEX `address`,
+    ADD UNIQUE KEY `name_per_address` (`name`, `address`),
+    ADD COLUMN slug VARCHAR(64) NULL AFTER name;
+
+-- Existing shops get a slug derived from their name, made unique with their ID when needed,
+-- and prefixed when it would be empty or only digits.
+UPDATE Shops SET slug = TRIM(BOTH '-' FROM REGEXP_REPLACE(LOWER(name), '[^a-z0-9]+', '-'));
+UPDATE Shops SET slug = CONCAT('shop-', slug) WHERE slug REGEXP '^[0-9]*$';
+UPDATE Shops SET slug = TRIM(TRAILING '-' FROM LEFT(slug, 64));
+UPDATE Shops
+    JOIN (SELECT slug FROM Shops GROUP BY slug HAVING COUNT(*) > 1) AS duplicates USING (slug)
+    SET Shops.slug = CONCAT(TRIM(TRAILING '-' FROM LEFT(Shops.slug, 50)), '-', Shops.id);
+
+ALTER TABLE Shops
+    MODIFY COLUMN slug VARCHAR(64) NOT NULL,
+    ADD UNIQUE KEY `slug` (`slug`);
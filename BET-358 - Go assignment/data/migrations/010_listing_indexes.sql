@@ -0,0 +1,3 @@
+-- Indexes of the nested listings: the products of a shop and the shops of an owner, by ascending ID.
+ALTER TABLE Products ADD INDEX `shop_products` (`shop_id`, `id`);
+ALTER TABLE Shops ADD INDEX `owner_shops` (`owned_by`, `id`);
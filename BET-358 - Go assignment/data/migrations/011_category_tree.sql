@@ -0,0 +1,21 @@
+-- Categories form a tree: each one has an optional parent, a position among its siblings and a slug.
+-- Products can only be in the categories without subcategories, existing categories all start at the root.
+ALTER TABLE Categories
+    ADD COLUMN parent_id INT NULL AFTER name,
+    ADD COLUMN slug VARCHAR(64) NULL AFTER parent_id,
+    ADD COLUMN position INT NOT NULL DEFAULT 0 AFTER slug,
+    ADD KEY `children` (`parent_id`, `position`),
+    ADD FOREIGN KEY (`parent_id`) REFERENCES Categories(`id`);
+
+-- Existing categories get a slug derived from their name, made unique with their ID when needed,
+-- and keep their current order.
+UPDATE Categories SET slug = TRIM(BOTH '-' FROM REGEXP_REPLACE(LOWER(name), '[^a-z0-9]+', '-')), position = id;
+UPDATE Categories SET slug = CONCAT('category-', slug) WHERE slug REGEXP '^[0-9]*$';
+UPDATE Categories SET slug = TRIM(TRAILING '-' FROM LEFT(slug, 64));
+UPDATE Categories
+    JOIN (SELECT slug FROM Categories GROUP BY slug HAVING COUNT(*) > 1) AS duplicates USING (slug)
+    SET Categories.slug = CONCAT(TRIM(TRAILING '-' FROM LEFT(Categories.slug, 50)), '-', Categories.id);
+
+ALTER TABLE Categories
+    MODIFY COLUMN slug VARCHAR(64) NOT NULL,
+    ADD UNIQUE KEY `slug` (`slug`);
@@ -0,0 +1,22 @@
+-- Reviews of the products by the users, one per user and product.
+-- Products keep the number and the sum of the ratings of their reviews, updated with each review,
+-- so that their average rating doesn't need to go through the reviews.
+CREATE TABLE ProductReviews (
+    id INT AUTO_INCREMENT NOT NULL,
+    product_id INT NOT NULL,
+    user_id INT NOT NULL,
+    rating TINYINT NOT NULL,
+    text TEXT NOT NULL,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL,
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `review_per_user` (`product_id`, `user_id`),
+    INDEX `product_reviews` (`product_id`, `id`),
+    INDEX `product_ratings` (`product_id`, `rating`, `id`),
+    FOREIGN KEY (`product_id`) REFERENCES Products(`id`) ON DELETE CASCADE,
+    FOREIGN KEY (`user_id`) REFERENCES Users(`id`)
+);
+
+ALTER TABLE Products
+    ADD COLUMN rating_count INT NOT NULL DEFAULT 0 AFTER version,
+    ADD COLUMN rating_sum INT NOT NULL DEFAULT 0 AFTER rating_count;
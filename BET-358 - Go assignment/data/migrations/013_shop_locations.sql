@@ -0,0 +1,9 @@
+-- Shops can be located, explicitly or by geocoding their address, to be searched by distance.
+-- The index serves the bounding box of GET /shops/nearby.
+ALTER TABLE Shops
+    ADD COLUMN latitude DOUBLE NULL AFTER address,
+    ADD COLUMN longitude DOUBLE NULL AFTER latitude,
+    ADD INDEX `location` (`latitude`, `longitude`);
+
+-- /shops/nearby is a route, a shop can't have it as slug.
+UPDATE Shops SET slug = CONCAT(slug, '-', id) WHERE slug = 'nearby';
@@ -0,0 +1,4 @@
+-- Weekly opening hours of the shops in their time zone, with exceptions on given dates, stored as JSON.
+-- NULL when a shop has none, its open_now is then unknown.
+ALTER TABLE Shops
+    ADD COLUMN opening_hours TEXT NULL AFTER longitude;
@@ -0,0 +1,6 @@
+-- Accounts are linked to the OpenID Connect identity (issuer and sub) that first logged in with their verified email,
+-- later logins are matched on it rather than on the email, which the provider may reassign.
+ALTER TABLE Users
+    ADD COLUMN oidc_issuer VARCHAR(255) NULL AFTER role,
+    ADD COLUMN oidc_subject VARCHAR(255) NULL AFTER oidc_issuer,
+    ADD UNIQUE KEY `oidc_identity` (`oidc_issuer`, `oidc_subject`);
@@ -0,0 +1,2 @@
+-- Index of the deletions since a time, read by GET /deletions from the audit log.
+ALTER TABLE AuditLog ADD INDEX `deletions` (`action`, `entity`, `created_at`);
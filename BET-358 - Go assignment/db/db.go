@@ -19,6 +19,7 @@ func ConnectToDB() {
 		Addr:                 "127.0.0.1:3306",
 		DBName:               "Shopping",
 		AllowNativePasswords: true,
+		ParseTime:            true,
 	}
 
 	var err error
@@ -0,0 +1,127 @@
+package docs
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OpenAPI document of the API, served at /openapi.json.
+//
+//go:embed openapi.json
+var OpenAPI []byte
+
+// Swagger UI 4.15.5 (https://github.com/swagger-api/swagger-ui, Apache License 2.0), served at /docs from the API itself
+// so that the page doesn't depend on a CDN. swagger-initializer.js loads /openapi.json.
+//
+//go:embed swagger-ui/swagger-ui.css swagger-ui/swagger-ui-bundle.js swagger-ui/swagger-initializer.js
+var SwaggerUI embed.FS
+
+var pathParameter = regexp.MustCompile(`\{([^}/]+)\}`)
+
+var operationMethods = []string{"get", "put", "post", "delete", "patch"}
+
+type server struct {
+	URL string `json:"url"`
+}
+
+// Helper function that returns the path prefixes of a list of servers, "" for the root.
+// Returns [""] if there is none.
+func serverPrefixes(servers []server) []string {
+	if len(servers) == 0 {
+		return []string{""}
+	}
+
+	prefixes := make([]string, len(servers))
+	for i, server := range servers {
+		prefixes[i] = strings.TrimSuffix(server.URL, "/")
+	}
+
+	return prefixes
+}
+
+// Helper function that lists the operations of the document as "METHOD /path", with gin style path parameters.
+// Paths are served under the URL of each of their servers (/v1 and the deprecated unprefixed paths...), the ones of the path item if it has some,
+// the ones of the document otherwise.
+func documentedOperations() (map[string]bool, error) {
+	var document struct {
+		Servers []server                              `json:"servers"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}
+
+	if err := json.Unmarshal(OpenAPI, &document); err != nil {
+		return nil, err
+	}
+
+	operations := make(map[string]bool)
+
+	for path, item := range document.Paths {
+		prefixes := serverPrefixes(document.Servers)
+
+		if raw, ok := item["servers"]; ok {
+			var servers []server
+			if err := json.Unmarshal(raw, &servers); err != nil {
+				return nil, fmt.Errorf("servers of %s: %w", path, err)
+			}
+			prefixes = serverPrefixes(servers)
+		}
+
+		for _, prefix := range prefixes {
+			ginPath := prefix + pathParameter.ReplaceAllString(path, ":$1")
+
+			for _, method := range operationMethods {
+				if _, ok := item[method]; ok {
+					operations[strings.ToUpper(method)+" "+ginPath] = true
+				}
+			}
+		}
+	}
+
+	return operations, nil
+}
+
+// Checks that the OpenAPI document describes exactly the routes registered on the router.
+// Returns nil if they match.
+// Returns an error listing the undocumented routes and the documented operations without route otherwise.
+func CheckRoutes(routes gin.RoutesInfo) error {
+	documented, err := documentedOperations()
+
+	if err != nil {
+		return fmt.Errorf("openapi.json: %w", err)
+	}
+
+	var undocumented []string
+
+	for _, route := range routes {
+		if route.Method == "HEAD" || route.Method == "OPTIONS" {
+			continue
+		}
+
+		operation := route.Method + " " + route.Path
+
+		if documented[operation] {
+			delete(documented, operation)
+		} else {
+			undocumented = append(undocumented, operation)
+		}
+	}
+
+	if len(undocumented) == 0 && len(documented) == 0 {
+		return nil
+	}
+
+	var missing []string
+	for operation := range documented {
+		missing = append(missing, operation)
+	}
+
+	sort.Strings(undocumented)
+	sort.Strings(missing)
+
+	return fmt.Errorf("openapi.json is out of sync with the routes, undocumented routes: %v, documented operations without route: %v", undocumented, missing)
+}
@@ -0,0 +1,235 @@
+package docs_test
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	DB "rabietf.me/go-assignment/db"
+	"rabietf.me/go-assignment/docs"
+	"rabietf.me/go-assignment/models"
+	"rabietf.me/go-assignment/routes"
+)
+
+var shopColumns = []string{"id", "name", "slug", "address", "latitude", "longitude", "opening_hours", "owned_by", "version", "created_at", "updated_at"}
+
+var productColumns = []string{"id", "shop_id", "name", "description", "categories", "version", "rating_count", "rating_sum", "created_at", "updated_at"}
+
+var productImageColumns = []string{"id", "product_id", "blob_key", "content_type", "width", "height", "size", "position", "created_at"}
+
+var categoryColumns = []string{"id", "name", "parent_id", "slug", "position", "created_at", "updated_at"}
+
+// Helper function that returns the opening_hours column of a shop open every day from 09:00 to 19:00 in Paris, closed on New Year's Day.
+func openingHoursColumn(t *testing.T) string {
+	hours := models.OpeningHours{TimeZone: "Europe/Paris", Exceptions: map[string][]models.OpeningPeriod{"2030-01-01": {}}}
+
+	for day := range hours.Weekly {
+		hours.Weekly[day] = []models.OpeningPeriod{{Opens: 9 * 60, Closes: 19 * 60}}
+	}
+
+	column, err := json.Marshal(hours)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(column)
+}
+
+// Helper function that returns the row of a located shop with opening hours, and the one of a shop with neither.
+func shopRows(t *testing.T, extra ...string) *sqlmock.Rows {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	rows := sqlmock.NewRows(append(append([]string{}, shopColumns...), extra...))
+
+	located := []driver.Value{int64(1), "Bakery", "bakery", "1 rue de Rivoli, Paris", 48.8559, 2.3580, openingHoursColumn(t), int64(7), int64(3), now, now}
+	unlocated := []driver.Value{int64(2), "Garage", "garage", "Nowhere", nil, nil, nil, int64(7), int64(1), now, now}
+
+	if len(extra) > 0 {
+		located = append(located, 0.4)
+		unlocated = append(unlocated, 0.9)
+	}
+
+	return rows.AddRow(located...).AddRow(unlocated...)
+}
+
+// Helper function that replaces the connection to the database with a mock for the duration of the test.
+func withMockDB(t *testing.T) sqlmock.Sqlmock {
+	connection, mock, err := sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previous := DB.Connection
+	DB.Connection = connection
+
+	t.Cleanup(func() {
+		DB.Connection = previous
+		connection.Close()
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	return mock
+}
+
+// Helper function that compiles the schema of the JSON response of an operation of the document.
+// path is the path of the document, like /shops/{id}, the JSON pointer to the schema escapes it.
+func responseSchema(t *testing.T, path, method string, status int) *jsonschema.Schema {
+	compiler := jsonschema.NewCompiler()
+	compiler.Draft = jsonschema.Draft2020
+
+	if err := compiler.AddResource("openapi.json", bytes.NewReader(docs.OpenAPI)); err != nil {
+		t.Fatal(err)
+	}
+
+	pointer := strings.NewReplacer("~", "~0", "/", "~1", "{", "%7B", "}", "%7D").Replace(path)
+
+	schema, err := compiler.Compile("openapi.json#/paths/" + pointer + "/" + method + "/responses/" + strconv.Itoa(status) + "/content/application~1json/schema")
+
+	if err != nil {
+		t.Fatalf("%s %s doesn't document a JSON response with status %d: %v", strings.ToUpper(method), path, status, err)
+	}
+
+	return schema
+}
+
+func TestRoutesAreDocumented(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	if err := docs.CheckRoutes(routes.Setup().Routes()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResponsesMatchDocument(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cases := []struct {
+		name string
+		// Request sent to the router.
+		url string
+		// Operation of the document answering it.
+		path   string
+		method string
+		status int
+		// Queries the handler is expected to run.
+		expect func(t *testing.T, mock sqlmock.Sqlmock)
+	}{
+		{
+			name: "shop", url: "/v1/shops/1", path: "/shops/{id}", method: "get", status: http.StatusOK,
+			expect: func(t *testing.T, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("FROM Shops WHERE id = ?")).WithArgs(int64(1)).WillReturnRows(shopRows(t))
+			},
+		},
+		{
+			name: "unknown shop", url: "/v1/shops/missing", path: "/shops/{id}", method: "get", status: http.StatusNotFound,
+			expect: func(t *testing.T, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("FROM Shops WHERE slug = ?")).WithArgs("missing").WillReturnRows(sqlmock.NewRows(shopColumns))
+			},
+		},
+		{
+			name: "shops open now", url: "/v1/shops?open_now=true", path: "/shops", method: "get", status: http.StatusOK,
+			expect: func(t *testing.T, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("FROM Shops")).WillReturnRows(shopRows(t))
+			},
+		},
+		{
+			name: "open_now not a boolean", url: "/v1/shops?open_now=maybe", path: "/shops", method: "get", status: http.StatusBadRequest,
+		},
+		{
+			name: "nearby shops", url: "/v1/shops/nearby?lat=48.85&lng=2.35", path: "/shops/nearby", method: "get", status: http.StatusOK,
+			expect: func(t *testing.T, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("AS distance FROM Shops")).WillReturnRows(shopRows(t, "distance"))
+			},
+		},
+		{
+			name: "nearby shops without a center", url: "/v1/shops/nearby", path: "/shops/nearby", method: "get", status: http.StatusBadRequest,
+		},
+		{
+			name: "opening hours", url: "/v1/shops/1/hours", path: "/shops/{id}/hours", method: "get", status: http.StatusOK,
+			expect: func(t *testing.T, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("FROM Shops WHERE id = ?")).WithArgs(int64(1)).WillReturnRows(shopRows(t))
+			},
+		},
+		{
+			name: "product", url: "/v1/products/5", path: "/products/{id}", method: "get", status: http.StatusOK,
+			expect: func(t *testing.T, mock sqlmock.Sqlmock) {
+				now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+				mock.ExpectQuery(regexp.QuoteMeta("FROM Products WHERE id = ?")).WithArgs(int64(5)).
+					WillReturnRows(sqlmock.NewRows(productColumns).AddRow(int64(5), int64(1), "Baguette", "Crusty", "bread,food", int64(2), int64(2), int64(9), now, now))
+				mock.ExpectQuery(regexp.QuoteMeta("FROM ProductImages WHERE product_id IN (?)")).WithArgs(int64(5)).
+					WillReturnRows(sqlmock.NewRows(productImageColumns).AddRow(int64(3), int64(5), "products/5/3", "image/png", 640, 480, int64(2048), 0, now))
+			},
+		},
+		{
+			name: "product ID not a number", url: "/v1/products/five", path: "/products/{id}", method: "get", status: http.StatusBadRequest,
+		},
+		{
+			name: "categories", url: "/v1/categories", path: "/categories", method: "get", status: http.StatusOK,
+			expect: func(t *testing.T, mock sqlmock.Sqlmock) {
+				now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+				mock.ExpectQuery(regexp.QuoteMeta("FROM Categories")).
+					WillReturnRows(sqlmock.NewRows(categoryColumns).AddRow(int64(1), "Food", nil, "food", 0, now, now).AddRow(int64(2), "Bread", int64(1), "bread", 0, now, now))
+			},
+		},
+		{
+			name: "categories in an unknown format", url: "/v1/categories?format=graph", path: "/categories", method: "get", status: http.StatusBadRequest,
+		},
+		{
+			name: "deleted shops", url: "/v1/deletions?entity=shop&updated_since=2024-03-01T12:00:00Z", path: "/deletions", method: "get", status: http.StatusOK,
+			expect: func(t *testing.T, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(regexp.QuoteMeta("FROM AuditLog WHERE action = ? AND entity = ? AND created_at >= ?")).
+					WithArgs("delete", "shop", time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)).
+					WillReturnRows(sqlmock.NewRows([]string{"entity", "entity_id", "created_at"}).AddRow("shop", int64(4), time.Date(2024, 3, 2, 8, 0, 0, 0, time.UTC)))
+			},
+		},
+		{
+			name: "deletions without updated_since", url: "/v1/deletions?entity=shop", path: "/deletions", method: "get", status: http.StatusBadRequest,
+		},
+		{
+			name: "own API keys without a token", url: "/v1/users/me/api-keys", path: "/users/me/api-keys", method: "get", status: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			mock := withMockDB(t)
+
+			if tc.expect != nil {
+				tc.expect(t, mock)
+			}
+
+			schema := responseSchema(t, tc.path, tc.method, tc.status)
+
+			w := httptest.NewRecorder()
+			routes.Setup().ServeHTTP(w, httptest.NewRequest(strings.ToUpper(tc.method), tc.url, nil))
+
+			if w.Code != tc.status {
+				t.Fatalf("got %d, want %d: %s", w.Code, tc.status, w.Body)
+			}
+
+			var body interface{}
+
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("response isn't JSON: %v", err)
+			}
+
+			if err := schema.Validate(body); err != nil {
+				t.Fatalf("response %s doesn't match the document: %#v", w.Body, err)
+			}
+		})
+	}
+}
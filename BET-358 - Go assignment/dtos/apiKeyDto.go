@@ -0,0 +1,67 @@
+package dtos
+
+import (
+	"strings"
+	"time"
+
+	"rabietf.me/go-assignment/models"
+)
+
+// Body of POST /users/me/api-keys.
+type CreateApiKeyRequest struct {
+	Name   string   `json:"name" binding:"required"`
+	ShopID int64    `json:"shop_id" binding:"required"`
+	Scopes []string `json:"scopes" binding:"required"`
+}
+
+// API key, without its secret part nor its hash.
+type ApiKeyResponse struct {
+	ID         int64      `json:"id"`
+	ShopID     int64      `json:"shop_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// Response of POST /users/me/api-keys, the only one containing the key.
+type CreatedApiKeyResponse struct {
+	Message string         `json:"message"`
+	Key     string         `json:"key"`
+	ApiKey  ApiKeyResponse `json:"api_key"`
+}
+
+func NewApiKeyResponse(apiKey models.ApiKey) ApiKeyResponse {
+	response := ApiKeyResponse{
+		ID:        apiKey.ID,
+		ShopID:    apiKey.ShopID,
+		Name:      apiKey.Name,
+		Prefix:    apiKey.Prefix,
+		Scopes:    strings.Split(apiKey.Scopes, ","),
+		CreatedAt: apiKey.CreatedAt,
+		UpdatedAt: apiKey.UpdatedAt,
+	}
+
+	if apiKey.LastUsedAt.Valid {
+		response.LastUsedAt = &apiKey.LastUsedAt.Time
+	}
+
+	if apiKey.RevokedAt.Valid {
+		response.RevokedAt = &apiKey.RevokedAt.Time
+	}
+
+	return response
+}
+
+func NewApiKeyResponses(apiKeys []models.ApiKey) []ApiKeyResponse {
+	responses := []ApiKeyResponse{}
+
+	for _, apiKey := range apiKeys {
+		responses = append(responses, NewApiKeyResponse(apiKey))
+	}
+
+	return responses
+}
@@ -0,0 +1,69 @@
+package dtos
+
+import (
+	"time"
+
+	"rabietf.me/go-assignment/models"
+)
+
+// Entry of the audit log, actor_id and api_key_id are null when the request wasn't made by a user or with an API key.
+type AuditEntryResponse struct {
+	ID        int64                         `json:"id"`
+	ActorID   *int64                        `json:"actor_id"`
+	APIKeyID  *int64                        `json:"api_key_id"`
+	Entity    string                        `json:"entity"`
+	EntityID  int64                         `json:"entity_id"`
+	Action    string                        `json:"action"`
+	Changes   map[string]models.FieldChange `json:"changes"`
+	RequestID string                        `json:"request_id"`
+	CreatedAt time.Time                     `json:"created_at"`
+}
+
+func NewAuditEntryResponse(entry models.AuditEntry) AuditEntryResponse {
+	response := AuditEntryResponse{
+		ID:        entry.ID,
+		Entity:    entry.Entity,
+		EntityID:  entry.EntityID,
+		Action:    entry.Action,
+		Changes:   entry.Changes,
+		RequestID: entry.RequestID,
+		CreatedAt: entry.CreatedAt,
+	}
+
+	if entry.ActorID.Valid {
+		response.ActorID = &entry.ActorID.Int64
+	}
+
+	if entry.APIKeyID.Valid {
+		response.APIKeyID = &entry.APIKeyID.Int64
+	}
+
+	return response
+}
+
+func NewAuditEntryResponses(entries []models.AuditEntry) []AuditEntryResponse {
+	responses := []AuditEntryResponse{}
+
+	for _, entry := range entries {
+		responses = append(responses, NewAuditEntryResponse(entry))
+	}
+
+	return responses
+}
+
+// Shop or product deleted since a time, for the clients syncing with ?updated_since=.
+type DeletionResponse struct {
+	Entity    string    `json:"entity"`
+	ID        int64     `json:"id"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+func NewDeletionResponses(deletions []models.Deletion) []DeletionResponse {
+	responses := []DeletionResponse{}
+
+	for _, deletion := range deletions {
+		responses = append(responses, DeletionResponse{Entity: deletion.Entity, ID: deletion.EntityID, DeletedAt: deletion.DeletedAt})
+	}
+
+	return responses
+}
@@ -0,0 +1,62 @@
+package dtos
+
+import (
+	"time"
+
+	"rabietf.me/go-assignment/models"
+)
+
+type CategoryResponse struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	// nil for the categories at the root of the tree.
+	ParentID  *int64    `json:"parent_id"`
+	Slug      string    `json:"slug"`
+	Position  int       `json:"position"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type CategoryTreeResponse struct {
+	CategoryResponse
+	Children []CategoryTreeResponse `json:"children"`
+}
+
+func NewCategoryResponse(category models.Category) CategoryResponse {
+	response := CategoryResponse{ID: category.ID, Name: category.Name, Slug: category.Slug, Position: category.Position, CreatedAt: category.CreatedAt, UpdatedAt: category.UpdatedAt}
+
+	if category.ParentID != 0 {
+		parentID := category.ParentID
+		response.ParentID = &parentID
+	}
+
+	return response
+}
+
+func NewCategoryResponses(categories []models.Category) []CategoryResponse {
+	responses := []CategoryResponse{}
+
+	for _, category := range categories {
+		responses = append(responses, NewCategoryResponse(category))
+	}
+
+	return responses
+}
+
+// Function that nests the categories under their parents, the roots and the children of each category being ordered by position.
+func NewCategoryTree(categories []models.Category) []CategoryTreeResponse {
+	children := models.CategoryChildren(categories)
+
+	var build func(parentID int64) []CategoryTreeResponse
+	build = func(parentID int64) []CategoryTreeResponse {
+		nodes := []CategoryTreeResponse{}
+
+		for _, child := range children[parentID] {
+			nodes = append(nodes, CategoryTreeResponse{CategoryResponse: NewCategoryResponse(child), Children: build(child.ID)})
+		}
+
+		return nodes
+	}
+
+	return build(0)
+}
@@ -0,0 +1,82 @@
+package dtos
+
+import (
+	"fmt"
+	"sort"
+
+	"rabietf.me/go-assignment/models"
+)
+
+// Days of the week as named in the API, from Monday.
+var WeekdayNames = []string{"monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday"}
+
+// Opening period, HH:MM local times: closing at or before the opening time means the next day, like 22:00 to 02:00.
+// 24:00 can close a period at the end of the day, 00:00 to 00:00 opens all day.
+type OpeningPeriod struct {
+	Opens  string `json:"opens" binding:"required"`
+	Closes string `json:"closes" binding:"required"`
+}
+
+// Period opening every week on Day.
+type WeeklyOpeningPeriod struct {
+	Day string `json:"day" binding:"required"`
+	OpeningPeriod
+}
+
+// Periods opening on a date (YYYY-MM-DD) instead of the weekly ones, none to close all day.
+type OpeningException struct {
+	Date    string          `json:"date" binding:"required"`
+	Periods []OpeningPeriod `json:"periods" binding:"max=10,dive"`
+}
+
+// Body of PUT /shops/:id/hours.
+type OpeningHoursRequest struct {
+	// IANA name, like Europe/Paris.
+	TimeZone   string                `json:"time_zone" binding:"required"`
+	Weekly     []WeeklyOpeningPeriod `json:"weekly" binding:"max=70,dive"`
+	Exceptions []OpeningException    `json:"exceptions" binding:"max=366,dive"`
+}
+
+type OpeningHoursResponse struct {
+	TimeZone string `json:"time_zone"`
+	// From Monday, each day by opening time.
+	Weekly []WeeklyOpeningPeriod `json:"weekly"`
+	// By date.
+	Exceptions []OpeningException `json:"exceptions"`
+}
+
+// Helper function that formats minutes since midnight as HH:MM.
+func formatMinutes(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+func newOpeningPeriods(periods []models.OpeningPeriod) []OpeningPeriod {
+	responses := []OpeningPeriod{}
+
+	for _, period := range periods {
+		responses = append(responses, OpeningPeriod{Opens: formatMinutes(period.Opens), Closes: formatMinutes(period.Closes)})
+	}
+
+	return responses
+}
+
+func NewOpeningHoursResponse(hours models.OpeningHours) OpeningHoursResponse {
+	response := OpeningHoursResponse{TimeZone: hours.TimeZone, Weekly: []WeeklyOpeningPeriod{}, Exceptions: []OpeningException{}}
+
+	for i, name := range WeekdayNames {
+		// time.Weekday starts on Sunday.
+		for _, period := range newOpeningPeriods(hours.Weekly[(i+1)%7]) {
+			response.Weekly = append(response.Weekly, WeeklyOpeningPeriod{Day: name, OpeningPeriod: period})
+		}
+	}
+
+	for date, periods := range hours.Exceptions {
+		response.Exceptions = append(response.Exceptions, OpeningException{Date: date, Periods: newOpeningPeriods(periods)})
+	}
+
+	sort.Slice(response.Exceptions, func(i, j int) bool {
+		return response.Exceptions[i].Date < response.Exceptions[j].Date
+	})
+
+	return response
+}
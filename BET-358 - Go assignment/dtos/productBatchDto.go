@@ -0,0 +1,55 @@
+package dtos
+
+import "rabietf.me/go-assignment/models"
+
+const (
+	BatchCreate = "create"
+	BatchUpdate = "update"
+	BatchDelete = "delete"
+)
+
+// An operation of POST /products:batch, with the fields of POST /products for create and of PUT /products/:id for update.
+type BatchOperation struct {
+	Op string `json:"op" binding:"required,oneof=create update delete"`
+	// Product to update or delete.
+	ID int64 `json:"id"`
+	// Required for update and delete, the version the client read: the operation fails if the product changed since.
+	Version     int64  `json:"version"`
+	ShopID      int64  `json:"shop_id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Category names separated by a comma.
+	Categories string `json:"categories"`
+}
+
+// Body of POST /products:batch.
+type BatchRequest struct {
+	Operations []BatchOperation `json:"operations" binding:"required,min=1,max=100,dive"`
+	// Applies the operations that succeed even if others fail, instead of none.
+	ContinueOnError bool `json:"continue_on_error"`
+}
+
+// Outcome of an operation of a batch.
+type BatchResult struct {
+	Index int    `json:"index"`
+	Op    string `json:"op"`
+	// The status code the operation would have had on its own endpoint, 424 if it wasn't applied because another one failed.
+	Status    int   `json:"status"`
+	ProductID int64 `json:"product_id,omitempty"`
+	// Version of the product after an update.
+	Version int64  `json:"version,omitempty"`
+	Error   string `json:"error,omitempty"`
+	// Field the error is about, if it is about one.
+	Field string `json:"field,omitempty"`
+}
+
+type BatchResponse struct {
+	Applied int           `json:"applied"`
+	Failed  int           `json:"failed"`
+	Results []BatchResult `json:"results"`
+}
+
+// Returns the fields of the operation as a product, to be saved or used as update.
+func (operation BatchOperation) ToModel() models.Product {
+	return models.Product{ShopID: operation.ShopID, Name: operation.Name, Description: operation.Description, Categories: operation.Categories}
+}
@@ -0,0 +1,102 @@
+package dtos
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"rabietf.me/go-assignment/models"
+)
+
+// Body of POST /products.
+type CreateProductRequest struct {
+	ShopID      int64  `json:"shop_id" binding:"required"`
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+	// Category names separated by a comma.
+	Categories string `json:"categories" binding:"required"`
+}
+
+// Body of PUT /products/:id, a product can't be moved to another shop.
+type UpdateProductRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+	// Category names separated by a comma.
+	Categories string `json:"categories" binding:"required"`
+}
+
+type ProductResponse struct {
+	ID          int64  `json:"id"`
+	ShopID      int64  `json:"shop_id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Categories  string `json:"categories"`
+	// Row version, the ETag of the product is this number quoted.
+	Version int64 `json:"version"`
+	// Average of the ratings of the reviews rounded to two decimals, nil if there are none.
+	AverageRating *float64  `json:"average_rating"`
+	ReviewCount   int64     `json:"review_count"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	// In display order.
+	Images []ProductImageResponse `json:"images"`
+}
+
+type ProductImageResponse struct {
+	ID int64 `json:"id"`
+	// Path of the image in the API, relative to the host.
+	URL         string `json:"url"`
+	ContentType string `json:"content_type"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	Size        int64  `json:"size"`
+	Position    int    `json:"position"`
+}
+
+// Returns the fields of the request as a product, to be saved.
+func (request CreateProductRequest) ToModel() models.Product {
+	return models.Product{ShopID: request.ShopID, Name: request.Name, Description: request.Description, Categories: request.Categories}
+}
+
+// Returns the fields of the request as a product, to be used as update.
+func (request UpdateProductRequest) ToModel() models.Product {
+	return models.Product{Name: request.Name, Description: request.Description, Categories: request.Categories}
+}
+
+func NewProductImageResponse(image models.ProductImage) ProductImageResponse {
+	return ProductImageResponse{
+		ID:          image.ID,
+		URL:         fmt.Sprintf("/v1/products/%d/images/%d", image.ProductID, image.ID),
+		ContentType: image.ContentType,
+		Width:       image.Width,
+		Height:      image.Height,
+		Size:        image.Size,
+		Position:    image.Position,
+	}
+}
+
+func NewProductResponse(product models.Product) ProductResponse {
+	response := ProductResponse{ID: product.ID, ShopID: product.ShopID, Name: product.Name, Description: product.Description, Categories: product.Categories, Version: product.Version, ReviewCount: product.RatingCount, CreatedAt: product.CreatedAt, UpdatedAt: product.UpdatedAt}
+
+	if product.RatingCount > 0 {
+		average := math.Round(float64(product.RatingSum)/float64(product.RatingCount)*100) / 100
+		response.AverageRating = &average
+	}
+
+	response.Images = []ProductImageResponse{}
+	for _, image := range product.Images {
+		response.Images = append(response.Images, NewProductImageResponse(image))
+	}
+
+	return response
+}
+
+func NewProductResponses(products []models.Product) []ProductResponse {
+	responses := []ProductResponse{}
+
+	for _, product := range products {
+		responses = append(responses, NewProductResponse(product))
+	}
+
+	return responses
+}
@@ -0,0 +1,70 @@
+package dtos
+
+import (
+	"strconv"
+	"time"
+
+	"rabietf.me/go-assignment/models"
+)
+
+// A line of a NDJSON import, other fields like the id of an export are ignored.
+type ImportProductRow struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Category names separated by a comma.
+	Categories string `json:"categories"`
+}
+
+// Outcome of a row of an import.
+type ImportRowReport struct {
+	// Line of the row in the file, starting at 1, the CSV header being line 1.
+	Line      int    `json:"line"`
+	ProductID int64  `json:"product_id,omitempty"`
+	Error     string `json:"error,omitempty"`
+	// Field the error is about, if it is about one.
+	Field string `json:"field,omitempty"`
+}
+
+type ImportReport struct {
+	// atomic or best_effort.
+	Mode     string            `json:"mode"`
+	Imported int               `json:"imported"`
+	Failed   int               `json:"failed"`
+	Rows     []ImportRowReport `json:"rows"`
+}
+
+// A product of an export, the same in CSV and NDJSON.
+type ProductExportRow struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Categories  string    `json:"categories"`
+	Version     int64     `json:"version"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Header of a CSV export, in the order of ProductExportRow.CSVRecord.
+var ProductExportHeader = []string{"id", "name", "description", "categories", "version", "created_at", "updated_at"}
+
+// Returns the fields of the request as a product of the shop, to be saved.
+func (row ImportProductRow) ToModel(shopID int64) models.Product {
+	return models.Product{ShopID: shopID, Name: row.Name, Description: row.Description, Categories: row.Categories}
+}
+
+// Returns the row as a CSV record, in the order of ProductExportHeader.
+func (row ProductExportRow) CSVRecord() []string {
+	return []string{
+		strconv.FormatInt(row.ID, 10),
+		row.Name,
+		row.Description,
+		row.Categories,
+		strconv.FormatInt(row.Version, 10),
+		row.CreatedAt.Format(time.RFC3339),
+		row.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+func NewProductExportRow(product models.Product) ProductExportRow {
+	return ProductExportRow{ID: product.ID, Name: product.Name, Description: product.Description, Categories: product.Categories, Version: product.Version, CreatedAt: product.CreatedAt, UpdatedAt: product.UpdatedAt}
+}
@@ -0,0 +1,51 @@
+package dtos
+
+import (
+	"time"
+
+	"rabietf.me/go-assignment/models"
+)
+
+// Body of POST /products/:id/reviews and PUT /products/:id/reviews/:review_id.
+type ProductReviewRequest struct {
+	// From 1 to 5 stars.
+	Rating int    `json:"rating" binding:"required,min=1,max=5"`
+	Text   string `json:"text" binding:"max=2000"`
+}
+
+type ProductReviewResponse struct {
+	ID        int64     `json:"id"`
+	ProductID int64     `json:"product_id"`
+	UserID    int64     `json:"user_id"`
+	Rating    int       `json:"rating"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Returns the fields of the request as a review of the product by the user, to be saved or used as update.
+func (request ProductReviewRequest) ToModel(productID, userID int64) models.ProductReview {
+	return models.ProductReview{ProductID: productID, UserID: userID, Rating: request.Rating, Text: request.Text}
+}
+
+func NewProductReviewResponse(review models.ProductReview) ProductReviewResponse {
+	return ProductReviewResponse{
+		ID:        review.ID,
+		ProductID: review.ProductID,
+		UserID:    review.UserID,
+		Rating:    review.Rating,
+		Text:      review.Text,
+		CreatedAt: review.CreatedAt,
+		UpdatedAt: review.UpdatedAt,
+	}
+}
+
+func NewProductReviewResponses(reviews []models.ProductReview) []ProductReviewResponse {
+	responses := []ProductReviewResponse{}
+
+	for _, review := range reviews {
+		responses = append(responses, NewProductReviewResponse(review))
+	}
+
+	return responses
+}
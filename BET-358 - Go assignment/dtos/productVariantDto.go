@@ -0,0 +1,62 @@
+package dtos
+
+import (
+	"time"
+
+	"rabietf.me/go-assignment/models"
+)
+
+// Body of POST /products/:id/variants and PUT /products/:id/variants/:variant_id.
+type ProductVariantRequest struct {
+	SKU string `json:"sku" binding:"required,max=64"`
+	// Value of each option of the product, like {"size": "M", "color": "red"}.
+	Options map[string]string `json:"options"`
+	// In cents, to stay exact.
+	PriceCents int64 `json:"price_cents" binding:"min=0"`
+	Stock      int64 `json:"stock" binding:"min=0"`
+}
+
+type ProductVariantResponse struct {
+	ID         int64             `json:"id"`
+	ProductID  int64             `json:"product_id"`
+	SKU        string            `json:"sku"`
+	Options    map[string]string `json:"options"`
+	PriceCents int64             `json:"price_cents"`
+	Stock      int64             `json:"stock"`
+	CreatedAt  time.Time         `json:"created_at"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+}
+
+// Returns the fields of the request as a variant of the product, to be saved or used as update.
+func (request ProductVariantRequest) ToModel(product models.Product) models.ProductVariant {
+	options := request.Options
+
+	if options == nil {
+		options = map[string]string{}
+	}
+
+	return models.ProductVariant{ProductID: product.ID, ShopID: product.ShopID, SKU: request.SKU, Options: options, PriceCents: request.PriceCents, Stock: request.Stock}
+}
+
+func NewProductVariantResponse(variant models.ProductVariant) ProductVariantResponse {
+	return ProductVariantResponse{
+		ID:         variant.ID,
+		ProductID:  variant.ProductID,
+		SKU:        variant.SKU,
+		Options:    variant.Options,
+		PriceCents: variant.PriceCents,
+		Stock:      variant.Stock,
+		CreatedAt:  variant.CreatedAt,
+		UpdatedAt:  variant.UpdatedAt,
+	}
+}
+
+func NewProductVariantResponses(variants []models.ProductVariant) []ProductVariantResponse {
+	responses := []ProductVariantResponse{}
+
+	for _, variant := range variants {
+		responses = append(responses, NewProductVariantResponse(variant))
+	}
+
+	return responses
+}
@@ -0,0 +1,93 @@
+package dtos
+
+import (
+	"math"
+	"time"
+
+	"rabietf.me/go-assignment/models"
+)
+
+// Body of POST /shops and PUT /shops/:id, the owner is always the authenticated user.
+type ShopRequest struct {
+	Name string `json:"name" binding:"required"`
+	// Optional, derived from the name on creation and kept on update when empty.
+	Slug    string `json:"slug"`
+	Address string `json:"address" binding:"required"`
+	// Optional, both or neither: the address is geocoded when they aren't given.
+	Latitude  *float64 `json:"latitude" binding:"omitempty,min=-90,max=90"`
+	Longitude *float64 `json:"longitude" binding:"omitempty,min=-180,max=180"`
+}
+
+type ShopResponse struct {
+	ID      int64  `json:"id"`
+	Name    string `json:"name"`
+	Slug    string `json:"slug"`
+	Address string `json:"address"`
+	// nil when the shop wasn't located.
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+	// Time zone of the opening hours, nil like open_now when the shop has none.
+	TimeZone *string `json:"time_zone"`
+	// Computed when the shop is returned, it isn't part of the version.
+	OpenNow *bool `json:"open_now"`
+	OwnerID int64 `json:"owner_id"`
+	// Row version, the ETag of the shop is this number quoted.
+	Version   int64     `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type NearbyShopResponse struct {
+	ShopResponse
+	// Great-circle distance to the searched point, rounded to the meter.
+	DistanceKm float64 `json:"distance_km"`
+}
+
+// Returns the fields of the request as a shop, to be saved or used as update.
+// The location is nil unless both coordinates are given.
+func (request ShopRequest) ToModel() models.Shop {
+	shop := models.Shop{Name: request.Name, Slug: request.Slug, Address: request.Address}
+
+	if request.Latitude != nil && request.Longitude != nil {
+		shop.Location = &models.GeoPoint{Latitude: *request.Latitude, Longitude: *request.Longitude}
+	}
+
+	return shop
+}
+
+// open_now is computed for the instant now, which the handler takes once for the whole response.
+func NewShopResponse(shop models.Shop, now time.Time) ShopResponse {
+	response := ShopResponse{ID: shop.ID, Name: shop.Name, Slug: shop.Slug, Address: shop.Address, OwnerID: shop.OwnerID, Version: shop.Version, CreatedAt: shop.CreatedAt, UpdatedAt: shop.UpdatedAt}
+
+	if shop.Location != nil {
+		latitude, longitude := shop.Location.Latitude, shop.Location.Longitude
+		response.Latitude, response.Longitude = &latitude, &longitude
+	}
+
+	if shop.Hours != nil {
+		timeZone, open := shop.Hours.TimeZone, shop.Hours.OpenAt(now)
+		response.TimeZone, response.OpenNow = &timeZone, &open
+	}
+
+	return response
+}
+
+func NewNearbyShopResponses(shops []models.NearbyShop, now time.Time) []NearbyShopResponse {
+	responses := []NearbyShopResponse{}
+
+	for _, shop := range shops {
+		responses = append(responses, NearbyShopResponse{ShopResponse: NewShopResponse(shop.Shop, now), DistanceKm: math.Round(shop.DistanceKm*1000) / 1000})
+	}
+
+	return responses
+}
+
+func NewShopResponses(shops []models.Shop, now time.Time) []ShopResponse {
+	responses := []ShopResponse{}
+
+	for _, shop := range shops {
+		responses = append(responses, NewShopResponse(shop, now))
+	}
+
+	return responses
+}
@@ -0,0 +1,26 @@
+package dtos
+
+// Body of POST /users.
+type SignUpRequest struct {
+	Name     string `json:"name" binding:"required"`
+	Email    string `json:"email" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// Body of POST /login.
+type LoginRequest struct {
+	Email    string `json:"email" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	// "cookie" to receive the token in an HttpOnly cookie instead of the body, see VerifyAuth.
+	Session string `json:"session"`
+}
+
+// Response of a successful login.
+type TokenResponse struct {
+	Message string `json:"message"`
+	// Empty in cookie mode, the token is only in the HttpOnly cookie.
+	AccessToken string `json:"access_token,omitempty"`
+	TokenType   string `json:"token_type,omitempty"`
+	ExpiresIn   int    `json:"expires_in"`
+	CSRFToken   string `json:"csrf_token,omitempty"`
+}
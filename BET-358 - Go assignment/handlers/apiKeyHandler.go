@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"rabietf.me/go-assignment/dtos"
+	"rabietf.me/go-assignment/middlewares"
+	"rabietf.me/go-assignment/models"
+	"rabietf.me/go-assignment/services"
+)
+
+// POST request at /users/me/api-keys, creates an API key for one of the shops of the authenticated user.
+// The key is only returned in this response.
+// USER MUST BE AUTHENTICATED TO PERFORM THIS REQUEST.
+// 201 and the key if successful.
+// 400 if incorrect format or unknown scope.
+// 403 if the user doesn't own the shop.
+// 500 if something went wrong.
+func CreateApiKey(c *gin.Context) {
+	var newApiKey dtos.CreateApiKeyRequest
+
+	if err := c.BindJSON(&newApiKey); err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"message": "Incorrect format, please send in JSON: name, shop_id and scopes."})
+		return
+	}
+
+	if strings.TrimSpace(newApiKey.Name) == "" || len(newApiKey.Scopes) == 0 {
+		respond(c, http.StatusBadRequest, gin.H{"message": "Incorrect format, please send in JSON: name, shop_id and scopes."})
+		return
+	}
+
+	for _, scope := range newApiKey.Scopes {
+		if !services.IsKnownScope(scope) {
+			respond(c, http.StatusBadRequest, gin.H{"message": "Unknown scope " + scope + ", valid scopes are: " + strings.Join(services.KnownScopes, ", ") + "."})
+			return
+		}
+	}
+
+	principal, ok := middlewares.CurrentPrincipal(c)
+
+	if !ok {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return
+	}
+
+	var shop models.Shop
+
+	ok, err := shop.FindById(newApiKey.ShopID)
+
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return
+	}
+
+	if !ok || shop.OwnerID != principal.UserID {
+		respond(c, http.StatusForbidden, gin.H{"message": "User doesn't have permission to create API keys for this store."})
+		return
+	}
+
+	key, apiKey, err := services.CreateAPIKey(currentActor(c), principal.UserID, shop.ID, strings.TrimSpace(newApiKey.Name), newApiKey.Scopes)
+
+	if err != nil {
+		log.Println("create api key:", err)
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return
+	}
+
+	respond(c, http.StatusCreated, dtos.CreatedApiKeyResponse{Key: key, ApiKey: dtos.NewApiKeyResponse(apiKey), Message: "Keep this key safe, it won't be shown again."})
+}
+
+// GET request at /users/me/api-keys, lists the API keys of the authenticated user, revoked ones included.
+// USER MUST BE AUTHENTICATED TO PERFORM THIS REQUEST.
+// 200 and the keys, without their secret part.
+// 500 if something went wrong.
+func GetApiKeys(c *gin.Context) {
+	principal, ok := middlewares.CurrentPrincipal(c)
+
+	if !ok {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return
+	}
+
+	var apiKey models.ApiKey
+
+	apiKeys, err := apiKey.FindAllByUser(principal.UserID)
+
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return
+	}
+
+	respond(c, http.StatusOK, dtos.NewApiKeyResponses(apiKeys))
+}
+
+// DELETE request at /users/me/api-keys/:id, revokes an API key of the authenticated user.
+// USER MUST BE AUTHENTICATED TO PERFORM THIS REQUEST.
+// 200 if successful.
+// 400 if incorrect ID.
+// 404 if the user has no such key.
+// 500 if something went wrong.
+func RevokeApiKey(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+
+	if err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"message": "Incorrect format, please enter a correct ID."})
+		return
+	}
+
+	principal, ok := middlewares.CurrentPrincipal(c)
+
+	if !ok {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return
+	}
+
+	var apiKey models.ApiKey
+
+	ok, err = apiKey.FindByIdAndUser(id, principal.UserID)
+
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return
+	}
+
+	if !ok {
+		respond(c, http.StatusNotFound, gin.H{"message": "API key doesn't not exist."})
+		return
+	}
+
+	if err := apiKey.Revoke(currentActor(c)); err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return
+	}
+
+	respond(c, http.StatusOK, gin.H{"message": "API key revoked successfuly."})
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"rabietf.me/go-assignment/dtos"
+	"rabietf.me/go-assignment/middlewares"
+	"rabietf.me/go-assignment/models"
+)
+
+const (
+	defaultAuditLimit = 50
+	maxAuditLimit     = 200
+)
+
+// Helper function that returns the author of the changes made by the request, anonymous if it isn't authenticated.
+func currentActor(c *gin.Context) models.Actor {
+	principal, _ := middlewares.CurrentPrincipal(c)
+
+	return principal.Actor(middlewares.CurrentRequestID(c))
+}
+
+// GET request at /admin/audit-log, lists the audit log newest first.
+// Can be filtered with ?entity= (user, shop, product, product_image, product_variant, product_review or api_key), ?entity_id= and ?actor_id=,
+// ?limit= entries are returned (50 by default, 200 at most), ?before_id= gets the entries older than the given one.
+// USER MUST BE AN ADMIN TO PERFORM THIS REQUEST.
+// 200 and the entries if successful, an empty list if there are none.
+// 400 if a parameter is invalid.
+// 500 if something went wrong.
+func GetAuditLog(c *gin.Context) {
+	entityID, entityOk := queryID(c, "entity_id")
+	actorID, actorOk := queryID(c, "actor_id")
+	beforeID, beforeOk := queryID(c, "before_id")
+
+	if !entityOk || !actorOk || !beforeOk {
+		respond(c, http.StatusBadRequest, gin.H{"message": "Incorrect format, entity_id, actor_id and before_id must be IDs."})
+		return
+	}
+
+	limit, ok := queryLimit(c, defaultAuditLimit, maxAuditLimit)
+
+	if !ok {
+		return
+	}
+
+	filter := models.AuditFilter{Entity: c.Query("entity"), EntityID: entityID, ActorID: actorID, BeforeID: beforeID, Limit: limit}
+
+	var entry models.AuditEntry
+
+	entries, err := entry.FindAll(filter)
+
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return
+	}
+
+	respond(c, http.StatusOK, dtos.NewAuditEntryResponses(entries))
+}
+
+// GET request at /deletions, lists the shops or products (?entity=shop or product) deleted at or after ?updated_since=, least recently deleted first.
+// Lists filtered with updated_since don't return deleted rows: a client syncing incrementally removes these ones, asking with the same time.
+// 200 and the deletions if successful, an empty list if there are none.
+// 400 if entity isn't shop nor product, or updated_since is missing or isn't an RFC 3339 time.
+// 500 if something went wrong.
+func GetDeletions(c *gin.Context) {
+	entity := c.Query("entity")
+
+	if entity != "shop" && entity != "product" {
+		respond(c, http.StatusBadRequest, gin.H{"message": "Incorrect format, entity must be shop or product."})
+		return
+	}
+
+	updatedSince, ok := queryUpdatedSince(c)
+
+	if !ok {
+		return
+	}
+
+	if updatedSince.IsZero() {
+		respond(c, http.StatusBadRequest, gin.H{"message": "Incorrect format, updated_since is required."})
+		return
+	}
+
+	var deletion models.Deletion
+
+	deletions, err := deletion.FindAll(entity, updatedSince)
+
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return
+	}
+
+	respond(c, http.StatusOK, dtos.NewDeletionResponses(deletions))
+}
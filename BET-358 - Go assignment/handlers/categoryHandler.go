@@ -2,24 +2,71 @@ package handlers
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"rabietf.me/go-assignment/dtos"
 	"rabietf.me/go-assignment/models"
 )
 
-// GET request at /categories
+// Helper function that finds a category by its name or its slug.
+// Returns (category, true) if found.
+// Returns (Category{}, false) otherwise.
+func findCategory(categories []models.Category, nameOrSlug string) (models.Category, bool) {
+	nameOrSlug = strings.TrimSpace(nameOrSlug)
+
+	for _, category := range categories {
+		if category.Name == nameOrSlug || category.Slug == nameOrSlug {
+			return category, true
+		}
+	}
+
+	return models.Category{}, false
+}
+
+// GET request at /categories, ?format=flat (default) lists the categories in the order of the tree, each followed by its subcategories,
+// ?format=tree nests them under their parents in children. Products can only be in the categories without subcategories.
+// ?updated_since= only returns the categories updated since that time, least recently updated first, in the flat format only.
 // 200 and all the predefined categories
+// 400 if format isn't flat or tree, if updated_since isn't an RFC 3339 time or is used with the tree format.
 // 500 if something went wrong
 func GetCategories(c *gin.Context) {
+	updatedSince, ok := queryUpdatedSince(c)
+
+	if !ok {
+		return
+	}
+
+	format := c.DefaultQuery("format", "flat")
+
+	if format != "flat" && format != "tree" {
+		respond(c, http.StatusBadRequest, gin.H{"message": "Incorrect format, format must be flat or tree."})
+		return
+	}
+
+	if format == "tree" && !updatedSince.IsZero() {
+		respond(c, http.StatusBadRequest, gin.H{"message": "updated_since can only be used with the flat format."})
+		return
+	}
+
 	var category models.Category
 
-	categories, err := category.FindAll()
+	categories, err := category.FindAll(updatedSince)
 
 	if err != nil {
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
 		return
 	}
 
-	c.IndentedJSON(http.StatusOK, categories)
+	if format == "tree" {
+		respond(c, http.StatusOK, dtos.NewCategoryTree(categories))
+		return
+	}
+
+	if updatedSince.IsZero() {
+		categories = models.SortCategoriesAsTree(categories)
+	}
+
+	respond(c, http.StatusOK, dtos.NewCategoryResponses(categories))
 	return
 }
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Helper function that returns the strong ETag of a row version.
+func etag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// Helper function that returns the weak ETag of a row version, for representations that also change without the version.
+// Weak tags never match in If-Match, the client must send the strong ETag of the version to modify the resource.
+func weakETag(version int64) string {
+	return "W/" + etag(version)
+}
+
+// Helper function that checks whether an If-Match or If-None-Match header value lists tag, "*" matching any tag.
+// Weak tags never match, comparisons are strong.
+func matchesETag(header, tag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+
+		if candidate == "*" || candidate == tag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Helper function for GET requests: sets the ETag header, and answers 304 if the client already has this version.
+// Returns true if the response was sent, false if the handler must send the resource.
+func notModified(c *gin.Context, version int64) bool {
+	tag := etag(version)
+	c.Header("ETag", tag)
+
+	if header := c.GetHeader("If-None-Match"); header != "" && matchesETag(header, tag) {
+		c.Status(http.StatusNotModified)
+		return true
+	}
+
+	return false
+}
+
+// Helper function for PUT and DELETE requests: the client must send the ETag of the version it modifies in If-Match,
+// so two clients editing the same resource can't overwrite each other.
+// Returns true if the request can go on.
+// Returns false after answering 428 if If-Match is missing, or 412 if it doesn't match version.
+func preconditionMet(c *gin.Context, version int64) bool {
+	header := c.GetHeader("If-Match")
+
+	if header == "" {
+		respond(c, http.StatusPreconditionRequired, gin.H{"message": "Please send the ETag of the version you are modifying in the If-Match header."})
+		return false
+	}
+
+	if !matchesETag(header, etag(version)) {
+		c.Header("ETag", etag(version))
+		respond(c, http.StatusPreconditionFailed, gin.H{"message": "This resource was modified since you read it, please get it again."})
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"rabietf.me/go-assignment/models"
+)
+
+// Helper function for failed writes: answers 409 naming the field if err is a duplicate value, with the message of that field.
+// Returns true if it answered.
+func respondConflict(c *gin.Context, err error, messages map[string]string) bool {
+	var duplicate models.DuplicateError
+
+	if !errors.As(err, &duplicate) {
+		return false
+	}
+
+	message, ok := messages[duplicate.Field]
+
+	if !ok {
+		message = "Another resource already has this " + duplicate.Field + "."
+	}
+
+	respond(c, http.StatusConflict, gin.H{"message": message, "field": duplicate.Field})
+	return true
+}
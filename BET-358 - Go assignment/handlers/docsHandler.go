@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"net/http"
+	"path"
+
+	"github.com/gin-gonic/gin"
+	"rabietf.me/go-assignment/docs"
+)
+
+// Swagger UI is served from /docs/:file, without inline scripts.
+const swaggerUIContentSecurityPolicy = "default-src 'none'; script-src 'self'; style-src 'self'; img-src 'self' data:; connect-src 'self'; frame-ancestors 'none'"
+
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>Shopping API</title>
+  <link rel="stylesheet" href="docs/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="docs/swagger-ui-bundle.js"></script>
+  <script src="docs/swagger-initializer.js"></script>
+</body>
+</html>
+`
+
+// Content types of the files of Swagger UI.
+var swaggerUIFiles = map[string]string{
+	"swagger-ui.css":         "text/css; charset=utf-8",
+	"swagger-ui-bundle.js":   "text/javascript; charset=utf-8",
+	"swagger-initializer.js": "text/javascript; charset=utf-8",
+}
+
+// GET request at /openapi.json
+// 200 and the OpenAPI document of the API.
+func GetOpenAPI(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json; charset=utf-8", docs.OpenAPI)
+}
+
+// GET request at /docs
+// 200 and a Swagger UI page for the OpenAPI document.
+func GetSwaggerUI(c *gin.Context) {
+	c.Header("Content-Security-Policy", swaggerUIContentSecurityPolicy)
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(swaggerUIPage))
+}
+
+// GET request at /docs/:file, a script or stylesheet of Swagger UI.
+// 200 and the file if successful.
+// 404 if it isn't one of them.
+func GetSwaggerUIFile(c *gin.Context) {
+	contentType, ok := swaggerUIFiles[c.Param("file")]
+
+	if !ok {
+		respond(c, http.StatusNotFound, gin.H{"message": "File doesn't exist."})
+		return
+	}
+
+	data, err := docs.SwaggerUI.ReadFile(path.Join("swagger-ui", c.Param("file")))
+
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.Data(http.StatusOK, contentType, data)
+}
@@ -0,0 +1,16 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"rabietf.me/go-assignment/services"
+)
+
+// GET request at /.well-known/jwks.json
+// 200 and the public keys tokens are signed with, so other services can verify them.
+// Empty when tokens are signed with a shared HMAC secret.
+func GetJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	respond(c, http.StatusOK, gin.H{"keys": services.Keys.JWKS()})
+}
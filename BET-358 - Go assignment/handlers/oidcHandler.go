@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"rabietf.me/go-assignment/middlewares"
+	"rabietf.me/go-assignment/models"
+	"rabietf.me/go-assignment/services"
+)
+
+// GET request at /auth/oidc/login, starts a login with the OpenID Connect provider.
+// Accepts ?session=cookie to get the same cookie session as /login.
+// 302 to the provider if successful, with the state in an HttpOnly cookie that the callback checks.
+// 404 if OpenID Connect login isn't configured.
+// 502 if the provider can't be reached.
+func OIDCLogin(c *gin.Context) {
+	if services.OIDC == nil {
+		respond(c, http.StatusNotFound, gin.H{"message": "OpenID Connect login is not enabled."})
+		return
+	}
+
+	authorizationURL, state, err := services.OIDC.StartLogin(c.Query("session"))
+
+	if err != nil {
+		log.Println("oidc login:", err)
+		respond(c, http.StatusBadGateway, gin.H{"message": "The identity provider can't be reached, please try again later."})
+		return
+	}
+
+	middlewares.SetOIDCStateCookie(c, state, services.OIDCLoginLifetime)
+	c.Redirect(http.StatusFound, authorizationURL)
+}
+
+// Helper function that checks that the callback comes from the browser that started the login, so that nobody can
+// finish his own login in the browser of someone else.
+func oidcStateMatches(c *gin.Context) bool {
+	cookie, err := c.Cookie(middlewares.OIDCStateCookie)
+	state := c.Query("state")
+
+	return err == nil && cookie != "" && subtle.ConstantTimeCompare([]byte(cookie), []byte(state)) == 1
+}
+
+// Helper function that returns the account of an OpenID Connect identity: the account linked to it, else the account with its
+// verified email, which gets linked to it, else a new account without password.
+// Returns (user, true) if successful.
+// Returns (User{}, false) after answering 401 or 500 otherwise.
+func oidcUser(c *gin.Context, identity services.OIDCIdentity) (models.User, bool) {
+	var user models.User
+
+	linked, err := user.FindByOIDCSubject(identity.Issuer, identity.Subject)
+
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return models.User{}, false
+	}
+
+	if linked {
+		return user, true
+	}
+
+	userExists, err := user.Find(identity.Email)
+
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return models.User{}, false
+	}
+
+	if !userExists {
+		user = models.User{Name: identity.Name, Email: identity.Email, OIDCIssuer: identity.Issuer, OIDCSubject: identity.Subject}
+
+		if user.Name == "" {
+			user.Name = strings.Split(identity.Email, "@")[0]
+		}
+
+		id, err := user.Save(currentActor(c))
+
+		if err != nil {
+			respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+			return models.User{}, false
+		}
+
+		user.ID = id
+		return user, true
+	}
+
+	// The email may have been given to another user of the provider, or the account linked to another provider.
+	if user.OIDCSubject != "" {
+		respond(c, http.StatusUnauthorized, gin.H{"message": "This account is linked to another identity, please log in with it."})
+		return models.User{}, false
+	}
+
+	err = user.LinkOIDC(models.Actor{UserID: user.ID, RequestID: middlewares.CurrentRequestID(c)}, identity.Issuer, identity.Subject)
+
+	if err == models.ErrStaleVersion {
+		respond(c, http.StatusUnauthorized, gin.H{"message": "This account is linked to another identity, please log in with it."})
+		return models.User{}, false
+	}
+
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return models.User{}, false
+	}
+
+	return user, true
+}
+
+// GET request at /auth/oidc/callback, where the provider redirects the user after his login.
+// The state must match the state cookie set by /auth/oidc/login in the same browser.
+// The account linked to the identity (issuer and subject) of the user at the provider is used. The first time, the account with the same
+// verified email is linked to it, or an account without password is created if there is none.
+// 200 and the token, like /login, if successful.
+// 401 if the login failed or was refused, the state doesn't match the cookie, the email isn't verified by the provider,
+// or the account with the email is linked to another identity.
+// 404 if OpenID Connect login isn't configured.
+// 500 if something went wrong.
+func OIDCCallback(c *gin.Context) {
+	if services.OIDC == nil {
+		respond(c, http.StatusNotFound, gin.H{"message": "OpenID Connect login is not enabled."})
+		return
+	}
+
+	stateMatches := oidcStateMatches(c)
+	middlewares.ClearOIDCStateCookie(c)
+
+	if providerError := c.Query("error"); providerError != "" {
+		respond(c, http.StatusUnauthorized, gin.H{"message": "The identity provider refused the login: " + providerError + "."})
+		return
+	}
+
+	if !stateMatches {
+		respond(c, http.StatusUnauthorized, gin.H{"message": "This login wasn't started in this browser, please try again."})
+		return
+	}
+
+	identity, login, err := services.OIDC.FinishLogin(c.Query("state"), c.Query("code"))
+
+	if err != nil {
+		log.Println("oidc callback:", err)
+
+		message := "The login with the identity provider failed, please try again."
+		if err == services.ErrOIDCEmailNotVerified {
+			message = "Your email must be verified by the identity provider."
+		}
+
+		respond(c, http.StatusUnauthorized, gin.H{"message": message})
+		return
+	}
+
+	user, ok := oidcUser(c, identity)
+
+	if !ok {
+		return
+	}
+
+	respondWithToken(c, user, login.Session)
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"rabietf.me/go-assignment/middlewares"
+	"rabietf.me/go-assignment/services"
+)
+
+// Helper function that configures a provider whose discovery document is served locally, and restores the previous one after the test.
+// The token endpoint fails, the tests below never get that far.
+func withStubOIDC(t *testing.T) {
+	var server *httptest.Server
+
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.well-known/openid-configuration" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 server.URL,
+			"authorization_endpoint": server.URL + "/authorize",
+			"token_endpoint":         server.URL + "/token",
+			"jwks_uri":               server.URL + "/jwks",
+		})
+	}))
+
+	previous := services.OIDC
+	services.OIDC = services.NewOIDCProvider(server.URL, "client", "", "https://app.example/callback")
+
+	t.Cleanup(func() {
+		services.OIDC = previous
+		server.Close()
+	})
+}
+
+func oidcRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/auth/oidc/login", OIDCLogin)
+	router.GET("/auth/oidc/callback", OIDCCallback)
+
+	return router
+}
+
+func TestOIDCLoginSetsStateCookie(t *testing.T) {
+	withStubOIDC(t)
+
+	w := httptest.NewRecorder()
+	oidcRouter().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/oidc/login", nil))
+
+	if w.Code != http.StatusFound {
+		t.Fatalf("got %d, want 302", w.Code)
+	}
+
+	location, err := url.Parse(w.Header().Get("Location"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var cookie *http.Cookie
+
+	for _, c := range w.Result().Cookies() {
+		if c.Name == middlewares.OIDCStateCookie {
+			cookie = c
+		}
+	}
+
+	if cookie == nil || cookie.Value == "" || cookie.Value != location.Query().Get("state") {
+		t.Fatalf("state cookie %v doesn't hold the state of %s", cookie, location)
+	}
+
+	if !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode {
+		t.Fatalf("state cookie must be HttpOnly and SameSite=Lax, got %v", cookie)
+	}
+}
+
+func TestOIDCCallbackRequiresStateCookie(t *testing.T) {
+	withStubOIDC(t)
+	router := oidcRouter()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/oidc/login", nil))
+
+	location, err := url.Parse(w.Header().Get("Location"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state := location.Query().Get("state")
+
+	// The attacker started the login and sends the victim to the callback: the browser of the victim has no or another state cookie.
+	for _, cookie := range []string{"", "another-state"} {
+		req := httptest.NewRequest(http.MethodGet, "/auth/oidc/callback?code=attacker-code&state="+url.QueryEscape(state), nil)
+
+		if cookie != "" {
+			req.AddCookie(&http.Cookie{Name: middlewares.OIDCStateCookie, Value: cookie})
+		}
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("cookie %q: got %d, want 401", cookie, w.Code)
+		}
+	}
+}
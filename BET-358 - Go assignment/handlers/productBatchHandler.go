@@ -0,0 +1,361 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"rabietf.me/go-assignment/dtos"
+	"rabietf.me/go-assignment/middlewares"
+	"rabietf.me/go-assignment/models"
+	"rabietf.me/go-assignment/services"
+)
+
+// State of a POST /products:batch request, shared by its operations.
+type batch struct {
+	principal    services.Principal
+	actor        models.Actor
+	dbCategories []models.Category
+	// Shops already read, by ID.
+	shops map[int64]models.Shop
+	// Products already targeted by an update or a delete.
+	seen map[int64]bool
+}
+
+// An operation of a batch once checked: either its result already holds its error, or write applies it.
+type batchStep struct {
+	result dtos.BatchResult
+	write  func(tx *sql.Tx) error
+	// Images of a deleted product, their blobs are removed once the batch is committed.
+	images []models.ProductImage
+}
+
+// Helper function that sets the error of the step, with the status code its own endpoint would have answered.
+func (step *batchStep) fail(status int, message, field string) {
+	step.result.Status = status
+	step.result.Error = message
+	step.result.Field = field
+}
+
+// Helper function that finds a shop, reading it once per batch.
+// Returns (shop, true, nil) if it exists.
+// Returns (Shop{}, false, nil) if it doesn't.
+// Returns (Shop{}, false, err) if something went wrong.
+func (b *batch) findShop(id int64) (models.Shop, bool, error) {
+	if shop, ok := b.shops[id]; ok {
+		return shop, true, nil
+	}
+
+	var shop models.Shop
+
+	ok, err := shop.FindById(id)
+
+	if err != nil || !ok {
+		return models.Shop{}, false, err
+	}
+
+	b.shops[id] = shop
+
+	return shop, true, nil
+}
+
+// Helper function that checks that the principal may change the products of the shop, like CreateProduct and findOwnedProduct.
+func (b *batch) ownsShop(shop models.Shop) bool {
+	return shop.OwnerID == b.principal.UserID && b.principal.CanAccessShop(shop.ID)
+}
+
+// Helper function that checks the name, the description and the categories of a created or updated product, like CreateProduct and EditProduct.
+// Returns true if they are valid, fails the step otherwise.
+func (b *batch) checkFields(step *batchStep, operation dtos.BatchOperation) bool {
+	// Checked here, the database would fail the whole batch otherwise.
+	tooLong, field := checkProductLengths(operation.Name, operation.Description)
+
+	switch {
+	case operation.Name == "":
+		step.fail(http.StatusBadRequest, "The name is required.", "name")
+	case tooLong != "":
+		step.fail(http.StatusBadRequest, tooLong, field)
+	case operation.Categories == "":
+		step.fail(http.StatusBadRequest, "The categories are required.", "categories")
+	case !checkAllElements(strings.Split(operation.Categories, ","), b.dbCategories):
+		step.fail(http.StatusBadRequest, "One of the categories you mentionned is not a correct category or has subcategories, please check GET /categories to know the correct categories.", "categories")
+	default:
+		return true
+	}
+
+	return false
+}
+
+// Helper function that finds the product targeted by an update or a delete, and checks that the principal may change it.
+// Returns (product, true, nil) if so.
+// Returns (Product{}, false, nil) after failing the step otherwise.
+// Returns (Product{}, false, err) if something went wrong.
+func (b *batch) findTarget(step *batchStep, operation dtos.BatchOperation) (models.Product, bool, error) {
+	var product models.Product
+
+	if operation.ID <= 0 {
+		step.fail(http.StatusBadRequest, "The id of the product is required.", "id")
+		return models.Product{}, false, nil
+	}
+
+	if operation.Version == 0 {
+		step.fail(http.StatusPreconditionRequired, "Please send the version of the product you are modifying.", "version")
+		return models.Product{}, false, nil
+	}
+
+	if b.seen[operation.ID] {
+		step.fail(http.StatusBadRequest, "Another operation of the batch already updates or deletes this product.", "id")
+		return models.Product{}, false, nil
+	}
+
+	b.seen[operation.ID] = true
+
+	ok, err := product.FindById(operation.ID)
+
+	if err != nil {
+		return models.Product{}, false, err
+	}
+
+	if !ok {
+		step.fail(http.StatusNotFound, "Product doesn't not exist.", "id")
+		return models.Product{}, false, nil
+	}
+
+	shop, ok, err := b.findShop(product.ShopID)
+
+	if err != nil || !ok {
+		return models.Product{}, false, errors.New("shop of the product not found")
+	}
+
+	if !b.ownsShop(shop) {
+		step.fail(http.StatusForbidden, "User doesn't have permission to change this product.", "")
+		return models.Product{}, false, nil
+	}
+
+	if operation.Version != product.Version {
+		step.fail(http.StatusPreconditionFailed, "This product was modified since you read it, please get it again.", "version")
+		return models.Product{}, false, nil
+	}
+
+	return product, true, nil
+}
+
+// Helper function that checks an operation of the batch and prepares its write.
+// Returns (step, nil), the step holding its error if the operation can't be applied.
+// Returns (nil, err) if something went wrong.
+func (b *batch) prepare(index int, operation dtos.BatchOperation) (*batchStep, error) {
+	step := &batchStep{result: dtos.BatchResult{Index: index, Op: operation.Op}}
+
+	switch operation.Op {
+	case dtos.BatchCreate:
+		if operation.ShopID <= 0 {
+			step.fail(http.StatusBadRequest, "The shop_id of the product is required.", "shop_id")
+			return step, nil
+		}
+
+		if !b.checkFields(step, operation) {
+			return step, nil
+		}
+
+		shop, ok, err := b.findShop(operation.ShopID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok {
+			step.fail(http.StatusBadRequest, "Shop doesn't not exist.", "shop_id")
+			return step, nil
+		}
+
+		if !b.ownsShop(shop) {
+			step.fail(http.StatusForbidden, "User doesn't have permission to add product to this store.", "shop_id")
+			return step, nil
+		}
+
+		product := operation.ToModel()
+
+		step.result.Status = http.StatusCreated
+		step.write = func(tx *sql.Tx) error {
+			id, err := product.SaveTx(tx, b.actor)
+			step.result.ProductID = id
+			return err
+		}
+
+	case dtos.BatchUpdate:
+		product, ok, err := b.findTarget(step, operation)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok {
+			return step, nil
+		}
+
+		if !b.checkFields(step, operation) {
+			return step, nil
+		}
+
+		newProduct := operation.ToModel()
+
+		step.result.Status = http.StatusOK
+		step.result.ProductID = product.ID
+		step.result.Version = product.Version + 1
+		step.write = func(tx *sql.Tx) error {
+			return product.UpdateTx(tx, b.actor, newProduct)
+		}
+
+	case dtos.BatchDelete:
+		product, ok, err := b.findTarget(step, operation)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok {
+			return step, nil
+		}
+
+		var image models.ProductImage
+
+		if step.images, err = image.FindAllByProduct(product.ID); err != nil {
+			return nil, err
+		}
+
+		step.result.Status = http.StatusOK
+		step.result.ProductID = product.ID
+		step.write = func(tx *sql.Tx) error {
+			return product.DeleteTx(tx, b.actor)
+		}
+	}
+
+	return step, nil
+}
+
+// POST request at /products:batch, applies a list of create, update and delete operations on products in one transaction.
+// Each operation takes the fields of POST /products (create) or PUT /products/:id (update), update and delete take the id of the product
+// and the version the client read instead of If-Match. Each one is authorized against the shop of its product.
+// Nothing is applied if an operation fails, unless continue_on_error is set: the operations that succeed are applied then.
+// User must be authenticated, or use an API key with the products:write scope, and own the shops of the products.
+// 200 and the result of every operation if operations were applied.
+// 400 for bad formatting, or more than 100 operations.
+// 422 and the result of every operation if none was applied.
+// 500 if something went wrong.
+func BatchProducts(c *gin.Context) {
+	var request dtos.BatchRequest
+	var category models.Category
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"message": "Incorrect format, please send in JSON: operations, a list of 1 to 100 objects with op (create, update or delete) and the fields of the product, and optionally continue_on_error."})
+		return
+	}
+
+	principal, ok := middlewares.CurrentPrincipal(c)
+
+	if !ok {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return
+	}
+
+	dbCategories, err := category.FindAll(time.Time{})
+
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return
+	}
+
+	b := batch{principal: principal, actor: currentActor(c), dbCategories: dbCategories, shops: map[int64]models.Shop{}, seen: map[int64]bool{}}
+
+	steps := make([]*batchStep, len(request.Operations))
+	var writes []func(tx *sql.Tx) error
+	var written []*batchStep
+	prepared := true
+
+	for i, operation := range request.Operations {
+		step, err := b.prepare(i, operation)
+
+		if err != nil {
+			respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+			return
+		}
+
+		steps[i] = step
+
+		if step.write == nil {
+			prepared = false
+			continue
+		}
+
+		writes = append(writes, step.write)
+		written = append(written, step)
+	}
+
+	mode := models.BatchAtomic
+
+	if request.ContinueOnError {
+		mode = models.BatchContinueOnError
+	} else if !prepared {
+		// The batch is already failed, the writes are still tried to report their conflicts.
+		mode = models.BatchDryRun
+	}
+
+	committed := false
+	errs := make([]error, len(writes))
+
+	if len(writes) > 0 {
+		committed, errs, err = models.RunBatch(writes, mode)
+
+		if err != nil {
+			respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+			return
+		}
+	}
+
+	for j, step := range written {
+		var duplicate models.DuplicateError
+
+		switch {
+		case errors.As(errs[j], &duplicate):
+			step.fail(http.StatusConflict, productConflicts[duplicate.Field], duplicate.Field)
+		case errs[j] == models.ErrStaleVersion:
+			step.fail(http.StatusPreconditionFailed, "This product was modified since you read it, please get it again.", "version")
+		case !committed:
+			step.fail(http.StatusFailedDependency, "Not applied because another operation of the batch failed.", "")
+		}
+
+		if step.result.Error != "" {
+			step.result.Version = 0
+
+			if step.result.Op == dtos.BatchCreate {
+				step.result.ProductID = 0
+			}
+		}
+	}
+
+	response := dtos.BatchResponse{Results: make([]dtos.BatchResult, len(steps))}
+
+	for i, step := range steps {
+		response.Results[i] = step.result
+
+		if step.result.Error == "" {
+			response.Applied++
+		} else {
+			response.Failed++
+		}
+
+		if step.result.Error == "" && step.result.Op == dtos.BatchDelete {
+			deleteImageBlobs(c, step.images)
+		}
+	}
+
+	if response.Applied == 0 {
+		respond(c, http.StatusUnprocessableEntity, response)
+		return
+	}
+
+	respond(c, http.StatusOK, response)
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"rabietf.me/go-assignment/dtos"
+	"rabietf.me/go-assignment/models"
+)
+
+// The operations failing here are rejected before reading the database.
+func TestBatchPrepareRejectsOperations(t *testing.T) {
+	long := strings.Repeat("é", maxProductFieldLength+1)
+
+	cases := []struct {
+		name      string
+		operation dtos.BatchOperation
+		status    int
+		field     string
+	}{
+		{"update without version", dtos.BatchOperation{Op: dtos.BatchUpdate, ID: 5, Name: "Bread", Categories: "Food"}, http.StatusPreconditionRequired, "version"},
+		{"delete without version", dtos.BatchOperation{Op: dtos.BatchDelete, ID: 5}, http.StatusPreconditionRequired, "version"},
+		{"update without id", dtos.BatchOperation{Op: dtos.BatchUpdate, Version: 2}, http.StatusBadRequest, "id"},
+		{"create without name", dtos.BatchOperation{Op: dtos.BatchCreate, ShopID: 1, Categories: "Food"}, http.StatusBadRequest, "name"},
+		{"create with a long name", dtos.BatchOperation{Op: dtos.BatchCreate, ShopID: 1, Name: long, Categories: "Food"}, http.StatusBadRequest, "name"},
+		{"create with a long description", dtos.BatchOperation{Op: dtos.BatchCreate, ShopID: 1, Name: "Bread", Description: long, Categories: "Food"}, http.StatusBadRequest, "description"},
+		{"create with an unknown category", dtos.BatchOperation{Op: dtos.BatchCreate, ShopID: 1, Name: "Bread", Categories: "Food, Toys"}, http.StatusBadRequest, "categories"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			b := batch{dbCategories: []models.Category{{ID: 1, Name: "Food"}}, shops: map[int64]models.Shop{}, seen: map[int64]bool{}}
+
+			step, err := b.prepare(0, tc.operation)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if step.write != nil || step.result.Status != tc.status || step.result.Field != tc.field {
+				t.Fatalf("got status %d on %q (%s), want %d on %q without write", step.result.Status, step.result.Field, step.result.Error, tc.status, tc.field)
+			}
+		})
+	}
+}
+
+func TestCheckProductLengths(t *testing.T) {
+	fits := strings.Repeat("é", maxProductFieldLength)
+	long := fits + "é"
+
+	cases := []struct {
+		name, description string
+		field             string
+	}{
+		// Counted in characters, not in bytes.
+		{fits, fits, ""},
+		{long, "", "name"},
+		{"Bread", long, "description"},
+		{long, long, "name"},
+	}
+
+	for _, tc := range cases {
+		message, field := checkProductLengths(tc.name, tc.description)
+
+		if field != tc.field || (field == "") != (message == "") {
+			t.Fatalf("got (%q, %q), want field %q", message, field, tc.field)
+		}
+	}
+}
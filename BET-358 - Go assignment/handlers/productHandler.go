@@ -1,21 +1,29 @@
 package handlers
 
 import (
-	"database/sql"
 	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"rabietf.me/go-assignment/dtos"
+	"rabietf.me/go-assignment/middlewares"
 	"rabietf.me/go-assignment/models"
 )
 
-// Helper function that checks that all of the given categories are valid and exist in the database.
+// Messages of the conflicts on the unique fields of the products.
+var productConflicts = map[string]string{
+	"name": "This shop already has a product with this name.",
+}
+
+// Helper function that checks that all of the given categories are valid, exist in the database and have no subcategories.
+// Products can only be in the leaves of the category tree.
 func checkAllElements(categories []string, dbCategories []models.Category) bool {
 	set := make(map[string]bool)
 
-	for _, v := range dbCategories {
+	for _, v := range models.LeafCategories(dbCategories) {
 		set[v.Name] = true
 	}
 
@@ -30,40 +38,43 @@ func checkAllElements(categories []string, dbCategories []models.Category) bool
 
 // POST request at /products, creates a new product within the defined shop (shopID)
 // Verifies that user is creating product at a shop he owns.
-// User must be authenticated.
+// User must be authenticated, or use an API key of this shop with the products:write scope.
 // 201 if successful.
 // 500 if something went wrong.
 // 400 if incorrect JSON format.
 // 403 if user is attempting to create a new product in a shop he doesn't own.
+// 409 if the shop already has a product with this name.
 func CreateProduct(c *gin.Context) {
-	var newProduct models.Product
-	ctxId, ok := c.Get("userID")
+	var request dtos.CreateProductRequest
+	principal, ok := middlewares.CurrentPrincipal(c)
 
 	if !ok {
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
 		return
 	}
 
-	userID := int64(ctxId.(float64))
+	userID := principal.UserID
 
-	if err := c.BindJSON(&newProduct); err != nil {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Incorrect format, please send in JSON: ShopID, Name, Description and Categories all in one string separated by a comma."})
+	if err := c.BindJSON(&request); err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"message": "Incorrect format, please send in JSON: shop_id, name, description and categories all in one string separated by a comma."})
 		return
 	}
 
+	newProduct := request.ToModel()
+
 	categories := strings.Split(newProduct.Categories, ",")
 
 	var category models.Category
 
-	dbCategories, err := category.FindAll()
+	dbCategories, err := category.FindAll(time.Time{})
 
 	if ok = checkAllElements(categories, dbCategories); !ok {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "One of the categories you mentionned is not a correct category, please check GET /categories to know the correct categories."})
+		respond(c, http.StatusBadRequest, gin.H{"message": "One of the categories you mentionned is not a correct category or has subcategories, please check GET /categories to know the correct categories."})
 		return
 	}
 
 	if err != nil {
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
 		return
 	}
 
@@ -72,64 +83,76 @@ func CreateProduct(c *gin.Context) {
 	ok, err = shop.FindById(newProduct.ShopID)
 
 	if err != nil {
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
 		return
 	}
 
 	if !ok {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Shop doesn't not exist."})
+		respond(c, http.StatusBadRequest, gin.H{"message": "Shop doesn't not exist."})
 		return
 	}
 
-	if shop.OwnerID != userID {
-		c.IndentedJSON(http.StatusForbidden, gin.H{"message": "User doesn't have permission to add product to this store."})
+	if shop.OwnerID != userID || !principal.CanAccessShop(shop.ID) {
+		respond(c, http.StatusForbidden, gin.H{"message": "User doesn't have permission to add product to this store."})
 		return
 	}
 
-	id, err := newProduct.Save()
+	id, err := newProduct.Save(currentActor(c))
+
+	if respondConflict(c, err, productConflicts) {
+		return
+	}
 
 	if err != nil {
 		fmt.Println(err)
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
 		return
 	}
 
-	c.IndentedJSON(http.StatusCreated, gin.H{"productId": id, "message": "You created a new product!"})
+	respond(c, http.StatusCreated, gin.H{"product_id": id, "message": "You created a new product!"})
 	return
 
 }
 
-// GET request at /products,
-// 200 and all the products if successful.
-// 404 if there are no products in database.
+// GET request at /products, ?updated_since= only returns the products updated since that time, least recently updated first.
+// 200 and all the products if successful, an empty list if there are none.
+// 400 if updated_since isn't an RFC 3339 time.
 // 500 if internal error.
 func GetProducts(c *gin.Context) {
+	updatedSince, ok := queryUpdatedSince(c)
+
+	if !ok {
+		return
+	}
+
 	var product models.Product
 
-	products, err := product.FindAll()
+	products, err := product.FindAll(updatedSince)
 
 	if err != nil {
-		if err == sql.ErrNoRows {
-			c.IndentedJSON(http.StatusNotFound, gin.H{"message": "No product found in database."})
-			return
-		}
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return
+	}
+
+	if err := models.LoadProductImages(products); err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
 		return
 	}
 
-	c.IndentedJSON(http.StatusOK, products)
+	respond(c, http.StatusOK, dtos.NewProductResponses(products))
 	return
 }
 
 // GET request at /products/:id,
-// 200 and the requested product if successful.
+// 200 and the requested product with its ETag if successful.
+// 304 if If-None-Match holds the current ETag.
 // 404 if the requested product doesn't exist in database.
 // 500 if internal error.
 func GetProductById(c *gin.Context) {
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 
 	if err != nil {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Incorrect format, please enter a correct ID."})
+		respond(c, http.StatusBadRequest, gin.H{"message": "Incorrect format, please enter a correct ID."})
 		return
 	}
 
@@ -138,68 +161,105 @@ func GetProductById(c *gin.Context) {
 	ok, err := product.FindById(id)
 
 	if err != nil {
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
 		return
 	}
 
 	if !ok {
-		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "Product doesn't not exist."})
+		respond(c, http.StatusNotFound, gin.H{"message": "Product doesn't not exist."})
+		return
+	}
+
+	if notModified(c, product.Version) {
+		return
+	}
+
+	var image models.ProductImage
+
+	if product.Images, err = image.FindAllByProduct(product.ID); err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
 		return
 	}
 
-	c.IndentedJSON(http.StatusOK, product)
+	respond(c, http.StatusOK, dtos.NewProductResponse(product))
 	return
 }
 
-// PUT request at /products/:id
-// 200 if successful.
-// 400 for bad formatting.
-// 403 if user isn't owner of the shop where the product belongs.
-// 404 if product doesn't exist.
-// 500 if something went wrong.
-func EditProduct(c *gin.Context) {
+// Helper function that finds the product of the :id parameter, and checks that the principal may modify it:
+// the user must own the shop of the product, and an API key must belong to that shop.
+// Returns (product, true) if so.
+// Returns (Product{}, false) after answering 400, 403 with forbiddenMessage, 404 or 500 otherwise.
+func findOwnedProduct(c *gin.Context, forbiddenMessage string) (models.Product, bool) {
 	var product models.Product
-	var newProduct models.Product
+	var shop models.Shop
 
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 
 	if err != nil {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Please enter a correct ID."})
-		return
+		respond(c, http.StatusBadRequest, gin.H{"message": "Please enter a correct ID."})
+		return models.Product{}, false
 	}
 
-	if err := c.BindJSON(&newProduct); err != nil {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Incorrect format, please send in JSON: name, description and categories: in one string separated by a comma."})
-		return
+	principal, ok := middlewares.CurrentPrincipal(c)
+
+	if !ok {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return models.Product{}, false
 	}
 
-	ctxID, ok := c.Get("userID")
+	ok, err = product.FindById(id)
 
-	userID := int64(ctxID.(float64))
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return models.Product{}, false
+	}
 
 	if !ok {
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
-		return
+		respond(c, http.StatusNotFound, gin.H{"message": "Product doesn't not exist."})
+		return models.Product{}, false
 	}
 
-	ok, err = product.FindById(id)
+	ok, err = shop.FindById(product.ShopID)
 
-	if err != nil {
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
-		return
+	if err != nil || !ok {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return models.Product{}, false
 	}
 
+	if principal.UserID != shop.OwnerID || !principal.CanAccessShop(shop.ID) {
+		respond(c, http.StatusForbidden, gin.H{"message": forbiddenMessage})
+		return models.Product{}, false
+	}
+
+	return product, true
+}
+
+// PUT request at /products/:id, If-Match must hold the ETag of the product.
+// 200 and the new ETag if successful.
+// 400 for bad formatting.
+// 403 if user isn't owner of the shop where the product belongs.
+// 404 if product doesn't exist.
+// 409 if the shop already has another product with this name.
+// 412 if the product was modified since the client read it.
+// 428 if If-Match is missing.
+// 500 if something went wrong.
+func EditProduct(c *gin.Context) {
+	var request dtos.UpdateProductRequest
+
+	product, ok := findOwnedProduct(c, "User doesn't have permission to perform an update on this product.")
+
 	if !ok {
-		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "Product doesn't not exist."})
 		return
 	}
 
-	var shop models.Shop
+	if err := c.BindJSON(&request); err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"message": "Incorrect format, please send in JSON: name, description and categories: in one string separated by a comma."})
+		return
+	}
 
-	shop.FindById(product.ShopID)
+	newProduct := request.ToModel()
 
-	if userID != shop.OwnerID {
-		c.IndentedJSON(http.StatusForbidden, gin.H{"message": "User doesn't have permission to perform an update on this product."})
+	if !preconditionMet(c, product.Version) {
 		return
 	}
 
@@ -207,79 +267,79 @@ func EditProduct(c *gin.Context) {
 
 	var category models.Category
 
-	dbCategories, err := category.FindAll()
+	dbCategories, err := category.FindAll(time.Time{})
 
 	if ok = checkAllElements(categories, dbCategories); !ok {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "One of the categories you mentionned is not a correct category, please check GET /categories to know the correct categories."})
+		respond(c, http.StatusBadRequest, gin.H{"message": "One of the categories you mentionned is not a correct category or has subcategories, please check GET /categories to know the correct categories."})
+		return
+	}
+
+	err = product.Update(currentActor(c), newProduct)
+
+	if respondConflict(c, err, productConflicts) {
 		return
 	}
 
-	err = product.Update(newProduct)
+	if err == models.ErrStaleVersion {
+		respond(c, http.StatusPreconditionFailed, gin.H{"message": "This resource was modified since you read it, please get it again."})
+		return
+	}
 
 	if err != nil {
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
 		return
 	}
 
-	c.IndentedJSON(http.StatusOK, gin.H{"message": "Product updated successfuly."})
+	c.Header("ETag", etag(product.Version+1))
+	respond(c, http.StatusOK, gin.H{"message": "Product updated successfuly."})
 	return
 
 }
 
-// DELETE request at /products/:id
+// DELETE request at /products/:id, If-Match must hold the ETag of the product.
 // 200 if successful.
 // 400 for bad formatting.
 // 403 if user isn't owner of the shop where the product belongs.
 // 404 if product doesn't exist.
+// 412 if the product was modified since the client read it.
+// 428 if If-Match is missing.
 // 500 if something went wrong.
 func DeleteProduct(c *gin.Context) {
-	var product models.Product
-
-	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
-
-	if err != nil {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Please enter a correct ID."})
-		return
-	}
-
-	ctxID, ok := c.Get("userID")
-
-	userID := int64(ctxID.(float64))
-
-	ok, err = product.FindById(id)
+	product, ok := findOwnedProduct(c, "User doesn't have permission to delete this product.")
 
 	if !ok {
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
 		return
 	}
 
-	if err != nil {
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+	if !preconditionMet(c, product.Version) {
 		return
 	}
 
-	if !ok {
-		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "Product doesn't not exist."})
+	// The rows of the images go away with the product, their blobs are removed afterwards.
+	var image models.ProductImage
+
+	images, err := image.FindAllByProduct(product.ID)
+
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
 		return
 	}
 
-	var shop models.Shop
-
-	shop.FindById(product.ShopID)
+	err = product.Delete(currentActor(c))
 
-	if userID != shop.OwnerID {
-		c.IndentedJSON(http.StatusForbidden, gin.H{"message": "User doesn't have permission to delete this product."})
+	if err == models.ErrStaleVersion {
+		respond(c, http.StatusPreconditionFailed, gin.H{"message": "This resource was modified since you read it, please get it again."})
 		return
 	}
 
-	err = product.Delete()
-
 	if err != nil {
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
 		return
 	}
 
-	c.IndentedJSON(http.StatusOK, gin.H{"message": "Product deleted successfuly."})
+	deleteImageBlobs(c, images)
+
+	respond(c, http.StatusOK, gin.H{"message": "Product deleted successfuly."})
 	return
 
 }
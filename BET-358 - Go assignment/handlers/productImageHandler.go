@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"rabietf.me/go-assignment/dtos"
+	"rabietf.me/go-assignment/models"
+	"rabietf.me/go-assignment/services"
+)
+
+// Room left for the rest of the multipart body around the image.
+const multipartOverhead = 64 << 10
+
+// Helper function that removes the blobs of deleted images, failures are only logged since the images are already gone.
+func deleteImageBlobs(c *gin.Context, images []models.ProductImage) {
+	for _, image := range images {
+		if err := services.Blobs.Delete(c.Request.Context(), image.BlobKey); err != nil {
+			log.Println("image blob:", image.BlobKey, err)
+		}
+	}
+}
+
+// Helper function that returns a random blob key for an image of a product.
+func newImageKey(productID int64, extension string) (string, error) {
+	bytes := make([]byte, 16)
+
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("products/%d/%s%s", productID, hex.EncodeToString(bytes), extension), nil
+}
+
+// POST request at /products/:id/images, adds an image after the other images of the product.
+// The image is sent as the "image" field of a multipart form, its type is sniffed from its content: JPEG, PNG and GIF are accepted.
+// User must be authenticated, or use an API key of the shop with the products:write scope, and own the shop of the product.
+// 201 and the image if successful.
+// 400 if the image is missing or its dimensions are out of bounds.
+// 403 if user isn't owner of the shop where the product belongs.
+// 404 if product doesn't exist.
+// 409 if the product already has as many images as allowed.
+// 413 if the image is too large.
+// 415 if the file isn't an accepted image.
+// 500 if something went wrong.
+func UploadProductImage(c *gin.Context) {
+	product, ok := findOwnedProduct(c, "User doesn't have permission to add images to this product.")
+
+	if !ok {
+		return
+	}
+
+	limit := services.Images.MaxBytes
+
+	if c.Request.ContentLength > limit+multipartOverhead {
+		respond(c, http.StatusRequestEntityTooLarge, gin.H{"message": fmt.Sprintf("Images can't be larger than %d bytes.", limit)})
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit+multipartOverhead)
+
+	fileHeader, err := c.FormFile("image")
+
+	if err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"message": "Incorrect format, please send the image in the image field of a multipart form."})
+		return
+	}
+
+	if fileHeader.Size > limit {
+		respond(c, http.StatusRequestEntityTooLarge, gin.H{"message": fmt.Sprintf("Images can't be larger than %d bytes.", limit)})
+		return
+	}
+
+	file, err := fileHeader.Open()
+
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(file, limit+1))
+	file.Close()
+
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return
+	}
+
+	info, err := services.Images.ValidateImage(data)
+
+	switch err {
+	case nil:
+	case services.ErrImageTooLarge:
+		respond(c, http.StatusRequestEntityTooLarge, gin.H{"message": fmt.Sprintf("Images can't be larger than %d bytes.", limit)})
+		return
+	case services.ErrImageDimensions:
+		respond(c, http.StatusBadRequest, gin.H{"message": fmt.Sprintf("Images must be at most %d pixels wide and high.", services.Images.MaxDimension)})
+		return
+	default:
+		respond(c, http.StatusUnsupportedMediaType, gin.H{"message": "Only JPEG, PNG and GIF images are accepted."})
+		return
+	}
+
+	key, err := newImageKey(product.ID, info.Extension)
+
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return
+	}
+
+	if err := services.Blobs.Put(c.Request.Context(), key, data, info.ContentType); err != nil {
+		log.Println("image blob:", key, err)
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return
+	}
+
+	newImage := models.ProductImage{ProductID: product.ID, BlobKey: key, ContentType: info.ContentType, Width: info.Width, Height: info.Height, Size: int64(len(data))}
+
+	image, err := newImage.Save(currentActor(c), services.Images.MaxPerProduct)
+
+	if err != nil {
+		deleteImageBlobs(c, []models.ProductImage{newImage})
+
+		if err == models.ErrTooManyImages {
+			respond(c, http.StatusConflict, gin.H{"message": fmt.Sprintf("A product can't have more than %d images.", services.Images.MaxPerProduct)})
+			return
+		}
+
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return
+	}
+
+	respond(c, http.StatusCreated, gin.H{"message": "Image added successfuly.", "image": dtos.NewProductImageResponse(image)})
+}
+
+// Helper function that finds the image of the :image_id parameter among the images of product.
+// Returns (image, true) if it exists.
+// Returns (ProductImage{}, false) after answering 400, 404 or 500 otherwise.
+func findProductImage(c *gin.Context, productID int64) (models.ProductImage, bool) {
+	var image models.ProductImage
+
+	id, err := strconv.ParseInt(c.Param("image_id"), 10, 64)
+
+	if err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"message": "Please enter a correct image ID."})
+		return models.ProductImage{}, false
+	}
+
+	ok, err := image.FindByIdAndProduct(id, productID)
+
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return models.ProductImage{}, false
+	}
+
+	if !ok {
+		respond(c, http.StatusNotFound, gin.H{"message": "Image doesn't not exist."})
+		return models.ProductImage{}, false
+	}
+
+	return image, true
+}
+
+// GET request at /products/:id/images/:image_id, returns the image itself.
+// Images never change once uploaded, so they can be cached forever.
+// 200 and the image if successful.
+// 400 for bad formatting.
+// 404 if the image doesn't exist, or its content isn't in the blob store anymore.
+// 500 if something went wrong.
+func GetProductImage(c *gin.Context) {
+	productID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+
+	if err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"message": "Please enter a correct ID."})
+		return
+	}
+
+	image, ok := findProductImage(c, productID)
+
+	if !ok {
+		return
+	}
+
+	reader, err := services.Blobs.Get(c.Request.Context(), image.BlobKey)
+
+	if err == services.ErrBlobNotFound {
+		log.Println("image blob missing:", image.BlobKey)
+		respond(c, http.StatusNotFound, gin.H{"message": "Image doesn't exist."})
+		return
+	}
+
+	if err != nil {
+		log.Println("image blob:", image.BlobKey, err)
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return
+	}
+
+	defer reader.Close()
+
+	c.DataFromReader(http.StatusOK, image.Size, image.ContentType, reader, map[string]string{
+		"Cache-Control": "public, max-age=31536000, immutable",
+	})
+}
+
+// DELETE request at /products/:id/images/:image_id, removes an image of the product.
+// User must be authenticated, or use an API key of the shop with the products:write scope, and own the shop of the product.
+// 200 if successful.
+// 400 for bad formatting.
+// 403 if user isn't owner of the shop where the product belongs.
+// 404 if the product or the image doesn't exist.
+// 500 if something went wrong.
+func DeleteProductImage(c *gin.Context) {
+	product, ok := findOwnedProduct(c, "User doesn't have permission to delete images of this product.")
+
+	if !ok {
+		return
+	}
+
+	image, ok := findProductImage(c, product.ID)
+
+	if !ok {
+		return
+	}
+
+	if err := image.Delete(currentActor(c)); err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return
+	}
+
+	deleteImageBlobs(c, []models.ProductImage{image})
+
+	respond(c, http.StatusOK, gin.H{"message": "Image deleted successfuly."})
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	DB "rabietf.me/go-assignment/db"
+	"rabietf.me/go-assignment/services"
+)
+
+func TestGetProductImageWithoutBlob(t *testing.T) {
+	connection, mock, err := sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previousDB, previousBlobs := DB.Connection, services.Blobs
+	DB.Connection = connection
+	// The row of the image is there, but its content isn't in the (empty) store.
+	services.Blobs = services.LocalBlobStore{Dir: t.TempDir()}
+
+	t.Cleanup(func() {
+		DB.Connection, services.Blobs = previousDB, previousBlobs
+		connection.Close()
+	})
+
+	columns := []string{"id", "product_id", "blob_key", "content_type", "width", "height", "size", "position", "created_at"}
+	mock.ExpectQuery(regexp.QuoteMeta("FROM ProductImages WHERE id = ? AND product_id = ?")).WithArgs(int64(3), int64(5)).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(int64(3), int64(5), "products/5/3", "image/png", 640, 480, int64(2048), 0, time.Now()))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/products/:id/images/:image_id", GetProductImage)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/products/5/images/3", nil))
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("got %d, want 404: %s", w.Code, w.Body)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,453 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"rabietf.me/go-assignment/dtos"
+	"rabietf.me/go-assignment/middlewares"
+	"rabietf.me/go-assignment/models"
+)
+
+const (
+	// Maximum size of an imported file.
+	maxImportBytes = 10 << 20
+	// Maximum number of products of an imported file.
+	maxImportRows = 5000
+	// Maximum length of the text columns of the products.
+	maxProductFieldLength = 255
+	// Number of exported products between two flushes of the response.
+	exportFlushEvery = 100
+)
+
+const (
+	importAtomic     = "atomic"
+	importBestEffort = "best_effort"
+)
+
+// Returned by the parsers when the file has more than maxImportRows products.
+var errTooManyRows = fmt.Errorf("files can't have more than %d products", maxImportRows)
+
+// A row of an imported file, before being saved.
+type importRow struct {
+	line    int
+	product dtos.ImportProductRow
+	// Set when the row can't be saved.
+	err   string
+	field string
+}
+
+// Helper function that reads the products of a CSV file with a header line, name and categories columns are required.
+// A description column is optional, other columns, like the ones of an export, are ignored.
+// Returns (rows, nil) if the file could be read, rows with the wrong number of fields having their err set.
+// Returns (nil, err) otherwise.
+func parseImportCSV(data []byte) ([]importRow, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+
+	header, err := reader.Read()
+
+	if err == io.EOF {
+		return []importRow{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	columns := map[string]int{}
+
+	for i, name := range header {
+		// Spreadsheets often start their CSV files with a byte order mark.
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\uFEFF")
+		}
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	nameColumn, hasName := columns["name"]
+	categoriesColumn, hasCategories := columns["categories"]
+	descriptionColumn, hasDescription := columns["description"]
+
+	if !hasName || !hasCategories {
+		return nil, errors.New("the header must have name and categories columns")
+	}
+
+	rows := []importRow{}
+
+	for {
+		record, err := reader.Read()
+
+		if err == io.EOF {
+			return rows, nil
+		}
+
+		if len(rows) == maxImportRows {
+			return nil, errTooManyRows
+		}
+
+		line, _ := reader.FieldPos(0)
+
+		var parseErr *csv.ParseError
+
+		if errors.As(err, &parseErr) && parseErr.Err == csv.ErrFieldCount {
+			rows = append(rows, importRow{line: line, err: fmt.Sprintf("The row has %d fields instead of %d.", len(record), len(header))})
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		row := importRow{line: line}
+		row.product.Name = record[nameColumn]
+		row.product.Categories = record[categoriesColumn]
+
+		if hasDescription {
+			row.product.Description = record[descriptionColumn]
+		}
+
+		rows = append(rows, row)
+	}
+}
+
+// Helper function that reads the products of a NDJSON file, one JSON object per line, blank lines being skipped.
+// Returns (rows, nil) if the file could be read, lines that aren't a JSON object having their err set.
+// Returns (nil, err) otherwise.
+func parseImportNDJSON(data []byte) ([]importRow, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64<<10), maxImportBytes)
+
+	rows := []importRow{}
+
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+
+		if len(text) == 0 {
+			continue
+		}
+
+		if len(rows) == maxImportRows {
+			return nil, errTooManyRows
+		}
+
+		row := importRow{line: line}
+
+		if err := json.Unmarshal(text, &row.product); err != nil {
+			row.err = "The line isn't a JSON object with name, description and categories."
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, scanner.Err()
+}
+
+// Helper function that checks that the name and the description of a product fit in their columns.
+// Returns (message, field) for the first one that is too long, ("", "") if both fit.
+func checkProductLengths(name, description string) (string, string) {
+	switch {
+	case utf8.RuneCountInString(name) > maxProductFieldLength:
+		return fmt.Sprintf("The name can't be longer than %d characters.", maxProductFieldLength), "name"
+	case utf8.RuneCountInString(description) > maxProductFieldLength:
+		return fmt.Sprintf("The description can't be longer than %d characters.", maxProductFieldLength), "description"
+	}
+
+	return "", ""
+}
+
+// Helper function that checks a row against the constraints of CreateProduct, setting its err if it breaks one.
+func validateImportRow(row *importRow, dbCategories []models.Category) {
+	row.product.Name = strings.TrimSpace(row.product.Name)
+	tooLong, field := checkProductLengths(row.product.Name, row.product.Description)
+
+	switch {
+	case row.err != "":
+	case row.product.Name == "":
+		row.err, row.field = "The name is required.", "name"
+	case tooLong != "":
+		row.err, row.field = tooLong, field
+	case strings.TrimSpace(row.product.Categories) == "":
+		row.err, row.field = "The categories are required.", "categories"
+	case !checkAllElements(strings.Split(row.product.Categories, ","), dbCategories):
+		row.err, row.field = "One of the categories is not a correct category or has subcategories, please check GET /categories to know the correct categories.", "categories"
+	}
+}
+
+// POST request at /shops/:id/products/import, :id is the ID or the slug of the shop, creates many products at once.
+// The file is the body, in CSV with a header line (Content-Type text/csv) or in NDJSON (Content-Type application/x-ndjson),
+// with the name, description and categories of each product, other columns and fields being ignored.
+// ?mode=atomic (default) imports nothing if a row fails, ?mode=best_effort imports the rows that succeed.
+// User must be authenticated, or use an API key of this shop with the products:write scope, and own the shop.
+// 201 and the report of every row if products were imported.
+// 400 if the mode is invalid, or the file can't be read or has no products.
+// 403 if user doesn't own the shop.
+// 404 if the shop doesn't exist.
+// 413 if the file is larger than 10 MiB or has more than 5000 products.
+// 415 if the Content-Type isn't CSV nor NDJSON.
+// 422 and the report of every row if no product was imported.
+// 500 if something went wrong.
+func ImportProducts(c *gin.Context) {
+	mode := c.DefaultQuery("mode", importAtomic)
+
+	if mode != importAtomic && mode != importBestEffort {
+		respond(c, http.StatusBadRequest, gin.H{"message": "Incorrect format, mode must be atomic or best_effort."})
+		return
+	}
+
+	var parse func([]byte) ([]importRow, error)
+
+	mediaType, _, _ := mime.ParseMediaType(c.ContentType())
+
+	switch mediaType {
+	case "text/csv":
+		parse = parseImportCSV
+	case "application/x-ndjson", "application/jsonl":
+		parse = parseImportNDJSON
+	default:
+		respond(c, http.StatusUnsupportedMediaType, gin.H{"message": "Please send the products in CSV (text/csv) or NDJSON (application/x-ndjson)."})
+		return
+	}
+
+	principal, ok := middlewares.CurrentPrincipal(c)
+
+	if !ok {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return
+	}
+
+	shop, ok := findShop(c)
+
+	if !ok {
+		return
+	}
+
+	if shop.OwnerID != principal.UserID || !principal.CanAccessShop(shop.ID) {
+		respond(c, http.StatusForbidden, gin.H{"message": "User doesn't have permission to add products to this store."})
+		return
+	}
+
+	if c.Request.ContentLength > maxImportBytes {
+		respond(c, http.StatusRequestEntityTooLarge, gin.H{"message": "Imported files can't be larger than 10 MiB."})
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(c.Request.Body, maxImportBytes+1))
+
+	if err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"message": "The file couldn't be read."})
+		return
+	}
+
+	if len(data) > maxImportBytes {
+		respond(c, http.StatusRequestEntityTooLarge, gin.H{"message": "Imported files can't be larger than 10 MiB."})
+		return
+	}
+
+	rows, err := parse(data)
+
+	if err == errTooManyRows {
+		respond(c, http.StatusRequestEntityTooLarge, gin.H{"message": fmt.Sprintf("Imported files can't have more than %d products.", maxImportRows)})
+		return
+	}
+
+	if err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"message": "The file couldn't be read: " + err.Error() + "."})
+		return
+	}
+
+	if len(rows) == 0 {
+		respond(c, http.StatusBadRequest, gin.H{"message": "The file has no products."})
+		return
+	}
+
+	var category models.Category
+
+	dbCategories, err := category.FindAll(time.Time{})
+
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return
+	}
+
+	// Only the valid rows are saved, remembering which row each product comes from.
+	var products []models.Product
+	var origins []int
+
+	for i := range rows {
+		validateImportRow(&rows[i], dbCategories)
+
+		if rows[i].err == "" {
+			products = append(products, rows[i].product.ToModel(shop.ID))
+			origins = append(origins, i)
+		}
+	}
+
+	ids := make([]int64, len(products))
+	errs := make([]error, len(products))
+
+	switch {
+	case mode == importBestEffort:
+		ids, errs, err = models.SaveProducts(currentActor(c), products, models.BatchContinueOnError)
+	case len(products) == len(rows):
+		ids, errs, err = models.SaveProducts(currentActor(c), products, models.BatchAtomic)
+	case len(products) > 0:
+		// The import is already failed, the products are still tried to report their conflicts.
+		_, errs, err = models.SaveProducts(currentActor(c), products, models.BatchDryRun)
+	}
+
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return
+	}
+
+	report := dtos.ImportReport{Mode: mode, Rows: make([]dtos.ImportRowReport, len(rows))}
+
+	for i, row := range rows {
+		report.Rows[i] = dtos.ImportRowReport{Line: row.line, Error: row.err, Field: row.field}
+	}
+
+	for j, i := range origins {
+		var duplicate models.DuplicateError
+
+		if errors.As(errs[j], &duplicate) {
+			report.Rows[i].Error = productConflicts[duplicate.Field]
+			report.Rows[i].Field = duplicate.Field
+		}
+
+		report.Rows[i].ProductID = ids[j]
+	}
+
+	for _, row := range report.Rows {
+		if row.ProductID != 0 {
+			report.Imported++
+		} else if row.Error != "" {
+			report.Failed++
+		}
+	}
+
+	if report.Imported == 0 {
+		respond(c, http.StatusUnprocessableEntity, report)
+		return
+	}
+
+	respond(c, http.StatusCreated, report)
+}
+
+// GET request at /shops/:id/products/export, :id is the ID or the slug of the shop, streams all its products by ascending ID.
+// ?format=csv (default) gives CSV with a header line, ?format=ndjson one JSON object per line, both can be imported back.
+// 200 and the products if successful.
+// 400 if the format is invalid.
+// 404 if the shop doesn't exist.
+// 500 if something went wrong before the first product was sent, the export is cut short afterwards.
+func ExportProducts(c *gin.Context) {
+	var product models.Product
+
+	format := c.DefaultQuery("format", "csv")
+
+	if format != "csv" && format != "ndjson" {
+		respond(c, http.StatusBadRequest, gin.H{"message": "Incorrect format, format must be csv or ndjson."})
+		return
+	}
+
+	shop, ok := findShop(c)
+
+	if !ok {
+		return
+	}
+
+	csvWriter := csv.NewWriter(c.Writer)
+	encoder := json.NewEncoder(c.Writer)
+	started := false
+	count := 0
+
+	// Headers are only sent with the first product, so that a failing query can still be answered with a 500.
+	start := func() error {
+		if started {
+			return nil
+		}
+
+		started = true
+
+		if format == "csv" {
+			c.Header("Content-Type", "text/csv; charset=utf-8")
+		} else {
+			c.Header("Content-Type", "application/x-ndjson")
+		}
+
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-products.%s"`, shop.Slug, format))
+		c.Status(http.StatusOK)
+
+		if format == "csv" {
+			return csvWriter.Write(dtos.ProductExportHeader)
+		}
+
+		return nil
+	}
+
+	flush := func() error {
+		if format == "csv" {
+			csvWriter.Flush()
+			if err := csvWriter.Error(); err != nil {
+				return err
+			}
+		}
+
+		c.Writer.Flush()
+		return nil
+	}
+
+	err := product.ForEachInShop(shop.ID, func(prd models.Product) error {
+		if err := start(); err != nil {
+			return err
+		}
+
+		row := dtos.NewProductExportRow(prd)
+
+		var err error
+
+		if format == "csv" {
+			err = csvWriter.Write(row.CSVRecord())
+		} else {
+			err = encoder.Encode(row)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if count++; count%exportFlushEvery == 0 {
+			return flush()
+		}
+
+		return nil
+	})
+
+	if err != nil && !started {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return
+	}
+
+	if err == nil {
+		err = start()
+	}
+
+	if err == nil {
+		err = flush()
+	}
+
+	if err != nil {
+		log.Println("export of shop", shop.ID, err)
+	}
+}
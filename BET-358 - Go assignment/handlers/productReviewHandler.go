@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"rabietf.me/go-assignment/dtos"
+	"rabietf.me/go-assignment/middlewares"
+	"rabietf.me/go-assignment/models"
+)
+
+const (
+	defaultReviewsLimit = 20
+	maxReviewsLimit     = 100
+)
+
+// Messages of the conflicts on the unique fields of the reviews.
+var reviewConflicts = map[string]string{
+	"product_id": "You already reviewed this product, please edit your review instead.",
+}
+
+// Helper function that finds the product of the :id parameter.
+// Returns (product, true) if it exists.
+// Returns (Product{}, false) after answering 400, 404 or 500 otherwise.
+func findProduct(c *gin.Context) (models.Product, bool) {
+	var product models.Product
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+
+	if err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"message": "Please enter a correct ID."})
+		return models.Product{}, false
+	}
+
+	ok, err := product.FindById(id)
+
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return models.Product{}, false
+	}
+
+	if !ok {
+		respond(c, http.StatusNotFound, gin.H{"message": "Product doesn't not exist."})
+		return models.Product{}, false
+	}
+
+	return product, true
+}
+
+// Helper function that finds the review of the :review_id parameter among the reviews of the product of the :id parameter,
+// and checks that it was written by the authenticated user.
+// Returns (review, true) if so.
+// Returns (ProductReview{}, false) after answering 400, 403, 404 or 500 otherwise.
+func findOwnReview(c *gin.Context, forbiddenMessage string) (models.ProductReview, bool) {
+	var review models.ProductReview
+
+	product, ok := findProduct(c)
+
+	if !ok {
+		return models.ProductReview{}, false
+	}
+
+	id, err := strconv.ParseInt(c.Param("review_id"), 10, 64)
+
+	if err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"message": "Please enter a correct review ID."})
+		return models.ProductReview{}, false
+	}
+
+	principal, ok := middlewares.CurrentPrincipal(c)
+
+	if !ok {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return models.ProductReview{}, false
+	}
+
+	ok, err = review.FindByIdAndProduct(id, product.ID)
+
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return models.ProductReview{}, false
+	}
+
+	if !ok {
+		respond(c, http.StatusNotFound, gin.H{"message": "Review doesn't not exist."})
+		return models.ProductReview{}, false
+	}
+
+	if review.UserID != principal.UserID {
+		respond(c, http.StatusForbidden, gin.H{"message": forbiddenMessage})
+		return models.ProductReview{}, false
+	}
+
+	return review, true
+}
+
+// POST request at /products/:id/reviews, the authenticated user reviews the product with a rating from 1 to 5 and an optional text.
+// User must be authenticated, and can't review the products of his own shops.
+// 201 if successful.
+// 400 for bad formatting.
+// 403 if user owns the shop of the product.
+// 404 if product doesn't exist.
+// 409 if user already reviewed the product.
+// 500 if something went wrong.
+func CreateProductReview(c *gin.Context) {
+	var request dtos.ProductReviewRequest
+	var shop models.Shop
+
+	product, ok := findProduct(c)
+
+	if !ok {
+		return
+	}
+
+	principal, ok := middlewares.CurrentPrincipal(c)
+
+	if !ok {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return
+	}
+
+	ok, err := shop.FindById(product.ShopID)
+
+	if err != nil || !ok {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return
+	}
+
+	if shop.OwnerID == principal.UserID {
+		respond(c, http.StatusForbidden, gin.H{"message": "You can't review the products of your own shops."})
+		return
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"message": "Incorrect format, please send in JSON: rating from 1 to 5 and text of 2000 characters at most."})
+		return
+	}
+
+	id, err := request.ToModel(product.ID, principal.UserID).Save(currentActor(c))
+
+	if respondConflict(c, err, reviewConflicts) {
+		return
+	}
+
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return
+	}
+
+	respond(c, http.StatusCreated, gin.H{"review_id": id, "message": "You reviewed this product!"})
+}
+
+// GET request at /products/:id/reviews, lists a page of the reviews of the product.
+// ?sort= orders them: newest (default), oldest, highest or lowest rating first, reviews with the same rating newest or oldest first.
+// ?limit= reviews are returned (20 by default, 100 at most), ?after_id= gets the reviews after the given one in that order.
+// 200 and the reviews if successful, an empty list if there are none.
+// 400 if a parameter is invalid, or after_id isn't a review of the product.
+// 404 if product doesn't exist.
+// 500 if something went wrong.
+func GetProductReviews(c *gin.Context) {
+	var review models.ProductReview
+
+	afterID, ok := queryID(c, "after_id")
+
+	if !ok {
+		respond(c, http.StatusBadRequest, gin.H{"message": "Incorrect format, after_id must be an ID."})
+		return
+	}
+
+	sort := c.DefaultQuery("sort", models.ReviewsNewest)
+
+	if sort != models.ReviewsNewest && sort != models.ReviewsOldest && sort != models.ReviewsHighest && sort != models.ReviewsLowest {
+		respond(c, http.StatusBadRequest, gin.H{"message": "Incorrect format, sort must be newest, oldest, highest or lowest."})
+		return
+	}
+
+	limit, ok := queryLimit(c, defaultReviewsLimit, maxReviewsLimit)
+
+	if !ok {
+		return
+	}
+
+	product, ok := findProduct(c)
+
+	if !ok {
+		return
+	}
+
+	filter := models.ReviewFilter{ProductID: product.ID, Sort: sort, Limit: limit}
+
+	if afterID != 0 {
+		// Sorting by rating needs the rating of the last review to find the next ones.
+		ok, err := filter.After.FindByIdAndProduct(afterID, product.ID)
+
+		if err != nil {
+			respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+			return
+		}
+
+		if !ok {
+			respond(c, http.StatusBadRequest, gin.H{"message": "after_id must be a review of this product."})
+			return
+		}
+	}
+
+	reviews, err := review.FindAllByProduct(filter)
+
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return
+	}
+
+	respond(c, http.StatusOK, dtos.NewProductReviewResponses(reviews))
+}
+
+// PUT request at /products/:id/reviews/:review_id, replaces the rating and text of the review.
+// User must be authenticated and be the author of the review.
+// 200 if successful.
+// 400 for bad formatting.
+// 403 if user didn't write the review.
+// 404 if the product or the review doesn't exist.
+// 500 if something went wrong.
+func EditProductReview(c *gin.Context) {
+	var request dtos.ProductReviewRequest
+
+	review, ok := findOwnReview(c, "You can only edit your own reviews.")
+
+	if !ok {
+		return
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"message": "Incorrect format, please send in JSON: rating from 1 to 5 and text of 2000 characters at most."})
+		return
+	}
+
+	err := review.Update(currentActor(c), request.ToModel(review.ProductID, review.UserID))
+
+	if errors.Is(err, models.ErrStaleVersion) {
+		respond(c, http.StatusNotFound, gin.H{"message": "Review doesn't not exist."})
+		return
+	}
+
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return
+	}
+
+	respond(c, http.StatusOK, gin.H{"message": "Review updated successfuly."})
+}
+
+// DELETE request at /products/:id/reviews/:review_id
+// User must be authenticated and be the author of the review.
+// 200 if successful.
+// 400 for bad formatting.
+// 403 if user didn't write the review.
+// 404 if the product or the review doesn't exist.
+// 500 if something went wrong.
+func DeleteProductReview(c *gin.Context) {
+	review, ok := findOwnReview(c, "You can only delete your own reviews.")
+
+	if !ok {
+		return
+	}
+
+	err := review.Delete(currentActor(c))
+
+	if errors.Is(err, models.ErrStaleVersion) {
+		respond(c, http.StatusNotFound, gin.H{"message": "Review doesn't not exist."})
+		return
+	}
+
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return
+	}
+
+	respond(c, http.StatusOK, gin.H{"message": "Review deleted successfuly."})
+}
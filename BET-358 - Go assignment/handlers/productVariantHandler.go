@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"rabietf.me/go-assignment/dtos"
+	"rabietf.me/go-assignment/models"
+)
+
+const (
+	// Maximum number of options of a product, like size and color.
+	maxVariantOptions = 5
+	// Maximum length of the name and the value of an option.
+	maxOptionLength = 64
+)
+
+// Helper function that returns the sorted option names of a variant.
+func optionNames(options map[string]string) []string {
+	names := []string{}
+
+	for name := range options {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// Helper function that trims the options of variant, and checks them against the other variants of the product:
+// all the variants of a product must have the same options.
+// Returns "" if the options are valid.
+// Returns the message to answer with otherwise.
+func checkVariantOptions(variant *models.ProductVariant, siblings []models.ProductVariant) string {
+	if len(variant.Options) > maxVariantOptions {
+		return fmt.Sprintf("A product can't have more than %d options.", maxVariantOptions)
+	}
+
+	options := map[string]string{}
+
+	for name, value := range variant.Options {
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+
+		if name == "" || value == "" || utf8.RuneCountInString(name) > maxOptionLength || utf8.RuneCountInString(value) > maxOptionLength {
+			return fmt.Sprintf("Option names and values can't be empty nor longer than %d characters.", maxOptionLength)
+		}
+
+		// Like "size" and " size", one would be lost.
+		if _, ok := options[name]; ok {
+			return fmt.Sprintf("The option %s is given twice.", name)
+		}
+
+		options[name] = value
+	}
+
+	variant.Options = options
+
+	for _, sibling := range siblings {
+		if sibling.ID == variant.ID {
+			continue
+		}
+
+		expected := optionNames(sibling.Options)
+
+		if strings.Join(optionNames(options), ",") != strings.Join(expected, ",") {
+			return fmt.Sprintf("All the variants of this product must have these options: %s.", strings.Join(expected, ", "))
+		}
+
+		break
+	}
+
+	return ""
+}
+
+// Messages of the conflicts on the unique fields of the variants.
+var variantConflicts = map[string]string{
+	"sku":     "Another variant of this shop already has this SKU.",
+	"options": "Another variant of this product already has these options.",
+}
+
+// Helper function that finds the variant of the :variant_id parameter among the variants of product.
+// Returns (variant, true) if it exists.
+// Returns (ProductVariant{}, false) after answering 400, 404 or 500 otherwise.
+func findProductVariant(c *gin.Context, productID int64) (models.ProductVariant, bool) {
+	var variant models.ProductVariant
+
+	id, err := strconv.ParseInt(c.Param("variant_id"), 10, 64)
+
+	if err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"message": "Please enter a correct variant ID."})
+		return models.ProductVariant{}, false
+	}
+
+	ok, err := variant.FindByIdAndProduct(id, productID)
+
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return models.ProductVariant{}, false
+	}
+
+	if !ok {
+		respond(c, http.StatusNotFound, gin.H{"message": "Variant doesn't not exist."})
+		return models.ProductVariant{}, false
+	}
+
+	return variant, true
+}
+
+// POST request at /products/:id/variants, adds a variant to the product.
+// User must be authenticated, or use an API key of the shop with the products:write scope, and own the shop of the product.
+// 201 if successful.
+// 400 for bad formatting, or if the options differ from the ones of the other variants.
+// 403 if user isn't owner of the shop where the product belongs.
+// 404 if product doesn't exist.
+// 409 if another variant of the shop has the SKU, or another variant of the product has the options.
+// 500 if something went wrong.
+func CreateProductVariant(c *gin.Context) {
+	var request dtos.ProductVariantRequest
+	var variant models.ProductVariant
+
+	product, ok := findOwnedProduct(c, "User doesn't have permission to add variants to this product.")
+
+	if !ok {
+		return
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"message": "Incorrect format, please send in JSON: sku, options as an object of names and values, price_cents and stock."})
+		return
+	}
+
+	newVariant := request.ToModel(product)
+
+	siblings, err := variant.FindAllByProduct(product.ID)
+
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return
+	}
+
+	if message := checkVariantOptions(&newVariant, siblings); message != "" {
+		respond(c, http.StatusBadRequest, gin.H{"message": message})
+		return
+	}
+
+	id, err := newVariant.Save(currentActor(c))
+
+	if respondConflict(c, err, variantConflicts) {
+		return
+	}
+
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return
+	}
+
+	respond(c, http.StatusCreated, gin.H{"variant_id": id, "message": "You created a new variant!"})
+}
+
+// GET request at /products/:id/variants
+// 200 and the variants of the product if successful, an empty list if there are none.
+// 400 for bad formatting.
+// 404 if product doesn't exist.
+// 500 if something went wrong.
+func GetProductVariants(c *gin.Context) {
+	var product models.Product
+	var variant models.ProductVariant
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+
+	if err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"message": "Please enter a correct ID."})
+		return
+	}
+
+	ok, err := product.FindById(id)
+
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return
+	}
+
+	if !ok {
+		respond(c, http.StatusNotFound, gin.H{"message": "Product doesn't not exist."})
+		return
+	}
+
+	variants, err := variant.FindAllByProduct(product.ID)
+
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return
+	}
+
+	respond(c, http.StatusOK, dtos.NewProductVariantResponses(variants))
+}
+
+// GET request at /products/:id/variants/:variant_id
+// 200 and the variant if successful.
+// 400 for bad formatting.
+// 404 if the variant doesn't exist.
+// 500 if something went wrong.
+func GetProductVariant(c *gin.Context) {
+	productID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+
+	if err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"message": "Please enter a correct ID."})
+		return
+	}
+
+	variant, ok := findProductVariant(c, productID)
+
+	if !ok {
+		return
+	}
+
+	respond(c, http.StatusOK, dtos.NewProductVariantResponse(variant))
+}
+
+// PUT request at /products/:id/variants/:variant_id, replaces the SKU, options, price and stock of the variant.
+// User must be authenticated, or use an API key of the shop with the products:write scope, and own the shop of the product.
+// 200 if successful.
+// 400 for bad formatting, or if the options differ from the ones of the other variants.
+// 403 if user isn't owner of the shop where the product belongs.
+// 404 if the product or the variant doesn't exist.
+// 409 if another variant of the shop has the SKU, or another variant of the product has the options.
+// 500 if something went wrong.
+func EditProductVariant(c *gin.Context) {
+	var request dtos.ProductVariantRequest
+
+	product, ok := findOwnedProduct(c, "User doesn't have permission to update variants of this product.")
+
+	if !ok {
+		return
+	}
+
+	variant, ok := findProductVariant(c, product.ID)
+
+	if !ok {
+		return
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"message": "Incorrect format, please send in JSON: sku, options as an object of names and values, price_cents and stock."})
+		return
+	}
+
+	newVariant := request.ToModel(product)
+	newVariant.ID = variant.ID
+
+	siblings, err := variant.FindAllByProduct(product.ID)
+
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return
+	}
+
+	if message := checkVariantOptions(&newVariant, siblings); message != "" {
+		respond(c, http.StatusBadRequest, gin.H{"message": message})
+		return
+	}
+
+	err = variant.Update(currentActor(c), newVariant)
+
+	if respondConflict(c, err, variantConflicts) {
+		return
+	}
+
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return
+	}
+
+	respond(c, http.StatusOK, gin.H{"message": "Variant updated successfuly."})
+}
+
+// DELETE request at /products/:id/variants/:variant_id
+// User must be authenticated, or use an API key of the shop with the products:write scope, and own the shop of the product.
+// 200 if successful.
+// 400 for bad formatting.
+// 403 if user isn't owner of the shop where the product belongs.
+// 404 if the product or the variant doesn't exist.
+// 500 if something went wrong.
+func DeleteProductVariant(c *gin.Context) {
+	product, ok := findOwnedProduct(c, "User doesn't have permission to delete variants of this product.")
+
+	if !ok {
+		return
+	}
+
+	variant, ok := findProductVariant(c, product.ID)
+
+	if !ok {
+		return
+	}
+
+	if err := variant.Delete(currentActor(c)); err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return
+	}
+
+	respond(c, http.StatusOK, gin.H{"message": "Variant deleted successfuly."})
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"rabietf.me/go-assignment/models"
+)
+
+func TestCheckVariantOptions(t *testing.T) {
+	siblings := []models.ProductVariant{
+		{ID: 1, Options: map[string]string{"size": "S", "color": "red"}},
+		{ID: 2, Options: map[string]string{"size": "M", "color": "red"}},
+	}
+	tooMany := map[string]string{}
+	for _, name := range []string{"a", "b", "c", "d", "e", "f"} {
+		tooMany[name] = "x"
+	}
+
+	cases := []struct {
+		name     string
+		variant  models.ProductVariant
+		siblings []models.ProductVariant
+		// Options once trimmed, or the start of the error message.
+		want  map[string]string
+		error string
+	}{
+		{"trimmed", models.ProductVariant{Options: map[string]string{" size ": " L\t", "color": "blue "}}, siblings, map[string]string{"size": "L", "color": "blue"}, ""},
+		{"first variant", models.ProductVariant{Options: map[string]string{"fit": "slim"}}, nil, map[string]string{"fit": "slim"}, ""},
+		{"no options", models.ProductVariant{Options: map[string]string{}}, nil, map[string]string{}, ""},
+		{"5 options", models.ProductVariant{Options: map[string]string{"a": "x", "b": "x", "c": "x", "d": "x", "e": "x"}}, nil, map[string]string{"a": "x", "b": "x", "c": "x", "d": "x", "e": "x"}, ""},
+		{"6 options", models.ProductVariant{Options: tooMany}, nil, nil, "A product can't have more than 5 options."},
+		{"64 characters", models.ProductVariant{Options: map[string]string{strings.Repeat("é", 64): strings.Repeat("é", 64)}}, nil, map[string]string{strings.Repeat("é", 64): strings.Repeat("é", 64)}, ""},
+		{"long name", models.ProductVariant{Options: map[string]string{strings.Repeat("n", 65): "x"}}, nil, nil, "Option names and values can't be empty"},
+		{"long value", models.ProductVariant{Options: map[string]string{"size": strings.Repeat("v", 65)}}, nil, nil, "Option names and values can't be empty"},
+		{"blank name", models.ProductVariant{Options: map[string]string{" ": "x"}}, nil, nil, "Option names and values can't be empty"},
+		{"blank value", models.ProductVariant{Options: map[string]string{"size": "\t"}}, nil, nil, "Option names and values can't be empty"},
+		{"same name once trimmed", models.ProductVariant{Options: map[string]string{"size": "S", " size": "M"}}, nil, nil, "The option size is given twice."},
+		{"missing option", models.ProductVariant{Options: map[string]string{"size": "L"}}, siblings, nil, "All the variants of this product must have these options: color, size."},
+		{"other option", models.ProductVariant{Options: map[string]string{"size": "L", "colour": "red"}}, siblings, nil, "All the variants of this product must have these options: color, size."},
+		{"extra option", models.ProductVariant{Options: map[string]string{"size": "L", "color": "red", "fit": "slim"}}, siblings, nil, "All the variants of this product must have these options: color, size."},
+		// The variant being updated is among the siblings, its old options don't count.
+		{"update of the only variant", models.ProductVariant{ID: 1, Options: map[string]string{"fit": "slim"}}, siblings[:1], map[string]string{"fit": "slim"}, ""},
+		{"update checked against the others", models.ProductVariant{ID: 1, Options: map[string]string{"fit": "slim"}}, siblings, nil, "All the variants of this product must have these options: color, size."},
+		{"update keeping the options", models.ProductVariant{ID: 1, Options: map[string]string{"size": "XS", "color": "red"}}, siblings, map[string]string{"size": "XS", "color": "red"}, ""},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			variant := tc.variant
+			message := checkVariantOptions(&variant, tc.siblings)
+
+			if tc.error != "" {
+				if !strings.HasPrefix(message, tc.error) {
+					t.Fatalf("got message %q, want %q", message, tc.error)
+				}
+				return
+			}
+
+			if message != "" || !reflect.DeepEqual(variant.Options, tc.want) {
+				t.Fatalf("got %v (%q), want %v", variant.Options, message, tc.want)
+			}
+		})
+	}
+}
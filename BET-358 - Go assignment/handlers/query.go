@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Helper function that reads an optional positive integer query parameter, 0 if it is absent.
+func queryID(c *gin.Context, name string) (int64, bool) {
+	value := c.Query(name)
+
+	if value == "" {
+		return 0, true
+	}
+
+	id, err := strconv.ParseInt(value, 10, 64)
+
+	return id, err == nil && id > 0
+}
+
+// Helper function that reads the optional ?updated_since= parameter of the list endpoints, an RFC 3339 time.
+// Returns (since, true), since being zero if the parameter is absent.
+// Returns (time.Time{}, false) after answering 400 if it isn't a valid time.
+func queryUpdatedSince(c *gin.Context) (time.Time, bool) {
+	value := c.Query("updated_since")
+
+	if value == "" {
+		return time.Time{}, true
+	}
+
+	since, err := time.Parse(time.RFC3339, value)
+
+	if err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"message": "Incorrect format, updated_since must be an RFC 3339 time like 2023-04-01T12:00:00Z."})
+		return time.Time{}, false
+	}
+
+	return since, true
+}
+
+// Helper function that reads the optional ?limit= parameter of the paginated endpoints, between 1 and maxLimit.
+// Returns (limit, true), limit being defaultLimit if the parameter is absent.
+// Returns (0, false) after answering 400 if it is out of bounds.
+func queryLimit(c *gin.Context, defaultLimit, maxLimit int) (int, bool) {
+	value := c.Query("limit")
+
+	if value == "" {
+		return defaultLimit, true
+	}
+
+	limit, err := strconv.Atoi(value)
+
+	if err != nil || limit <= 0 || limit > maxLimit {
+		respond(c, http.StatusBadRequest, gin.H{"message": fmt.Sprintf("Incorrect format, limit must be between 1 and %d.", maxLimit)})
+		return 0, false
+	}
+
+	return limit, true
+}
+
+// Helper function that reads a number query parameter, between min and max included.
+// Returns (value, true), value being defaultValue if the parameter is absent and not required.
+// Returns (0, false) after answering 400 if it is missing while required, isn't a number or is out of bounds.
+func queryFloat(c *gin.Context, name string, required bool, defaultValue, min, max float64) (float64, bool) {
+	value := c.Query(name)
+
+	if value == "" && !required {
+		return defaultValue, true
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+
+	// NaN fails both comparisons.
+	if err != nil || !(number >= min && number <= max) {
+		respond(c, http.StatusBadRequest, gin.H{"message": fmt.Sprintf("Incorrect format, %s must be a number between %g and %g.", name, min, max)})
+		return 0, false
+	}
+
+	return number, true
+}
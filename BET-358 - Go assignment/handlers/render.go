@@ -0,0 +1,13 @@
+package handlers
+
+import "github.com/gin-gonic/gin"
+
+// Helper function that writes a JSON response, compact unless the client asked for ?pretty=1.
+func respond(c *gin.Context, code int, obj interface{}) {
+	if pretty := c.Query("pretty"); pretty == "1" || pretty == "true" {
+		c.IndentedJSON(code, obj)
+		return
+	}
+
+	c.JSON(code, obj)
+}
@@ -1,206 +1,576 @@
 package handlers
 
 import (
-	"database/sql"
+	"errors"
+	"log"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"rabietf.me/go-assignment/dtos"
+	"rabietf.me/go-assignment/middlewares"
 	"rabietf.me/go-assignment/models"
+	"rabietf.me/go-assignment/services"
 )
 
+const (
+	defaultProductsLimit = 50
+	maxProductsLimit     = 200
+)
+
+const (
+	defaultNearbyRadiusKm = 10
+	maxNearbyRadiusKm     = 500
+	defaultNearbyLimit    = 50
+	maxNearbyLimit        = 200
+)
+
+// Slugs that are paths under /shops, a shop with one of them couldn't be reached by its slug.
+var reservedShopSlugs = map[string]bool{"nearby": true}
+
+// Number of suffixes tried when the slug derived from the name of a new shop is taken.
+const maxSlugAttempts = 10
+
+// Messages of the conflicts on the unique fields of the shops.
+var shopConflicts = map[string]string{
+	"slug": "Another shop already has this slug.",
+	"name": "Another shop with this name is already at this address.",
+}
+
+const slugFormatMessage = "Slugs are made of lowercase letters and digits separated by dashes, can't be only digits, can't be nearby, and are at most 64 characters long."
+
+// Helper function that checks the slug given for a shop, see slugFormatMessage.
+func validShopSlug(slug string) bool {
+	return models.ValidSlug(slug) && !reservedShopSlugs[slug]
+}
+
+// Helper function that gives newShop a location when the request didn't: the one of current (the shop being updated, or nil)
+// if its address didn't change, else the one of its address found by the geocoder, if any.
+// Shops whose address can't be located, or when the geocoder fails, are saved without location.
+func locateShop(c *gin.Context, newShop *models.Shop, current *models.Shop) {
+	if newShop.Location != nil {
+		return
+	}
+
+	if current != nil && current.Location != nil && current.Address == newShop.Address {
+		newShop.Location = current.Location
+		return
+	}
+
+	if services.Geocoding == nil {
+		return
+	}
+
+	point, err := services.Geocoding.Geocode(c.Request.Context(), newShop.Address)
+
+	if err != nil {
+		if !errors.Is(err, services.ErrAddressNotFound) {
+			log.Println("geocoder:", err)
+		}
+		return
+	}
+
+	newShop.Location = &point
+}
+
+// Helper function that finds the shop of the :id parameter, which is either its ID or its slug.
+// Returns (shop, true) if it exists.
+// Returns (Shop{}, false) after answering 404 or 500 otherwise.
+func findShop(c *gin.Context) (models.Shop, bool) {
+	var shop models.Shop
+	var ok bool
+	var err error
+
+	handle := c.Param("id")
+
+	if id, parseErr := strconv.ParseInt(handle, 10, 64); parseErr == nil {
+		ok, err = shop.FindById(id)
+	} else if models.ValidSlug(handle) {
+		ok, err = shop.FindBySlug(handle)
+	}
+
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return models.Shop{}, false
+	}
+
+	if !ok {
+		respond(c, http.StatusNotFound, gin.H{"message": "Shop doesn't not exist."})
+		return models.Shop{}, false
+	}
+
+	return shop, true
+}
+
+// Helper function that saves newShop, with a slug derived from its name if it has none.
+// A derived slug that is taken gets a numbered suffix, up to maxSlugAttempts times.
+// Returns the same as Shop.Save.
+func saveShop(actor models.Actor, newShop models.Shop) (int64, error) {
+	derived := newShop.Slug == ""
+
+	if derived {
+		newShop.Slug = models.Slugify(newShop.Name, "shop")
+
+		if reservedShopSlugs[newShop.Slug] {
+			newShop.Slug += "-shop"
+		}
+	}
+
+	base := newShop.Slug
+
+	for attempt := 2; ; attempt++ {
+		id, err := newShop.Save(actor)
+
+		var duplicate models.DuplicateError
+
+		if !derived || attempt > maxSlugAttempts || !errors.As(err, &duplicate) || duplicate.Field != "slug" {
+			return id, err
+		}
+
+		suffix := "-" + strconv.Itoa(attempt)
+		newShop.Slug = models.TruncateSlug(base, models.MaxSlugLength-len(suffix)) + suffix
+	}
+}
+
 // POST request at /shops, creates a new shop linked to the authenticated user.
+// The slug is derived from the name when it isn't given, the location is found from the address when latitude and longitude aren't.
 // USER MUST BE AUTHENTICATED TO PERFORM THIS REQUEST.
 // 201 if successful.
 // 500 if internal error.
 // 400 if incorrect format.
+// 409 if another shop has the slug, or the same name at the same address.
 func CreateShop(c *gin.Context) {
-	var newShop models.Shop
+	var request dtos.ShopRequest
 
-	if err := c.BindJSON(&newShop); err != nil {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Incorrect format, please send in JSON: name and address"})
+	if err := c.BindJSON(&request); err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"message": "Incorrect format, please send in JSON: name, address and optionally slug, latitude and longitude"})
 		return
 	}
 
-	userID, ok := c.Get("userID")
+	if (request.Latitude == nil) != (request.Longitude == nil) {
+		respond(c, http.StatusBadRequest, gin.H{"message": "Incorrect format, latitude and longitude must be given together."})
+		return
+	}
+
+	newShop := request.ToModel()
+
+	if newShop.Slug != "" && !validShopSlug(newShop.Slug) {
+		respond(c, http.StatusBadRequest, gin.H{"message": slugFormatMessage})
+		return
+	}
+
+	principal, ok := middlewares.CurrentPrincipal(c)
 
 	if !ok {
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
 		return
 	}
 
-	newShop.OwnerID = int64(userID.(float64)) // Had to convert it to float and then to int cause otherwise it'd crash
+	newShop.OwnerID = principal.UserID
+
+	locateShop(c, &newShop, nil)
+
+	id, err := saveShop(currentActor(c), newShop)
 
-	id, err := newShop.Save()
+	if respondConflict(c, err, shopConflicts) {
+		return
+	}
 
 	if err != nil {
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
 		return
 	}
 
-	c.IndentedJSON(http.StatusCreated, gin.H{"shopId": id, "message": "You created a shop!"})
+	respond(c, http.StatusCreated, gin.H{"shop_id": id, "message": "You created a shop!"})
+}
+
+// Helper function that keeps the shops with opening hours that are open at the given instant, or closed if open is false.
+// Shops without opening hours are neither.
+func filterOpenShops(shops []models.Shop, at time.Time, open bool) []models.Shop {
+	filtered := []models.Shop{}
+
+	for _, shop := range shops {
+		if shop.Hours != nil && shop.Hours.OpenAt(at) == open {
+			filtered = append(filtered, shop)
+		}
+	}
+
+	return filtered
 }
 
-// GET request at /shops,
-// 200 and all the shops if successful.
-// 404 if there are no shops in database.
+// GET request at /shops, ?updated_since= only returns the shops updated since that time, least recently updated first.
+// ?owner= only returns the shops of an owner, by ascending ID: a user ID, or me for the authenticated user.
+// ?open_now=true only returns the shops open at the time of the request, false the ones with opening hours that are closed.
+// User must be authenticated for ?owner=me.
+// 200 and the shops if successful, an empty list if there are none.
+// 400 if updated_since isn't an RFC 3339 time, owner isn't me nor an ID, both are given, or open_now isn't true nor false.
+// 401 if owner is me and user isn't authenticated.
 // 500 if internal error.
 func GetShops(c *gin.Context) {
+	updatedSince, ok := queryUpdatedSince(c)
+
+	if !ok {
+		return
+	}
+
+	openNow := c.Query("open_now")
+
+	if openNow != "" && openNow != "true" && openNow != "false" {
+		respond(c, http.StatusBadRequest, gin.H{"message": "Incorrect format, open_now must be true or false."})
+		return
+	}
+
 	var shop models.Shop
+	var shops []models.Shop
+	var err error
+
+	switch owner := c.Query("owner"); {
+	case owner == "":
+		shops, err = shop.FindAll(updatedSince)
+	case !updatedSince.IsZero():
+		respond(c, http.StatusBadRequest, gin.H{"message": "Incorrect format, owner and updated_since can't be combined."})
+		return
+	case owner == "me":
+		principal, ok := middlewares.CurrentPrincipal(c)
 
-	shops, err := shop.FindAll()
+		if !ok {
+			respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+			return
+		}
 
-	if err != nil {
-		if err == sql.ErrNoRows {
-			c.IndentedJSON(http.StatusNotFound, gin.H{"message": "No shop found in database."})
+		shops, err = shop.FindAllByOwner(principal.UserID)
+	default:
+		ownerID, ok := queryID(c, "owner")
+
+		if !ok {
+			respond(c, http.StatusBadRequest, gin.H{"message": "Incorrect format, owner must be me or a user ID."})
 			return
 		}
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+
+		shops, err = shop.FindAllByOwner(ownerID)
+	}
+
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
 		return
 	}
 
-	c.IndentedJSON(http.StatusOK, shops)
+	// The filter and open_now must agree, so they use the same instant.
+	now := time.Now()
+
+	if openNow != "" {
+		shops = filterOpenShops(shops, now, openNow == "true")
+	}
+
+	respond(c, http.StatusOK, dtos.NewShopResponses(shops, now))
 	return
 }
 
-// GET request at /shops/:id,
-// 200 and the requested shop if successful.
-// 404 if the requested shop doesn't exist in database.
+// GET request at /shops/nearby, lists the located shops within ?radius_km= (10 by default, 500 at most) of ?lat= and ?lng=, nearest first,
+// with their distance. ?limit= shops are returned (50 by default, 200 at most).
+// 200 and the shops if successful, an empty list if there are none.
+// 400 if a parameter is missing or invalid.
 // 500 if internal error.
-func GetShopById(c *gin.Context) {
-	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+func GetNearbyShops(c *gin.Context) {
+	var shop models.Shop
+
+	latitude, ok := queryFloat(c, "lat", true, 0, -90, 90)
+
+	if !ok {
+		return
+	}
+
+	longitude, ok := queryFloat(c, "lng", true, 0, -180, 180)
+
+	if !ok {
+		return
+	}
+
+	radiusKm, ok := queryFloat(c, "radius_km", false, defaultNearbyRadiusKm, 0, maxNearbyRadiusKm)
+
+	if !ok {
+		return
+	}
+
+	limit, ok := queryLimit(c, defaultNearbyLimit, maxNearbyLimit)
+
+	if !ok {
+		return
+	}
+
+	shops, err := shop.FindNearby(models.GeoPoint{Latitude: latitude, Longitude: longitude}, radiusKm, limit)
 
 	if err != nil {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Incorrect format, please enter a correct ID."})
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
 		return
 	}
 
+	respond(c, http.StatusOK, dtos.NewNearbyShopResponses(shops, time.Now()))
+}
+
+// Helper function that tells whether the request asks for the shops of the authenticated user, GET /shops only requires authentication then.
+func WantsOwnShops(c *gin.Context) bool {
+	return c.Query("owner") == "me"
+}
+
+// GET request at /users/:id/shops, lists the shops of a user by ascending ID.
+// 200 and the shops if successful, an empty list if there are none.
+// 400 for bad formatting.
+// 404 if the user doesn't exist.
+// 500 if internal error.
+func GetUserShops(c *gin.Context) {
+	var user models.User
 	var shop models.Shop
 
-	ok, err := shop.FindById(id)
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+
+	if err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"message": "Incorrect format, please enter a correct ID."})
+		return
+	}
+
+	ok, err := user.FindById(id)
+
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return
+	}
+
+	if !ok {
+		respond(c, http.StatusNotFound, gin.H{"message": "User doesn't not exist."})
+		return
+	}
+
+	shops, err := shop.FindAllByOwner(user.ID)
 
 	if err != nil {
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return
+	}
+
+	respond(c, http.StatusOK, dtos.NewShopResponses(shops, time.Now()))
+}
+
+// GET request at /shops/:id/products, :id is the ID or the slug of the shop, lists a page of its products by ascending ID.
+// Can be filtered with ?category= (name or slug, the products of its subcategories included) and ?q= (text contained in the name),
+// ?limit= products are returned (50 by default, 200 at most), ?after_id= gets the products after the given one.
+// 200 and the products if successful, an empty list if there are none.
+// 400 if a parameter is invalid.
+// 404 if the shop doesn't exist.
+// 500 if internal error.
+func GetShopProducts(c *gin.Context) {
+	var product models.Product
+
+	afterID, ok := queryID(c, "after_id")
+
+	if !ok {
+		respond(c, http.StatusBadRequest, gin.H{"message": "Incorrect format, after_id must be an ID."})
 		return
 	}
 
+	limit, ok := queryLimit(c, defaultProductsLimit, maxProductsLimit)
+
+	if !ok {
+		return
+	}
+
+	filter := models.ProductFilter{Query: c.Query("q"), AfterID: afterID, Limit: limit}
+
+	if category := c.Query("category"); category != "" {
+		var dbCategory models.Category
+
+		dbCategories, err := dbCategory.FindAll(time.Time{})
+
+		if err != nil {
+			respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+			return
+		}
+
+		found, ok := findCategory(dbCategories, category)
+
+		if !ok {
+			respond(c, http.StatusBadRequest, gin.H{"message": "This category is not a correct category, please check GET /categories to know the correct categories."})
+			return
+		}
+
+		for _, v := range models.CategoryWithDescendants(dbCategories, found.ID) {
+			filter.Categories = append(filter.Categories, v.Name)
+		}
+	}
+
+	shop, ok := findShop(c)
+
 	if !ok {
-		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "Shop doesn't not exist."})
 		return
 	}
 
-	c.IndentedJSON(http.StatusOK, shop)
+	filter.ShopID = shop.ID
+
+	products, err := product.FindAllByShop(filter)
+
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return
+	}
+
+	if err := models.LoadProductImages(products); err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return
+	}
+
+	respond(c, http.StatusOK, dtos.NewProductResponses(products))
+}
+
+// GET request at /shops/:id, :id is the ID or the slug of the shop.
+// 200 and the requested shop with its ETag if successful, a weak one if the shop has opening hours: open_now changes without the version.
+// 304 if If-None-Match holds the current ETag, unless the shop has opening hours.
+// 404 if the requested shop doesn't exist in database.
+// 500 if internal error.
+func GetShopById(c *gin.Context) {
+	shop, ok := findShop(c)
+
+	if !ok {
+		return
+	}
+
+	// The version is still told, it is needed in If-Match to edit the shop.
+	if shop.Hours != nil {
+		c.Header("ETag", weakETag(shop.Version))
+	} else if notModified(c, shop.Version) {
+		return
+	}
+
+	respond(c, http.StatusOK, dtos.NewShopResponse(shop, time.Now()))
 	return
 }
 
-// PUT request at /shops/:id
-// 200 if successful.
+// PUT request at /shops/:id, :id is the ID or the slug of the shop, If-Match must hold the ETag of the shop.
+// The slug is kept when it isn't given, the location too if the address didn't change, else it is found from the address.
+// 200 and the new ETag if successful.
 // 400 if bad formatting.
 // 403 if user isn't owner of this shop.
 // 404 if shop doesn't exist.
+// 409 if another shop has the slug, or the same name at the same address.
+// 412 if the shop was modified since the client read it.
+// 428 if If-Match is missing.
 // 500 if something went wrong.
 func EditShop(c *gin.Context) {
-	var shop models.Shop
-	var newShop models.Shop
-
-	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	var request dtos.ShopRequest
 
-	if err != nil {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Incorrect format, please enter a correct ID."})
+	if err := c.BindJSON(&request); err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"message": "Incorrect format, please send in JSON: name, address and optionally slug, latitude and longitude"})
 		return
 	}
 
-	if err := c.BindJSON(&newShop); err != nil {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Incorrect format, please send in JSON: name and address"})
+	if (request.Latitude == nil) != (request.Longitude == nil) {
+		respond(c, http.StatusBadRequest, gin.H{"message": "Incorrect format, latitude and longitude must be given together."})
 		return
 	}
 
-	ctxID, ok := c.Get("userID")
+	newShop := request.ToModel()
 
-	userID := int64(ctxID.(float64))
-
-	if !ok {
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+	if newShop.Slug != "" && !validShopSlug(newShop.Slug) {
+		respond(c, http.StatusBadRequest, gin.H{"message": slugFormatMessage})
 		return
 	}
 
-	ok, err = shop.FindById(id)
+	principal, ok := middlewares.CurrentPrincipal(c)
 
-	if err != nil {
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+	if !ok {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
 		return
 	}
 
+	userID := principal.UserID
+
+	shop, ok := findShop(c)
+
 	if !ok {
-		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "Shop doesn't not exist."})
 		return
 	}
 
 	if userID != shop.OwnerID {
-		c.IndentedJSON(http.StatusForbidden, gin.H{"message": "User doesn't have permission to perform an update on this store."})
+		respond(c, http.StatusForbidden, gin.H{"message": "User doesn't have permission to perform an update on this store."})
+		return
+	}
+
+	if newShop.Slug == "" {
+		newShop.Slug = shop.Slug
+	}
+
+	if !preconditionMet(c, shop.Version) {
 		return
 	}
 
-	err = shop.Update(newShop)
+	locateShop(c, &newShop, &shop)
+
+	err := shop.Update(currentActor(c), newShop)
+
+	if respondConflict(c, err, shopConflicts) {
+		return
+	}
+
+	if err == models.ErrStaleVersion {
+		respond(c, http.StatusPreconditionFailed, gin.H{"message": "This resource was modified since you read it, please get it again."})
+		return
+	}
 
 	if err != nil {
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
 		return
 	}
 
-	c.IndentedJSON(http.StatusOK, gin.H{"message": "Shop updated successfuly."})
+	c.Header("ETag", etag(shop.Version+1))
+	respond(c, http.StatusOK, gin.H{"message": "Shop updated successfuly."})
 	return
 
 }
 
-// DELETE request at /shops/:id
+// DELETE request at /shops/:id, :id is the ID or the slug of the shop, If-Match must hold the ETag of the shop.
 // 200 if successful.
 // 403 if user doesn't own this shop.
 // 404 if shop doesn't exist.
+// 412 if the shop was modified since the client read it.
+// 428 if If-Match is missing.
 // 500 if something went wrong
 func DeleteShop(c *gin.Context) {
-	var shop models.Shop
-
-	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	principal, ok := middlewares.CurrentPrincipal(c)
 
-	if err != nil {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Incorrect format, please enter a correct ID."})
+	if !ok {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
 		return
 	}
 
-	ctxID, ok := c.Get("userID")
+	userID := principal.UserID
 
-	userID := int64(ctxID.(float64))
+	shop, ok := findShop(c)
 
 	if !ok {
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
 		return
 	}
 
-	ok, err = shop.FindById(id)
-
-	if err != nil {
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+	if userID != shop.OwnerID {
+		respond(c, http.StatusForbidden, gin.H{"message": "User doesn't have permission to perform an delete this store."})
 		return
 	}
 
-	if !ok {
-		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "Shop doesn't not exist."})
+	if !preconditionMet(c, shop.Version) {
 		return
 	}
 
-	if userID != shop.OwnerID {
-		c.IndentedJSON(http.StatusForbidden, gin.H{"message": "User doesn't have permission to perform an delete this store."})
+	err := shop.Delete(currentActor(c))
+
+	if err == models.ErrStaleVersion {
+		respond(c, http.StatusPreconditionFailed, gin.H{"message": "This resource was modified since you read it, please get it again."})
 		return
 	}
 
-	err = shop.Delete()
-
 	if err != nil {
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
 		return
 	}
 
-	c.IndentedJSON(http.StatusOK, gin.H{"message": "Shop deleted successfuly."})
+	respond(c, http.StatusOK, gin.H{"message": "Shop deleted successfuly."})
 	return
 }
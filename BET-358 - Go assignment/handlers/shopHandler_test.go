@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	DB "rabietf.me/go-assignment/db"
+	"rabietf.me/go-assignment/models"
+	"rabietf.me/go-assignment/services"
+)
+
+func TestGetShopByIdNotModified(t *testing.T) {
+	hours := `{"time_zone":"Europe/Paris","weekly":[[],[],[],[],[],[],[]],"exceptions":{}}`
+
+	cases := []struct {
+		name  string
+		hours driver.Value
+		want  int
+		etag  string
+	}{
+		{"without opening hours", nil, http.StatusNotModified, `"3"`},
+		// open_now may have changed since the client got the version.
+		{"with opening hours", hours, http.StatusOK, `W/"3"`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			connection, mock, err := sqlmock.New()
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			previous := DB.Connection
+			DB.Connection = connection
+
+			t.Cleanup(func() {
+				DB.Connection = previous
+				connection.Close()
+			})
+
+			now := time.Now()
+			columns := []string{"id", "name", "slug", "address", "latitude", "longitude", "opening_hours", "owned_by", "version", "created_at", "updated_at"}
+			mock.ExpectQuery(regexp.QuoteMeta("FROM Shops WHERE id = ?")).WithArgs(int64(1)).
+				WillReturnRows(sqlmock.NewRows(columns).AddRow(int64(1), "Bakery", "bakery", "Paris", nil, nil, tc.hours, int64(7), int64(3), now, now))
+
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.GET("/shops/:id", GetShopById)
+
+			req := httptest.NewRequest(http.MethodGet, "/shops/1", nil)
+			req.Header.Set("If-None-Match", `"3"`)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tc.want {
+				t.Fatalf("got %d, want %d", w.Code, tc.want)
+			}
+
+			// The version is needed in If-Match to edit the shop either way.
+			if got := w.Header().Get("ETag"); got != tc.etag {
+				t.Fatalf("got ETag %q, want %q", got, tc.etag)
+			}
+		})
+	}
+}
+
+func TestLocateShop(t *testing.T) {
+	geocoder, err := services.NewFixtureGeocoder("../data/geocoder-fixture.json")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previous := services.Geocoding
+	services.Geocoding = geocoder
+	t.Cleanup(func() { services.Geocoding = previous })
+
+	rivoli := &models.GeoPoint{Latitude: 48.8559, Longitude: 2.3580}
+	given := &models.GeoPoint{Latitude: 48.85, Longitude: 2.35}
+
+	cases := []struct {
+		name    string
+		newShop models.Shop
+		current *models.Shop
+		want    *models.GeoPoint
+	}{
+		{"found by the geocoder", models.Shop{Address: "1 Rue de Rivoli,  75001 Paris"}, nil, rivoli},
+		{"unknown address", models.Shop{Address: "2 rue de Rivoli, 75001 Paris"}, nil, nil},
+		{"given by the request", models.Shop{Address: "1 rue de Rivoli, 75001 Paris", Location: given}, nil, given},
+		// Kept even if the geocoder would find another one, it may have been given by the owner.
+		{"same address as before", models.Shop{Address: "1 rue de Rivoli, 75001 Paris"}, &models.Shop{Address: "1 rue de Rivoli, 75001 Paris", Location: given}, given},
+		{"new address", models.Shop{Address: "1 rue de Rivoli, 75001 Paris"}, &models.Shop{Address: "12 place Bellecour, 69002 Lyon", Location: given}, rivoli},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPost, "/shops", nil)
+
+			locateShop(c, &tc.newShop, tc.current)
+
+			if got := tc.newShop.Location; (got == nil) != (tc.want == nil) || (got != nil && *got != *tc.want) {
+				t.Fatalf("got location %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestWeakETagNeverMatchesIfMatch(t *testing.T) {
+	cases := []struct {
+		header string
+		want   int
+	}{
+		{`"3"`, http.StatusOK},
+		{`W/"3"`, http.StatusPreconditionFailed},
+		{`W/"3", "3"`, http.StatusOK},
+	}
+
+	for _, tc := range cases {
+		gin.SetMode(gin.TestMode)
+		router := gin.New()
+		router.PUT("/shops/:id", func(c *gin.Context) {
+			if preconditionMet(c, 3) {
+				c.Status(http.StatusOK)
+			}
+		})
+
+		req := httptest.NewRequest(http.MethodPut, "/shops/1", nil)
+		req.Header.Set("If-Match", tc.header)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != tc.want {
+			t.Fatalf("If-Match %s: got %d, want %d", tc.header, w.Code, tc.want)
+		}
+	}
+}
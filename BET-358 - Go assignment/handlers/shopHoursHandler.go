@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"rabietf.me/go-assignment/dtos"
+	"rabietf.me/go-assignment/middlewares"
+	"rabietf.me/go-assignment/models"
+)
+
+// Helper function that reads a HH:MM local time, 24:00 being accepted when allowEndOfDay is set.
+// Returns (minutes since midnight, true) if valid.
+// Returns (0, false) otherwise.
+func parseClock(value string, allowEndOfDay bool) (int, bool) {
+	if len(value) != 5 || value[2] != ':' {
+		return 0, false
+	}
+
+	for _, i := range []int{0, 1, 3, 4} {
+		if value[i] < '0' || value[i] > '9' {
+			return 0, false
+		}
+	}
+
+	hours := int(value[0]-'0')*10 + int(value[1]-'0')
+	minutes := int(value[3]-'0')*10 + int(value[4]-'0')
+
+	if hours == 24 && minutes == 0 && allowEndOfDay {
+		return models.MinutesPerDay, true
+	}
+
+	if hours > 23 || minutes > 59 {
+		return 0, false
+	}
+
+	return hours*60 + minutes, true
+}
+
+// Helper function that reads an opening period of the request.
+// Returns (period, true) if valid.
+// Returns (OpeningPeriod{}, false) otherwise.
+func parseOpeningPeriod(period dtos.OpeningPeriod) (models.OpeningPeriod, bool) {
+	opens, opensOk := parseClock(period.Opens, false)
+	closes, closesOk := parseClock(period.Closes, true)
+
+	return models.OpeningPeriod{Opens: opens, Closes: closes}, opensOk && closesOk
+}
+
+// Helper function that sorts periods by opening time.
+func sortOpeningPeriods(periods []models.OpeningPeriod) {
+	sort.Slice(periods, func(i, j int) bool {
+		return periods[i].Opens < periods[j].Opens
+	})
+}
+
+// Helper function that checks the opening hours of the request and turns them into the model.
+// Returns (hours, "") if they are valid.
+// Returns (OpeningHours{}, message to answer with) otherwise.
+func parseOpeningHours(request dtos.OpeningHoursRequest) (models.OpeningHours, string) {
+	hours := models.OpeningHours{TimeZone: request.TimeZone, Exceptions: map[string][]models.OpeningPeriod{}}
+
+	if !models.ValidTimeZone(request.TimeZone) {
+		return models.OpeningHours{}, "Incorrect format, time_zone must be an IANA time zone like Europe/Paris."
+	}
+
+	for _, weekly := range request.Weekly {
+		day := -1
+
+		for i, name := range dtos.WeekdayNames {
+			if weekly.Day == name {
+				// time.Weekday starts on Sunday.
+				day = (i + 1) % 7
+			}
+		}
+
+		if day < 0 {
+			return models.OpeningHours{}, "Incorrect format, day must be monday, tuesday, wednesday, thursday, friday, saturday or sunday."
+		}
+
+		period, ok := parseOpeningPeriod(weekly.OpeningPeriod)
+
+		if !ok {
+			return models.OpeningHours{}, "Incorrect format, opens and closes must be HH:MM times, closes can be 24:00."
+		}
+
+		hours.Weekly[day] = append(hours.Weekly[day], period)
+	}
+
+	for day := range hours.Weekly {
+		sortOpeningPeriods(hours.Weekly[day])
+	}
+
+	for _, exception := range request.Exceptions {
+		date, err := time.Parse("2006-01-02", exception.Date)
+
+		if err != nil || date.Format("2006-01-02") != exception.Date {
+			return models.OpeningHours{}, "Incorrect format, date must be a YYYY-MM-DD date."
+		}
+
+		if _, ok := hours.Exceptions[exception.Date]; ok {
+			return models.OpeningHours{}, "Each date can only have one exception, with all its periods."
+		}
+
+		periods := []models.OpeningPeriod{}
+
+		for _, p := range exception.Periods {
+			period, ok := parseOpeningPeriod(p)
+
+			if !ok {
+				return models.OpeningHours{}, "Incorrect format, opens and closes must be HH:MM times, closes can be 24:00."
+			}
+
+			periods = append(periods, period)
+		}
+
+		sortOpeningPeriods(periods)
+		hours.Exceptions[exception.Date] = periods
+	}
+
+	return hours, ""
+}
+
+// Helper function that finds the shop of the :id parameter, and checks that the authenticated user owns it.
+// Returns (shop, true) if so.
+// Returns (Shop{}, false) after answering 403, 404 or 500 otherwise.
+func findOwnedShop(c *gin.Context, forbiddenMessage string) (models.Shop, bool) {
+	principal, ok := middlewares.CurrentPrincipal(c)
+
+	if !ok {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return models.Shop{}, false
+	}
+
+	shop, ok := findShop(c)
+
+	if !ok {
+		return models.Shop{}, false
+	}
+
+	if principal.UserID != shop.OwnerID {
+		respond(c, http.StatusForbidden, gin.H{"message": forbiddenMessage})
+		return models.Shop{}, false
+	}
+
+	return shop, true
+}
+
+// Helper function that replaces the opening hours of shop, nil removing them, and answers like PUT /shops/:id.
+func updateShopHours(c *gin.Context, shop models.Shop, hours *models.OpeningHours, message string) {
+	if !preconditionMet(c, shop.Version) {
+		return
+	}
+
+	err := shop.UpdateHours(currentActor(c), hours)
+
+	if err == models.ErrStaleVersion {
+		respond(c, http.StatusPreconditionFailed, gin.H{"message": "This resource was modified since you read it, please get it again."})
+		return
+	}
+
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return
+	}
+
+	c.Header("ETag", etag(shop.Version+1))
+	respond(c, http.StatusOK, gin.H{"message": message})
+}
+
+// GET request at /shops/:id/hours, :id is the ID or the slug of the shop.
+// 200 and the opening hours of the shop, with the ETag of the shop, if successful.
+// 304 if If-None-Match holds the current ETag.
+// 404 if the shop doesn't exist or has no opening hours.
+// 500 if internal error.
+func GetShopHours(c *gin.Context) {
+	shop, ok := findShop(c)
+
+	if !ok {
+		return
+	}
+
+	if shop.Hours == nil {
+		respond(c, http.StatusNotFound, gin.H{"message": "This shop has no opening hours."})
+		return
+	}
+
+	if notModified(c, shop.Version) {
+		return
+	}
+
+	respond(c, http.StatusOK, dtos.NewOpeningHoursResponse(*shop.Hours))
+}
+
+// PUT request at /shops/:id/hours, :id is the ID or the slug of the shop, replaces its opening hours.
+// If-Match must hold the ETag of the shop, which they are part of.
+// 200 and the new ETag if successful.
+// 400 if bad formatting.
+// 403 if user isn't owner of this shop.
+// 404 if shop doesn't exist.
+// 412 if the shop was modified since the client read it.
+// 428 if If-Match is missing.
+// 500 if something went wrong.
+func EditShopHours(c *gin.Context) {
+	var request dtos.OpeningHoursRequest
+
+	if err := c.BindJSON(&request); err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"message": "Incorrect format, please send in JSON: time_zone, weekly as a list of day, opens and closes, and exceptions as a list of date and periods."})
+		return
+	}
+
+	hours, message := parseOpeningHours(request)
+
+	if message != "" {
+		respond(c, http.StatusBadRequest, gin.H{"message": message})
+		return
+	}
+
+	shop, ok := findOwnedShop(c, "User doesn't have permission to change the opening hours of this store.")
+
+	if !ok {
+		return
+	}
+
+	updateShopHours(c, shop, &hours, "Opening hours updated successfuly.")
+}
+
+// DELETE request at /shops/:id/hours, :id is the ID or the slug of the shop, removes its opening hours: open_now becomes null.
+// If-Match must hold the ETag of the shop.
+// 200 and the new ETag if successful.
+// 403 if user isn't owner of this shop.
+// 404 if shop doesn't exist.
+// 412 if the shop was modified since the client read it.
+// 428 if If-Match is missing.
+// 500 if something went wrong.
+func DeleteShopHours(c *gin.Context) {
+	shop, ok := findOwnedShop(c, "User doesn't have permission to change the opening hours of this store.")
+
+	if !ok {
+		return
+	}
+
+	updateShopHours(c, shop, nil, "Opening hours deleted successfuly.")
+}
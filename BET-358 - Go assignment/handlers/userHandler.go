@@ -2,45 +2,43 @@ package handlers
 
 import (
 	"log"
+	"math"
 	"net/http"
 	"regexp"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"golang.org/x/crypto/bcrypt"
+	"rabietf.me/go-assignment/dtos"
+	"rabietf.me/go-assignment/middlewares"
 	"rabietf.me/go-assignment/models"
 	"rabietf.me/go-assignment/services"
 )
 
-type Login struct {
-	Email    string
-	Password string
-}
+// Same message for unknown emails and wrong passwords, so the login can't be used to find out who has an account.
+const invalidCredentialsMessage = "Invalid email or password."
+
+var (
+	loginGuard = services.NewLoginGuard(services.NewMemoryAttemptStore())
+
+	// Hash compared against when the email doesn't exist, so both cases take the same time.
+	dummyHash     string
+	dummyHashOnce sync.Once
+)
 
-// Util function to hash password before storing it, uses bcrypt.
+// Util function to hash password before storing it, uses the configured password hasher.
 // Returns "", error if something went wrong.
 // Returngs hashed password, nil if everything goes normally.
 func hashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
-
-	if err != nil {
-		log.Panic(err)
-		return "", err
-	}
-
-	return string(bytes), nil
+	return services.Password.Hash(password)
 }
 
 // Util function to verify that the password provided by user corresponds to the one in database.
 // Returns false, error if the password is not correct.
-// Returns true, nil if it matches.
-func verifyPassword(userPassword, providedPassword string) error {
-	err := bcrypt.CompareHashAndPassword([]byte(userPassword), []byte(providedPassword))
-
-	if err != nil {
-		return err
-	}
-
-	return nil
+// Returns needsRehash, nil if it matches, needsRehash being true if the stored hash uses outdated parameters.
+func verifyPassword(userPassword, providedPassword string) (bool, error) {
+	return services.Password.Verify(userPassword, providedPassword)
 }
 
 // Util function to validate email using Regular expressions.
@@ -55,89 +53,188 @@ func isEmailValid(email string) bool {
 // 500 if internal server during processing.
 // 400 if user doesn't respect correct format.
 func SignUp(c *gin.Context) {
-	var newUser models.User
+	var request dtos.SignUpRequest
 
-	if err := c.BindJSON(&newUser); err != nil {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Incorrect format, please send in JSON: name, email and password"})
+	if err := c.BindJSON(&request); err != nil {
+		respond(c, http.StatusBadRequest, gin.H{"message": "Incorrect format, please send in JSON: name, email and password"})
 		return
 	}
 
+	newUser := models.User{Name: request.Name, Email: request.Email, Password: request.Password}
+
 	if !isEmailValid(newUser.Email) {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Please enter a correct email."})
+		respond(c, http.StatusBadRequest, gin.H{"message": "Please enter a correct email."})
 		return
 	}
 
 	if len(newUser.Password) < 8 {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Password too short, please user a password longer than 8 characters."})
+		respond(c, http.StatusBadRequest, gin.H{"message": "Password too short, please user a password longer than 8 characters."})
 		return
 	}
 
 	userExits, err := newUser.Find(newUser.Email)
 	if err != nil {
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
 		return
 	}
 
 	if userExits {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "User already exists."})
+		respond(c, http.StatusBadRequest, gin.H{"message": "User already exists."})
 		return
 	}
 
 	hashedPassword, err := hashPassword(newUser.Password)
 
 	if err != nil {
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
 		return
 	}
 
 	newUser.Password = hashedPassword
 
-	id, err := newUser.Save()
+	id, err := newUser.Save(currentActor(c))
 
 	if err != nil {
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
 		return
 	}
 
-	c.IndentedJSON(http.StatusCreated, gin.H{"userId": id, "message": "You can now login!"})
+	respond(c, http.StatusCreated, gin.H{"user_id": id, "message": "You can now login!"})
 	return
 
 }
 
+// Helper function that records a failed login: counts it against the account and the IP, and keeps a trace of it in database.
+func registerFailedLogin(email, ip, reason string) {
+	if err := loginGuard.RegisterFailure(email, ip); err != nil {
+		log.Println("login guard:", err)
+	}
+
+	failedLogin := models.FailedLogin{Email: email, IP: ip, Reason: reason, AttemptedAt: time.Now().UTC()}
+
+	if _, err := failedLogin.Save(); err != nil {
+		log.Println("failed login audit:", err)
+	}
+
+	log.Printf("failed login: email=%q ip=%s reason=%s", email, ip, reason)
+}
+
 // POST request at /login, authentificates the user using JWT. takes email and password
-// 200 if successful.
+// 200 and the token (access_token, token_type, expires_in) if successful.
+// With "session": "cookie", the token is set in an HttpOnly cookie instead, and a CSRF token is returned and set in a cookie.
 // 400 if request body incorrect
-// 401 if wrong credentials.
+// 401 if wrong credentials, with the same message whether the email exists or not.
+// 429 if too many failed attempts were made for this account from this IP, for this account from IPs that never logged in to it,
+// or from this IP, Retry-After tells when to try again.
 func SignIn(c *gin.Context) {
 	var newUser models.User
-	var login Login
+	var login dtos.LoginRequest
 	if err := c.BindJSON(&login); err != nil {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Incorrect format, please send in JSON: email and password"})
+		respond(c, http.StatusBadRequest, gin.H{"message": "Incorrect format, please send in JSON: email and password"})
+		return
+	}
+
+	ip := c.ClientIP()
+
+	wait, err := loginGuard.Check(login.Email, ip)
+
+	if err != nil {
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		return
+	}
+
+	if wait > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		respond(c, http.StatusTooManyRequests, gin.H{"message": "Too many failed login attempts, please try again later."})
 		return
 	}
 
 	userExists, err := newUser.Find(login.Email)
 
 	if err != nil {
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
 		return
 	}
 
-	if !userExists {
-		c.IndentedJSON(http.StatusUnauthorized, gin.H{"message": "User doesn't not exist."})
+	// Accounts created through an OpenID Connect provider have no password and can't log in here.
+	if !userExists || newUser.Password == "" {
+		dummyHashOnce.Do(func() {
+			dummyHash, _ = hashPassword("not a real password")
+		})
+		verifyPassword(dummyHash, login.Password)
+
+		reason := "unknown_email"
+		if userExists {
+			reason = "no_password"
+		}
+
+		registerFailedLogin(login.Email, ip, reason)
+		respond(c, http.StatusUnauthorized, gin.H{"message": invalidCredentialsMessage})
 		return
 	}
 
-	err = verifyPassword(newUser.Password, login.Password)
+	needsRehash, err := verifyPassword(newUser.Password, login.Password)
+
+	if err != nil {
+		registerFailedLogin(login.Email, ip, "wrong_password")
+		respond(c, http.StatusUnauthorized, gin.H{"message": invalidCredentialsMessage})
+		return
+	}
+
+	if err := loginGuard.RegisterSuccess(login.Email, ip); err != nil {
+		log.Println("login guard:", err)
+	}
+
+	// The password is known at this point, so the hash can be upgraded to the current algorithm and parameters.
+	if needsRehash {
+		if hashedPassword, err := hashPassword(login.Password); err != nil {
+			log.Println("password rehash:", err)
+		} else if err := newUser.UpdatePassword(models.Actor{UserID: newUser.ID, RequestID: middlewares.CurrentRequestID(c)}, hashedPassword); err != nil {
+			log.Println("password rehash:", err)
+		}
+	}
+
+	respondWithToken(c, newUser, login.Session)
+}
+
+// Helper function that answers a successful login with a new token for user, in the body and the Authorization header.
+// If session is "cookie", the token is only set in the HttpOnly session cookie, so that scripts can't read it,
+// and the CSRF token of the session is returned in the body instead.
+func respondWithToken(c *gin.Context, user models.User, session string) {
+	tokenString, err := services.CreateToken(user)
 
 	if err != nil {
-		c.IndentedJSON(http.StatusUnauthorized, gin.H{"message": "Wrong password."})
+		log.Println("create token:", err)
+		respond(c, http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
 		return
 	}
 
-	tokenString, err := services.CreateToken(newUser)
+	response := dtos.TokenResponse{
+		Message:   "Successfuly connected! Welcome " + user.Name + "!",
+		ExpiresIn: int(services.TokenLifetime.Seconds()),
+	}
+
+	if session == "cookie" {
+		csrfToken := middlewares.NewCSRFToken(tokenString)
+
+		middlewares.SetSessionCookies(c, tokenString, csrfToken, services.TokenLifetime)
+		response.CSRFToken = csrfToken
+		respond(c, http.StatusOK, response)
+		return
+	}
+
+	response.AccessToken = tokenString
+	response.TokenType = "Bearer"
 
 	c.Header("Authorization", "Bearer "+tokenString)
-	c.IndentedJSON(http.StatusOK, gin.H{"message": "Successfuly connected! Welcome " + newUser.Name + "!"})
+	respond(c, http.StatusOK, response)
+}
 
+// POST request at /logout, removes the session cookies set by /login in cookie mode.
+// Requests with the session cookie must send its CSRF token, see VerifyCSRF.
+// 200 if successful.
+// 403 if the CSRF token is missing or invalid.
+func SignOut(c *gin.Context) {
+	middlewares.ClearSessionCookies(c)
+	respond(c, http.StatusOK, gin.H{"message": "Successfuly disconnected."})
 }
@@ -1,32 +1,52 @@
 package main
 
 import (
-	"github.com/gin-gonic/gin"
+	"log"
+
 	DB "rabietf.me/go-assignment/db"
-	"rabietf.me/go-assignment/handlers"
+	"rabietf.me/go-assignment/docs"
 	"rabietf.me/go-assignment/middlewares"
+	"rabietf.me/go-assignment/routes"
+	"rabietf.me/go-assignment/services"
 )
 
 func main() {
-	router := gin.Default()
 	DB.ConnectToDB()
 
-	router.POST("/users", handlers.SignUp)
-	router.POST("/login", handlers.SignIn)
+	if err := services.LoadPasswords(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := services.LoadKeys(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := services.LoadOIDC(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := services.LoadBlobStore(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := services.LoadGeocoder(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := services.LoadImageLimits(); err != nil {
+		log.Fatal(err)
+	}
 
-	router.POST("/shops", middlewares.VerifyAuth(), handlers.CreateShop)
-	router.GET("/shops", handlers.GetShops)
-	router.GET("/shops/:id", handlers.GetShopById)
-	router.PUT("/shops/:id", middlewares.VerifyAuth(), handlers.EditShop)
-	router.DELETE("/shops/:id", middlewares.VerifyAuth(), handlers.DeleteShop)
+	if err := middlewares.LoadCORS(); err != nil {
+		log.Fatal(err)
+	}
 
-	router.POST("/products", middlewares.VerifyAuth(), handlers.CreateProduct)
-	router.GET("/products", handlers.GetProducts)
-	router.GET("/products/:id", handlers.GetProductById)
-	router.PUT("/products/:id", middlewares.VerifyAuth(), handlers.EditProduct)
-	router.DELETE("/products/:id", middlewares.VerifyAuth(), handlers.DeleteProduct)
+	router := routes.Setup()
 
-	router.GET("/categories", handlers.GetCategories)
+	// The OpenAPI document must describe exactly the registered routes.
+	if err := docs.CheckRoutes(router.Routes()); err != nil {
+		log.Fatal(err)
+	}
 
 	router.Run("localhost:8080")
 }
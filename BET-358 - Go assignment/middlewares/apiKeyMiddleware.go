@@ -0,0 +1,62 @@
+package middlewares
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"rabietf.me/go-assignment/services"
+)
+
+const APIKeyHeader = "X-API-Key"
+
+// Middleware that authenticates machine clients with the API key sent in the X-API-Key header,
+// and falls back to VerifyAuth when there is none, so both resolve to the same principal.
+// Returns 401 if the API key is invalid or revoked.
+// Returns 500 if something went wrong.
+// Moves on to the next handler is the caller is authentified.
+func VerifyAPIKeyOrAuth() gin.HandlerFunc {
+	verifyAuth := VerifyAuth()
+
+	return func(c *gin.Context) {
+		key := c.GetHeader(APIKeyHeader)
+
+		if key == "" {
+			verifyAuth(c)
+			return
+		}
+
+		principal, err := services.AuthenticateAPIKey(key)
+
+		if err == services.ErrInvalidAPIKey {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Invalid or revoked API key."})
+			return
+		}
+
+		if err != nil {
+			log.Println("api key:", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "Please contact your administrator."})
+			return
+		}
+
+		c.Set(principalKey, principal)
+		c.Next()
+	}
+}
+
+// Middleware that checks that the authenticated principal was granted scope.
+// Must be placed after VerifyAuth or VerifyAPIKeyOrAuth.
+// Returns 403 if it wasn't.
+// Moves on to the next handler otherwise.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := CurrentPrincipal(c)
+
+		if !ok || !principal.HasScope(scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "This operation requires the " + scope + " scope."})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -1,58 +1,102 @@
 package middlewares
 
 import (
-	"fmt"
 	"net/http"
-	"os"
 	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
+	"rabietf.me/go-assignment/services"
 )
 
-var (
-	secretKey = []byte(os.Getenv("SECRET_TOKEN"))
-)
+// Key of the authenticated principal in the gin context.
+const principalKey = "principal"
+
+// Returns the principal stored by VerifyAuth.
+// Returns (principal, true) if the request is authenticated.
+// Returns (Principal{}, false) otherwise, for instance if the route isn't behind VerifyAuth.
+func CurrentPrincipal(c *gin.Context) (services.Principal, bool) {
+	value, ok := c.Get(principalKey)
+
+	if !ok {
+		return services.Principal{}, false
+	}
+
+	principal, ok := value.(services.Principal)
+
+	return principal, ok
+}
 
 // Middleware that checks if user is connected by validating his JWT token.
-// Returns 500 if something went wrong.
-// Returns 401 if user isn't authentified.
-// Moves on to the next handler is user is authentified.
+// The token is read from the Authorization header (Bearer), or from the access token cookie in cookie mode.
+// Returns 401 if user isn't authentified or if his token is invalid or expired.
+// Returns 403 if the token comes from a cookie and the CSRF header doesn't hold its CSRF token on an unsafe request.
+// Moves on to the next handler is user is authentified, with his principal available through CurrentPrincipal.
 func VerifyAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		prefix := "Bearer "
 		header := c.GetHeader("Authorization")
 
-		if header == "" {
-			c.IndentedJSON(http.StatusUnauthorized, gin.H{"message": "You are not authentified and therefore cannot perform this operation."})
-			return
-		}
+		var tokenString string
 
-		tokenString := strings.TrimPrefix(header, prefix)
+		if header != "" {
+			if !strings.HasPrefix(header, prefix) {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "You are not authentified and therefore cannot perform this operation."})
+				return
+			}
 
-		token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
-			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("Unexpected signing method: %v", t.Header["alg"])
+			tokenString = strings.TrimPrefix(header, prefix)
+		} else if cookie, err := c.Cookie(AccessTokenCookie); err == nil && cookie != "" {
+			if !checkCSRF(c) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "Missing or invalid CSRF token, please send the csrf_token cookie value in the " + CSRFHeader + " header."})
+				return
 			}
 
-			return secretKey, nil
-		})
+			tokenString = cookie
+		} else {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "You are not authentified and therefore cannot perform this operation."})
+			return
+		}
+
+		principal, err := services.ParseToken(tokenString)
 
 		if err != nil {
-			fmt.Println(err)
-			c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "Something went wrong, please contact your admin."})
-			c.Abort()
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "You are not authentified and therefore cannot perform this operation."})
 			return
 		}
 
-		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-			fmt.Println("claims: ", claims["userID"])
-			c.Set("userID", claims["userID"])
-			c.Next()
-		} else {
-			c.IndentedJSON(http.StatusUnauthorized, gin.H{"message": "You are not authentified and therefore cannot perform this operation."})
+		c.Set(principalKey, principal)
+		c.Next()
+	}
+}
+
+// Middleware that only lets principals with the given role through, must be placed after VerifyAuth.
+// Returns 403 if the principal doesn't have the role.
+// Moves on to the next handler otherwise.
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := CurrentPrincipal(c)
+
+		if !ok || !principal.HasRole(role) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "You don't have permission to perform this operation."})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// Middleware for public routes that only need authentication for some requests: runs VerifyAuth when condition holds.
+// Returns the same as VerifyAuth when condition holds.
+// Moves on to the next handler, without principal, otherwise.
+func VerifyAuthWhen(condition func(c *gin.Context) bool) gin.HandlerFunc {
+	verifyAuth := VerifyAuth()
+
+	return func(c *gin.Context) {
+		if condition(c) {
+			verifyAuth(c)
 			return
 		}
-		return
+
+		c.Next()
 	}
 }
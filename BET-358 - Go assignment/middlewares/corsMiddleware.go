@@ -0,0 +1,168 @@
+package middlewares
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Cross-origin requests allowed from browsers.
+type CORSConfig struct {
+	// Origins allowed to call the API, "*" allows any origin.
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+	// Response headers the browser lets the client read.
+	ExposedHeaders []string
+	// Lets the browser send cookies, needed for the cookie sessions.
+	AllowCredentials bool
+	// How long the browser can cache a preflight response.
+	MaxAge time.Duration
+}
+
+// Helper function that splits a comma separated environment variable, or returns def if it's not set.
+func envList(name string, def []string) []string {
+	value := os.Getenv(name)
+
+	if value == "" {
+		return def
+	}
+
+	var list []string
+
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return list
+}
+
+var ErrCORSWildcardCredentials = errors.New("CORS_ALLOWED_ORIGINS=* can't be combined with CORS_ALLOW_CREDENTIALS=true, list the allowed origins instead")
+
+// Checks that the configuration is safe: allowing credentials from any origin would let any site call the API with the session cookies.
+// Returns ErrCORSWildcardCredentials if credentials are allowed with "*".
+func (config CORSConfig) Validate() error {
+	if !config.AllowCredentials {
+		return nil
+	}
+
+	for _, allowed := range config.AllowedOrigins {
+		if allowed == "*" {
+			return ErrCORSWildcardCredentials
+		}
+	}
+
+	return nil
+}
+
+// Builds the CORS configuration from the environment: CORS_ALLOWED_ORIGINS (comma separated, none by default),
+// CORS_ALLOWED_METHODS, CORS_ALLOWED_HEADERS, CORS_ALLOW_CREDENTIALS (true or false) and CORS_MAX_AGE (in seconds, defaults to 600).
+// Returns an error if the configuration isn't valid, see Validate.
+func NewCORSConfigFromEnv() (CORSConfig, error) {
+	config := CORSConfig{
+		AllowedOrigins: envList("CORS_ALLOWED_ORIGINS", nil),
+		AllowedMethods: envList("CORS_ALLOWED_METHODS", []string{"GET", "POST", "PUT", "PATCH", "DELETE"}),
+		AllowedHeaders: envList("CORS_ALLOWED_HEADERS", []string{"Authorization", "Content-Type", "If-Match", "If-None-Match", APIKeyHeader, CSRFHeader, RequestIDHeader}),
+		ExposedHeaders: []string{"Authorization", "ETag", RequestIDHeader, "Retry-After", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Deprecation", "Sunset", "Link"},
+		MaxAge:         10 * time.Minute,
+	}
+
+	config.AllowCredentials = os.Getenv("CORS_ALLOW_CREDENTIALS") == "true"
+
+	if seconds, err := strconv.Atoi(os.Getenv("CORS_MAX_AGE")); err == nil && seconds >= 0 {
+		config.MaxAge = time.Duration(seconds) * time.Second
+	}
+
+	if err := config.Validate(); err != nil {
+		return CORSConfig{}, err
+	}
+
+	return config, nil
+}
+
+// CORS configuration used by the application, set by LoadCORS, no origin is allowed until then.
+var CORSSettings CORSConfig
+
+// Function that configures CORS from the environment, see NewCORSConfigFromEnv.
+// Returns an error if the configuration isn't valid.
+func LoadCORS() error {
+	config, err := NewCORSConfigFromEnv()
+
+	if err != nil {
+		return err
+	}
+
+	CORSSettings = config
+	return nil
+}
+
+func (config CORSConfig) allowsOrigin(origin string) bool {
+	for _, allowed := range config.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Middleware that answers CORS preflight requests and adds the CORS headers to the responses of allowed origins.
+// The origin is echoed back rather than "*", so credentials can be allowed.
+// Returns 204 for preflight requests from allowed origins, 403 for preflight requests from other origins.
+// Moves on to the next handler otherwise.
+func CORS(config CORSConfig) gin.HandlerFunc {
+	methods := strings.Join(config.AllowedMethods, ", ")
+	headers := strings.Join(config.AllowedHeaders, ", ")
+	exposed := strings.Join(config.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(config.MaxAge.Seconds()))
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+
+		if origin == "" {
+			c.Next()
+			return
+		}
+
+		c.Writer.Header().Add("Vary", "Origin")
+
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+
+		if !config.allowsOrigin(origin) {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+
+			c.Next()
+			return
+		}
+
+		c.Header("Access-Control-Allow-Origin", origin)
+
+		// Validate refuses this configuration, credentials are never allowed from any origin.
+		if config.AllowCredentials && config.Validate() == nil {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+
+		if preflight {
+			c.Writer.Header().Add("Vary", "Access-Control-Request-Method")
+			c.Writer.Header().Add("Vary", "Access-Control-Request-Headers")
+			c.Header("Access-Control-Allow-Methods", methods)
+			c.Header("Access-Control-Allow-Headers", headers)
+			c.Header("Access-Control-Max-Age", maxAge)
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		c.Header("Access-Control-Expose-Headers", exposed)
+		c.Next()
+	}
+}
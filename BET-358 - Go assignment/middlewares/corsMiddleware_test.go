@@ -0,0 +1,50 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNewCORSConfigFromEnvRejectsWildcardWithCredentials(t *testing.T) {
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://app.example, *")
+	t.Setenv("CORS_ALLOW_CREDENTIALS", "true")
+
+	if _, err := NewCORSConfigFromEnv(); err != ErrCORSWildcardCredentials {
+		t.Fatalf("got error %v, want %v", err, ErrCORSWildcardCredentials)
+	}
+
+	t.Setenv("CORS_ALLOW_CREDENTIALS", "false")
+
+	if _, err := NewCORSConfigFromEnv(); err != nil {
+		t.Fatalf("wildcard without credentials: %v", err)
+	}
+
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://app.example")
+	t.Setenv("CORS_ALLOW_CREDENTIALS", "true")
+
+	config, err := NewCORSConfigFromEnv()
+
+	if err != nil || !config.AllowCredentials {
+		t.Fatalf("listed origins with credentials: got %+v, %v", config, err)
+	}
+}
+
+func TestCORSNeverAllowsCredentialsFromAnyOrigin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(CORS(CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true}))
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Origin", "https://evil.example")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Fatal("credentials were allowed for any origin")
+	}
+}
@@ -0,0 +1,128 @@
+package middlewares
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Function returning the key a request is rate limited on.
+// Returns "" to let the request through without limiting it.
+type RateLimitKeyFunc func(c *gin.Context) string
+
+// Rate limits requests on the client IP.
+// X-Forwarded-For is only used for requests coming from a proxy of TRUSTED_PROXIES (see routes.Setup),
+// clients can't change their key by sending it themselves.
+func KeyByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// Rate limits requests on the authenticated user, falls back to the client IP if there is none.
+// Must be placed after VerifyAuth to see the user.
+func KeyByUserOrIP(c *gin.Context) string {
+	if principal, ok := CurrentPrincipal(c); ok {
+		return fmt.Sprintf("user:%d", principal.UserID)
+	}
+
+	return KeyByIP(c)
+}
+
+// Configuration of a token bucket: Burst requests can be made at once, and the bucket refills
+// at Rate requests per second.
+type RateLimitConfig struct {
+	Rate    float64
+	Burst   int
+	KeyFunc RateLimitKeyFunc
+}
+
+// Number of buckets above which the full ones are forgotten when a new one is needed.
+const maxRateLimitBuckets = 10000
+
+type bucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+type rateLimiter struct {
+	config  RateLimitConfig
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// Takes a token from the bucket of key.
+// Returns (true, remaining, reset) if the request is allowed.
+// Returns (false, 0, retryAfter) if the bucket is empty, retryAfter being the time until the next token.
+func (limiter *rateLimiter) take(key string, now time.Time) (bool, int, time.Duration) {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	burst := float64(limiter.config.Burst)
+
+	b, ok := limiter.buckets[key]
+
+	if !ok {
+		// Forget the buckets that had the time to fill up again, they are the same as new ones.
+		if len(limiter.buckets) > maxRateLimitBuckets {
+			full := time.Duration(burst / limiter.config.Rate * float64(time.Second))
+			for k, v := range limiter.buckets {
+				if now.Sub(v.lastSeen) > full {
+					delete(limiter.buckets, k)
+				}
+			}
+		}
+
+		b = &bucket{tokens: burst, lastSeen: now}
+		limiter.buckets[key] = b
+	}
+
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.lastSeen).Seconds()*limiter.config.Rate)
+	b.lastSeen = now
+
+	if b.tokens < 1 {
+		return false, 0, time.Duration((1 - b.tokens) / limiter.config.Rate * float64(time.Second))
+	}
+
+	b.tokens--
+
+	return true, int(b.tokens), time.Duration((burst - b.tokens) / limiter.config.Rate * float64(time.Second))
+}
+
+// Middleware that rate limits requests using a token bucket per key (see RateLimitConfig).
+// Sets the RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers on every response.
+// Returns 429 with a Retry-After header if the bucket of the request is empty.
+// Moves on to the next handler otherwise.
+func RateLimit(config RateLimitConfig) gin.HandlerFunc {
+	if config.KeyFunc == nil {
+		config.KeyFunc = KeyByIP
+	}
+
+	limiter := &rateLimiter{config: config, buckets: make(map[string]*bucket)}
+
+	return func(c *gin.Context) {
+		key := config.KeyFunc(c)
+
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		allowed, remaining, reset := limiter.take(key, time.Now())
+
+		c.Header("RateLimit-Limit", strconv.Itoa(config.Burst))
+		c.Header("RateLimit-Remaining", strconv.Itoa(remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(int(math.Ceil(reset.Seconds()))))
+
+		if !allowed {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(reset.Seconds()))))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"message": "Too many requests, please slow down."})
+			return
+		}
+
+		c.Next()
+	}
+}
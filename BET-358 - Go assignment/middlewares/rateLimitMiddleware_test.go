@@ -0,0 +1,132 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRateLimiterRefillsBucket(t *testing.T) {
+	limiter := &rateLimiter{config: RateLimitConfig{Rate: 2, Burst: 3}, buckets: make(map[string]*bucket)}
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	for want := 2; want >= 0; want-- {
+		if allowed, remaining, _ := limiter.take("ip:192.0.2.1", now); !allowed || remaining != want {
+			t.Fatalf("got (%v, %d), want (true, %d)", allowed, remaining, want)
+		}
+	}
+
+	allowed, _, retryAfter := limiter.take("ip:192.0.2.1", now)
+
+	if allowed || retryAfter != 500*time.Millisecond {
+		t.Fatalf("empty bucket: got (%v, %s), want (false, 500ms)", allowed, retryAfter)
+	}
+
+	// Half a token is back after 250ms, not enough for a request.
+	if allowed, _, _ := limiter.take("ip:192.0.2.1", now.Add(250*time.Millisecond)); allowed {
+		t.Fatal("allowed before a token was back")
+	}
+
+	if allowed, remaining, _ := limiter.take("ip:192.0.2.1", now.Add(500*time.Millisecond)); !allowed || remaining != 0 {
+		t.Fatalf("got (%v, %d), want (true, 0) once a token is back", allowed, remaining)
+	}
+
+	// The bucket never holds more than Burst tokens.
+	if allowed, remaining, reset := limiter.take("ip:192.0.2.1", now.Add(time.Hour)); !allowed || remaining != 2 || reset != 500*time.Millisecond {
+		t.Fatalf("got (%v, %d, %s), want (true, 2, 500ms) after a long wait", allowed, remaining, reset)
+	}
+
+	if allowed, remaining, _ := limiter.take("ip:198.51.100.3", now); !allowed || remaining != 2 {
+		t.Fatalf("other key: got (%v, %d), want (true, 2)", allowed, remaining)
+	}
+}
+
+func TestRateLimiterEvictsFullBuckets(t *testing.T) {
+	limiter := &rateLimiter{config: RateLimitConfig{Rate: 1, Burst: 10}, buckets: make(map[string]*bucket)}
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	for i := 0; i <= maxRateLimitBuckets; i++ {
+		limiter.take(fmt.Sprintf("old:%d", i), now)
+	}
+
+	// Still filling up 5s later.
+	limiter.take("recent", now.Add(5*time.Second))
+
+	// The old buckets had 11s to fill up again.
+	limiter.take("new", now.Add(11*time.Second))
+
+	if got := len(limiter.buckets); got != 2 {
+		t.Fatalf("got %d buckets, want 2", got)
+	}
+
+	if _, ok := limiter.buckets["recent"]; !ok {
+		t.Fatal("a bucket that wasn't full again was forgotten")
+	}
+}
+
+// Helper function that sends a GET request from 192.0.2.1 with the given X-Forwarded-For to router.
+func getFrom(router *gin.Engine, forwardedFor string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "192.0.2.1:4321"
+	req.Header.Set("X-Forwarded-For", forwardedFor)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.SetTrustedProxies(nil)
+	router.Use(RateLimit(RateLimitConfig{Rate: 0.5, Burst: 2}))
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	cases := []struct {
+		code       int
+		remaining  string
+		reset      string
+		retryAfter string
+	}{
+		{http.StatusOK, "1", "2", ""},
+		{http.StatusOK, "0", "4", ""},
+		{http.StatusTooManyRequests, "0", "2", "2"},
+	}
+
+	for i, tc := range cases {
+		// Changing X-Forwarded-For doesn't change the bucket when the connection isn't from a trusted proxy.
+		w := getFrom(router, fmt.Sprintf("203.0.113.%d", i))
+
+		if w.Code != tc.code {
+			t.Fatalf("request %d: got %d, want %d", i, w.Code, tc.code)
+		}
+
+		headers := map[string]string{"RateLimit-Limit": "2", "RateLimit-Remaining": tc.remaining, "RateLimit-Reset": tc.reset, "Retry-After": tc.retryAfter}
+
+		for name, want := range headers {
+			if got := w.Header().Get(name); got != want {
+				t.Fatalf("request %d: got %s %q, want %q", i, name, got, want)
+			}
+		}
+	}
+}
+
+func TestRateLimitSkipsEmptyKeys(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RateLimit(RateLimitConfig{Rate: 1, Burst: 1, KeyFunc: func(c *gin.Context) string { return "" }}))
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for i := 0; i < 3; i++ {
+		w := getFrom(router, "")
+
+		if w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "" {
+			t.Fatalf("request %d: got %d with RateLimit-Limit %q, want 200 without", i, w.Code, w.Header().Get("RateLimit-Limit"))
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package middlewares
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Header carrying the request ID, set on every response.
+const RequestIDHeader = "X-Request-ID"
+
+// Key of the request ID in the gin context.
+const requestIDKey = "request_id"
+
+// Request IDs sent by clients or proxies are kept if they look like one, so they can be followed across services.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// Returns the ID of the request set by RequestID, "" if the route isn't behind it.
+func CurrentRequestID(c *gin.Context) string {
+	return c.GetString(requestIDKey)
+}
+
+// Middleware that gives an ID to every request, recorded in the audit log along with the changes it made.
+// Keeps the X-Request-ID header of the request if it is valid, generates a random ID otherwise.
+// Sets the X-Request-ID header of the response, and moves on to the next handler.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+
+		if !validRequestID.MatchString(id) {
+			bytes := make([]byte, 16)
+			rand.Read(bytes)
+			id = hex.EncodeToString(bytes)
+		}
+
+		c.Set(requestIDKey, id)
+		c.Header(RequestIDHeader, id)
+
+		c.Next()
+	}
+}
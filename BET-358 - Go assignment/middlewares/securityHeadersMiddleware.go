@@ -0,0 +1,108 @@
+package middlewares
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// Policy of the API responses, which never load anything.
+	apiContentSecurityPolicy = "default-src 'none'; frame-ancestors 'none'"
+	// Policy of the HTML pages, which may load their own scripts, styles and images.
+	DefaultHTMLContentSecurityPolicy = "default-src 'self'; img-src 'self' data:; object-src 'none'; base-uri 'self'; form-action 'self'; frame-ancestors 'none'"
+)
+
+// Security headers added to every response.
+type SecurityHeadersConfig struct {
+	// Strict-Transport-Security max-age in seconds, 0 disables HSTS.
+	HSTSMaxAge int
+	// Content-Security-Policy of HTML responses, unless the handler sets its own.
+	HTMLContentSecurityPolicy string
+}
+
+// Builds the security headers configuration from the environment: HSTS_MAX_AGE (in seconds, defaults to one year, 0 disables it)
+// and HTML_CONTENT_SECURITY_POLICY.
+func NewSecurityHeadersConfigFromEnv() SecurityHeadersConfig {
+	config := SecurityHeadersConfig{HSTSMaxAge: 365 * 24 * 60 * 60, HTMLContentSecurityPolicy: DefaultHTMLContentSecurityPolicy}
+
+	if seconds, err := strconv.Atoi(os.Getenv("HSTS_MAX_AGE")); err == nil && seconds >= 0 {
+		config.HSTSMaxAge = seconds
+	}
+
+	if policy := os.Getenv("HTML_CONTENT_SECURITY_POLICY"); policy != "" {
+		config.HTMLContentSecurityPolicy = policy
+	}
+
+	return config
+}
+
+// Response writer that sets the Content-Security-Policy once the content type of the response is known,
+// right before the headers are sent. gin's WriteHeader only records the status, so it doesn't need to be wrapped.
+type cspWriter struct {
+	gin.ResponseWriter
+	htmlPolicy string
+	done       bool
+}
+
+func (w *cspWriter) applyPolicy() {
+	if w.done {
+		return
+	}
+
+	w.done = true
+	header := w.Header()
+
+	if header.Get("Content-Security-Policy") != "" {
+		return
+	}
+
+	if strings.HasPrefix(header.Get("Content-Type"), "text/html") {
+		header.Set("Content-Security-Policy", w.htmlPolicy)
+	} else {
+		header.Set("Content-Security-Policy", apiContentSecurityPolicy)
+	}
+}
+
+func (w *cspWriter) WriteHeaderNow() {
+	w.applyPolicy()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *cspWriter) Write(data []byte) (int, error) {
+	w.applyPolicy()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *cspWriter) WriteString(s string) (int, error) {
+	w.applyPolicy()
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Middleware that adds HSTS, X-Content-Type-Options, X-Frame-Options, Referrer-Policy and a Content-Security-Policy
+// (stricter for API responses than for HTML pages) to every response.
+// Moves on to the next handler.
+func SecurityHeaders(config SecurityHeadersConfig) gin.HandlerFunc {
+	hsts := "max-age=" + strconv.Itoa(config.HSTSMaxAge) + "; includeSubDomains"
+
+	return func(c *gin.Context) {
+		header := c.Writer.Header()
+
+		if config.HSTSMaxAge > 0 {
+			header.Set("Strict-Transport-Security", hsts)
+		}
+
+		header.Set("X-Content-Type-Options", "nosniff")
+		header.Set("X-Frame-Options", "DENY")
+		header.Set("Referrer-Policy", "no-referrer")
+
+		writer := &cspWriter{ResponseWriter: c.Writer, htmlPolicy: config.HTMLContentSecurityPolicy}
+		c.Writer = writer
+		c.Next()
+
+		// Responses without body only send their headers after the handlers.
+		writer.applyPolicy()
+	}
+}
@@ -0,0 +1,165 @@
+package middlewares
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// HttpOnly cookie holding the JWT in cookie mode.
+	AccessTokenCookie = "access_token"
+	// Cookie readable by the client, whose value must be sent back in the CSRF header on unsafe requests.
+	// It is derived from the access token cookie, so it is only valid with the session it was issued for.
+	CSRFCookie = "csrf_token"
+	CSRFHeader = "X-CSRF-Token"
+	// HttpOnly cookie binding an OpenID Connect login to the browser that started it.
+	OIDCStateCookie = "oidc_state"
+)
+
+type cookieConfig struct {
+	secure   bool
+	sameSite http.SameSite
+	domain   string
+}
+
+// Cookies are Secure and SameSite=Strict unless COOKIE_SECURE=false or COOKIE_SAMESITE=lax|none, COOKIE_DOMAIN is optional.
+var sessionCookieConfig = loadCookieConfig()
+
+func loadCookieConfig() cookieConfig {
+	config := cookieConfig{secure: true, sameSite: http.SameSiteStrictMode, domain: os.Getenv("COOKIE_DOMAIN")}
+
+	if os.Getenv("COOKIE_SECURE") == "false" {
+		config.secure = false
+	}
+
+	switch strings.ToLower(os.Getenv("COOKIE_SAMESITE")) {
+	case "lax":
+		config.sameSite = http.SameSiteLaxMode
+	case "none":
+		// Browsers reject SameSite=None cookies that aren't Secure.
+		config.sameSite = http.SameSiteNoneMode
+		config.secure = true
+	}
+
+	return config
+}
+
+// Key of the CSRF tokens, from CSRF_SECRET, random when it isn't set: the CSRF tokens are then only valid until the server restarts.
+var csrfKey = loadCSRFKey()
+
+func loadCSRFKey() []byte {
+	if secret := os.Getenv("CSRF_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+
+	key := make([]byte, 32)
+
+	if _, err := rand.Read(key); err != nil {
+		log.Fatal("csrf key: ", err)
+	}
+
+	return key
+}
+
+// Helper function that returns the CSRF token of a session: an HMAC of its access token, that can't be computed
+// without reading the HttpOnly cookie, nor reused with another session.
+func NewCSRFToken(tokenString string) string {
+	mac := hmac.New(sha256.New, csrfKey)
+	mac.Write([]byte(tokenString))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func setCookie(c *gin.Context, name, value string, maxAge time.Duration, httpOnly bool) {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Domain:   sessionCookieConfig.domain,
+		MaxAge:   int(maxAge.Seconds()),
+		Secure:   sessionCookieConfig.secure,
+		HttpOnly: httpOnly,
+		SameSite: sessionCookieConfig.sameSite,
+	}
+
+	if maxAge < 0 {
+		cookie.MaxAge = -1
+	}
+
+	http.SetCookie(c.Writer, cookie)
+}
+
+// Sets the session cookies used in cookie mode: the JWT in an HttpOnly cookie, and the CSRF token in a cookie the client can read.
+func SetSessionCookies(c *gin.Context, tokenString, csrfToken string, maxAge time.Duration) {
+	setCookie(c, AccessTokenCookie, tokenString, maxAge, true)
+	setCookie(c, CSRFCookie, csrfToken, maxAge, false)
+}
+
+// Sets the OpenID Connect state cookie.
+// It is SameSite=Lax whatever COOKIE_SAMESITE says: the provider redirects the browser back from another site.
+func SetOIDCStateCookie(c *gin.Context, state string, maxAge time.Duration) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     OIDCStateCookie,
+		Value:    state,
+		Path:     "/",
+		Domain:   sessionCookieConfig.domain,
+		MaxAge:   int(maxAge.Seconds()),
+		Secure:   sessionCookieConfig.secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// Removes the OpenID Connect state cookie.
+func ClearOIDCStateCookie(c *gin.Context) {
+	SetOIDCStateCookie(c, "", -time.Second)
+}
+
+// Removes the session cookies.
+func ClearSessionCookies(c *gin.Context) {
+	setCookie(c, AccessTokenCookie, "", -1, true)
+	setCookie(c, CSRFCookie, "", -1, false)
+}
+
+// Helper function that checks the CSRF protection of a cookie authenticated request:
+// safe methods are always allowed, other ones must send the CSRF token of the access token cookie in the CSRF header.
+func checkCSRF(c *gin.Context) bool {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+
+	session, err := c.Cookie(AccessTokenCookie)
+	header := c.GetHeader(CSRFHeader)
+
+	if err != nil || session == "" || header == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(NewCSRFToken(session)), []byte(header)) == 1
+}
+
+// Middleware for public routes acting on the session cookies, like /logout: requests carrying the access token cookie must pass the CSRF check,
+// even when the token itself has expired.
+// Returns 403 if the CSRF header doesn't match the session on an unsafe request.
+// Moves on to the next handler otherwise.
+func VerifyCSRF() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if cookie, err := c.Cookie(AccessTokenCookie); err == nil && cookie != "" && !checkCSRF(c) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "Missing or invalid CSRF token, please send the csrf_token cookie value in the " + CSRFHeader + " header."})
+			return
+		}
+
+		c.Next()
+	}
+}
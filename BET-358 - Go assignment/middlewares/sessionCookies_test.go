@@ -0,0 +1,60 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCSRFTokenIsBoundToSession(t *testing.T) {
+	if NewCSRFToken("session-a") != NewCSRFToken("session-a") {
+		t.Fatal("CSRF token of a session isn't stable")
+	}
+
+	if NewCSRFToken("session-a") == NewCSRFToken("session-b") {
+		t.Fatal("two sessions have the same CSRF token")
+	}
+}
+
+func TestVerifyCSRF(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/logout", VerifyCSRF(), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	cases := []struct {
+		name    string
+		session string
+		header  string
+		want    int
+	}{
+		{"no session cookie", "", "", http.StatusOK},
+		{"missing header", "session-a", "", http.StatusForbidden},
+		{"token of another session", "session-a", NewCSRFToken("session-b"), http.StatusForbidden},
+		{"token of the session", "session-a", NewCSRFToken("session-a"), http.StatusOK},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/logout", nil)
+
+			if tc.session != "" {
+				req.AddCookie(&http.Cookie{Name: AccessTokenCookie, Value: tc.session})
+				// A CSRF cookie set by an attacker doesn't help without the token of the session.
+				req.AddCookie(&http.Cookie{Name: CSRFCookie, Value: tc.header})
+			}
+
+			if tc.header != "" {
+				req.Header.Set(CSRFHeader, tc.header)
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tc.want {
+				t.Fatalf("got %d, want %d", w.Code, tc.want)
+			}
+		})
+	}
+}
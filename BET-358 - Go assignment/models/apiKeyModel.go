@@ -0,0 +1,166 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	DB "rabietf.me/go-assignment/db"
+)
+
+type ApiKey struct {
+	ID     int64
+	UserID int64
+	ShopID int64
+	Name   string
+	// Visible part of the key, used to find it and to tell keys apart.
+	Prefix string
+	// SHA-256 of the whole key, the key itself is never stored.
+	KeyHash    string
+	Scopes     string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	LastUsedAt sql.NullTime
+	RevokedAt  sql.NullTime
+}
+
+const apiKeyColumns = "id, user_id, shop_id, name, prefix, key_hash, scopes, created_at, updated_at, last_used_at, revoked_at"
+
+func (apiKey *ApiKey) scan(row interface{ Scan(...any) error }) error {
+	return row.Scan(&apiKey.ID, &apiKey.UserID, &apiKey.ShopID, &apiKey.Name, &apiKey.Prefix, &apiKey.KeyHash, &apiKey.Scopes, &apiKey.CreatedAt, &apiKey.UpdatedAt, &apiKey.LastUsedAt, &apiKey.RevokedAt)
+}
+
+func (apiKey ApiKey) auditState() auditState {
+	return auditState{"user_id": apiKey.UserID, "shop_id": apiKey.ShopID, "name": apiKey.Name, "prefix": apiKey.Prefix, "scopes": apiKey.Scopes, "revoked_at": auditTime(apiKey.RevokedAt)}
+}
+
+// Method for inserting new API key in database, recorded in the audit log as done by actor.
+// Returns (apiKeyId, nil) if successful.
+// Returns (0, err) if failed.
+func (apiKey ApiKey) Save(actor Actor) (int64, error) {
+	var id int64
+
+	if apiKey.CreatedAt.IsZero() {
+		apiKey.CreatedAt = now()
+	}
+	apiKey.UpdatedAt = apiKey.CreatedAt
+
+	err := inTransaction(func(tx *sql.Tx) error {
+		result, err := tx.Exec("INSERT INTO ApiKeys (user_id, shop_id, name, prefix, key_hash, scopes, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)", apiKey.UserID, apiKey.ShopID, apiKey.Name, apiKey.Prefix, apiKey.KeyHash, apiKey.Scopes, apiKey.CreatedAt, apiKey.UpdatedAt)
+
+		if err != nil {
+			return err
+		}
+		if id, err = result.LastInsertId(); err != nil {
+			return err
+		}
+
+		return writeAudit(tx, actor, "api_key", id, AuditCreate, nil, apiKey.auditState())
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// Method for finding API key in database using its prefix, revoked keys included.
+// Returns (true, nil) and puts API key in object if it exists.
+// Returns (false, nil) if it doesn't exist.
+// Returns (false, err) if something went wrong.
+func (apiKey *ApiKey) FindByPrefix(prefix string) (bool, error) {
+	row := DB.Connection.QueryRow("SELECT "+apiKeyColumns+" FROM ApiKeys WHERE prefix = ?", prefix)
+
+	if err := apiKey.scan(row); err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Method for finding API key of a user in database using id.
+// Returns (true, nil) and puts API key in object if it exists and belongs to the user.
+// Returns (false, nil) if it doesn't exist.
+// Returns (false, err) if something went wrong.
+func (apiKey *ApiKey) FindByIdAndUser(ID, userID int64) (bool, error) {
+	row := DB.Connection.QueryRow("SELECT "+apiKeyColumns+" FROM ApiKeys WHERE id = ? AND user_id = ?", ID, userID)
+
+	if err := apiKey.scan(row); err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Method for finding all API keys of a user in database, revoked keys included.
+// Returns (apiKeys, nil) if successful.
+// Returns (nil, err) if something went wrong.
+func (apiKey ApiKey) FindAllByUser(userID int64) ([]ApiKey, error) {
+	var apiKeys []ApiKey
+
+	rows, err := DB.Connection.Query("SELECT "+apiKeyColumns+" FROM ApiKeys WHERE user_id = ? ORDER BY id", userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var key ApiKey
+		if err := key.scan(rows); err != nil {
+			return nil, err
+		}
+		apiKeys = append(apiKeys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return apiKeys, nil
+}
+
+// Method for revoking the API key, it can't be used anymore afterwards.
+// Recorded in the audit log as done by actor, unless the key was already revoked.
+// Returns nil if success.
+// Returns error otherwise
+func (apiKey ApiKey) Revoke(actor Actor) error {
+	revokedAt := now()
+
+	return inTransaction(func(tx *sql.Tx) error {
+		result, err := tx.Exec("UPDATE ApiKeys SET revoked_at=?, updated_at=? WHERE id=? AND revoked_at IS NULL", revokedAt, revokedAt, apiKey.ID)
+
+		if err != nil {
+			return err
+		}
+
+		if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+			return err
+		}
+
+		revoked := apiKey
+		revoked.RevokedAt = sql.NullTime{Time: revokedAt, Valid: true}
+
+		return writeAudit(tx, actor, "api_key", apiKey.ID, AuditUpdate, apiKey.auditState(), revoked.auditState())
+	})
+}
+
+// Method for recording that the API key was just used, this isn't a change worth an entry in the audit log.
+// Returns nil if success.
+// Returns error otherwise
+func (apiKey ApiKey) Touch() error {
+	_, err := DB.Connection.Exec("UPDATE ApiKeys SET last_used_at=? WHERE id=?", time.Now().UTC(), apiKey.ID)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,247 @@
+package models
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+
+	DB "rabietf.me/go-assignment/db"
+)
+
+const (
+	AuditCreate = "create"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+)
+
+// Who performs a mutation, recorded in the audit log along with it.
+type Actor struct {
+	// 0 if the request isn't authenticated (sign up...).
+	UserID int64
+	// 0 unless the request is authenticated with an API key of the user.
+	APIKeyID  int64
+	RequestID string
+}
+
+// Value of a field before and after a mutation, nil when the entity doesn't exist on that side.
+type FieldChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// A row of the append-only audit log, there is one per created, updated or deleted entity.
+type AuditEntry struct {
+	ID        int64
+	ActorID   sql.NullInt64
+	APIKeyID  sql.NullInt64
+	Entity    string
+	EntityID  int64
+	Action    string
+	Changes   map[string]FieldChange
+	RequestID string
+	CreatedAt time.Time
+}
+
+// Criteria of FindAll, zero values are ignored.
+type AuditFilter struct {
+	Entity   string
+	EntityID int64
+	ActorID  int64
+	// Only returns entries older than this one, to get the next page.
+	BeforeID int64
+	Limit    int
+}
+
+// Audited fields of an entity, secrets excluded.
+type auditState map[string]interface{}
+
+// Helper function that runs fn in a transaction, committed if fn returns nil and rolled back otherwise.
+func inTransaction(fn func(tx *sql.Tx) error) error {
+	tx, err := DB.Connection.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Helper function that returns the fields that differ between two states of an entity, before being nil on creation and after on deletion.
+func diffStates(before, after auditState) map[string]FieldChange {
+	changes := make(map[string]FieldChange)
+
+	for field, value := range before {
+		if other, ok := after[field]; !ok || !reflect.DeepEqual(value, other) {
+			changes[field] = FieldChange{Before: value, After: other}
+		}
+	}
+
+	for field, value := range after {
+		if _, ok := before[field]; !ok {
+			changes[field] = FieldChange{Before: nil, After: value}
+		}
+	}
+
+	return changes
+}
+
+// Helper function that stands for a secret in the audit log: it tells whether it changed without revealing it.
+func redacted(secret string) interface{} {
+	if secret == "" {
+		return nil
+	}
+
+	sum := sha256.Sum256([]byte(secret))
+	return "sha256:" + hex.EncodeToString(sum[:4])
+}
+
+// Helper function that returns a nullable time as audited value.
+func auditTime(t sql.NullTime) interface{} {
+	if !t.Valid {
+		return nil
+	}
+
+	return t.Time.UTC()
+}
+
+// Helper function that returns a nullable number as audited value.
+func auditFloat(f sql.NullFloat64) interface{} {
+	if !f.Valid {
+		return nil
+	}
+
+	return f.Float64
+}
+
+func nullID(id int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: id, Valid: id != 0}
+}
+
+// Helper function that records a mutation in the audit log, within the transaction of the mutation itself
+// so that one is never saved without the other.
+func writeAudit(tx *sql.Tx, actor Actor, entity string, entityID int64, action string, before, after auditState) error {
+	changes, err := json.Marshal(diffStates(before, after))
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO AuditLog (actor_id, api_key_id, entity, entity_id, action, changes, request_id, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		nullID(actor.UserID), nullID(actor.APIKeyID), entity, entityID, action, changes, actor.RequestID, time.Now().UTC())
+
+	return err
+}
+
+// Method for finding audit entries matching filter, newest first.
+// Returns (entries, nil) if successful, an empty list if there are none.
+// Returns (nil, err) if something went wrong.
+func (entry AuditEntry) FindAll(filter AuditFilter) ([]AuditEntry, error) {
+	entries := []AuditEntry{}
+
+	var conditions []string
+	var args []interface{}
+
+	if filter.Entity != "" {
+		conditions = append(conditions, "entity = ?")
+		args = append(args, filter.Entity)
+	}
+
+	if filter.EntityID != 0 {
+		conditions = append(conditions, "entity_id = ?")
+		args = append(args, filter.EntityID)
+	}
+
+	if filter.ActorID != 0 {
+		conditions = append(conditions, "actor_id = ?")
+		args = append(args, filter.ActorID)
+	}
+
+	if filter.BeforeID != 0 {
+		conditions = append(conditions, "id < ?")
+		args = append(args, filter.BeforeID)
+	}
+
+	query := "SELECT id, actor_id, api_key_id, entity, entity_id, action, changes, request_id, created_at FROM AuditLog"
+
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, filter.Limit)
+
+	rows, err := DB.Connection.Query(query, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var e AuditEntry
+		var changes []byte
+
+		if err := rows.Scan(&e.ID, &e.ActorID, &e.APIKeyID, &e.Entity, &e.EntityID, &e.Action, &changes, &e.RequestID, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(changes, &e.Changes); err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// A deleted entity, from its delete entry in the audit log: lists filtered on updated_at can't return it.
+type Deletion struct {
+	Entity    string
+	EntityID  int64
+	DeletedAt time.Time
+}
+
+// Method for finding the entities of a kind (shop, product...) deleted at or after since, least recently deleted first.
+// Returns (deletions, nil) if successful, an empty list if there are none.
+// Returns (nil, err) if something went wrong.
+func (deletion Deletion) FindAll(entity string, since time.Time) ([]Deletion, error) {
+	deletions := []Deletion{}
+
+	rows, err := DB.Connection.Query("SELECT entity, entity_id, created_at FROM AuditLog WHERE action = ? AND entity = ? AND created_at >= ? ORDER BY created_at, id",
+		AuditDelete, entity, since.UTC())
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var d Deletion
+		if err := rows.Scan(&d.Entity, &d.EntityID, &d.DeletedAt); err != nil {
+			return nil, err
+		}
+		deletions = append(deletions, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deletions, nil
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// What RunBatch commits.
+type BatchMode int
+
+const (
+	// Commits only if every write succeeds.
+	BatchAtomic BatchMode = iota
+	// Commits the writes that succeed.
+	BatchContinueOnError
+	// Never commits, to find out which writes would fail.
+	BatchDryRun
+)
+
+// Returned by the transaction of RunBatch to have it rolled back.
+var errBatchRolledBack = errors.New("some writes failed, nothing was saved")
+
+// Helper function that tells whether a write failed because of its data, so that the other writes of a batch can go on:
+// a value that must be unique, or a row modified since it was read.
+func isExpectedWriteError(err error) bool {
+	var duplicate DuplicateError
+
+	return errors.As(err, &duplicate) || err == ErrStaleVersion
+}
+
+// Function for running many writes in one transaction, each in its own savepoint so that a write failing because of its data
+// (DuplicateError or ErrStaleVersion) doesn't stop the others, what is committed afterwards depends on mode.
+// Returns (committed, errs, nil), errs[i] being the error of writes[i] if it failed.
+// Returns (false, nil, err) if a write failed with another error, or the transaction itself failed, nothing is saved then.
+func RunBatch(writes []func(tx *sql.Tx) error, mode BatchMode) (bool, []error, error) {
+	errs := make([]error, len(writes))
+
+	err := inTransaction(func(tx *sql.Tx) error {
+		failed := false
+
+		for i, write := range writes {
+			if _, err := tx.Exec("SAVEPOINT batch_write"); err != nil {
+				return err
+			}
+
+			err := write(tx)
+
+			if isExpectedWriteError(err) {
+				if _, err := tx.Exec("ROLLBACK TO SAVEPOINT batch_write"); err != nil {
+					return err
+				}
+
+				errs[i] = err
+				failed = true
+				continue
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+
+		if mode == BatchDryRun || failed && mode == BatchAtomic {
+			return errBatchRolledBack
+		}
+
+		return nil
+	})
+
+	if err == errBatchRolledBack {
+		return false, errs, nil
+	}
+
+	if err != nil {
+		return false, nil, err
+	}
+
+	return true, errs, nil
+}
@@ -1,19 +1,34 @@
 package models
 
-import DB "rabietf.me/go-assignment/db"
+import (
+	"database/sql"
+	"sort"
+	"time"
+
+	DB "rabietf.me/go-assignment/db"
+)
 
 type Category struct {
 	ID   int64
 	Name string
+	// 0 for the categories at the root of the tree, stored as NULL.
+	ParentID int64
+	Slug     string
+	// Order among the categories with the same parent.
+	Position  int
+	CreatedAt time.Time
+	UpdatedAt time.Time
 }
 
-// Method for finding all categories in database.
+// Method for finding all categories in database, or only the ones updated since the given time if it isn't zero.
 // Returns (categories, nil) if successful.
 // Returns (nil, err) if something went wrong.
-func (category Category) FindAll() ([]Category, error) {
-	var categories []Category
+func (category Category) FindAll(updatedSince time.Time) ([]Category, error) {
+	categories := []Category{}
+
+	clause, args := updatedSinceClause(updatedSince)
 
-	rows, err := DB.Connection.Query("SELECT * FROM Categories")
+	rows, err := DB.Connection.Query("SELECT id, name, parent_id, slug, position, created_at, updated_at FROM Categories"+clause, args...)
 
 	if err != nil {
 		return nil, err
@@ -23,11 +38,99 @@ func (category Category) FindAll() ([]Category, error) {
 
 	for rows.Next() {
 		var cat Category
-		if err := rows.Scan(&cat.ID, &cat.Name); err != nil {
+		var parentID sql.NullInt64
+		if err := rows.Scan(&cat.ID, &cat.Name, &parentID, &cat.Slug, &cat.Position, &cat.CreatedAt, &cat.UpdatedAt); err != nil {
 			return nil, err
 		}
+		cat.ParentID = parentID.Int64
 		categories = append(categories, cat)
 	}
 
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
 	return categories, nil
 }
+
+// Function that groups the categories by parent, 0 holding the roots, each group being ordered by position then ID.
+func CategoryChildren(categories []Category) map[int64][]Category {
+	children := make(map[int64][]Category)
+
+	for _, category := range categories {
+		children[category.ParentID] = append(children[category.ParentID], category)
+	}
+
+	for _, siblings := range children {
+		sort.Slice(siblings, func(i, j int) bool {
+			if siblings[i].Position != siblings[j].Position {
+				return siblings[i].Position < siblings[j].Position
+			}
+			return siblings[i].ID < siblings[j].ID
+		})
+	}
+
+	return children
+}
+
+// Function that returns the categories in the order of the tree: each category is followed by its descendants, siblings by position.
+// Categories that can't be reached from the roots are left out.
+func SortCategoriesAsTree(categories []Category) []Category {
+	children := CategoryChildren(categories)
+	sorted := make([]Category, 0, len(categories))
+
+	var visit func(parentID int64)
+	visit = func(parentID int64) {
+		for _, child := range children[parentID] {
+			sorted = append(sorted, child)
+			visit(child.ID)
+		}
+	}
+
+	visit(0)
+
+	return sorted
+}
+
+// Function that returns the categories without children, the only ones products can be in.
+func LeafCategories(categories []Category) []Category {
+	children := CategoryChildren(categories)
+	leaves := []Category{}
+
+	for _, category := range categories {
+		if len(children[category.ID]) == 0 {
+			leaves = append(leaves, category)
+		}
+	}
+
+	return leaves
+}
+
+// Function that returns the category with the given ID followed by all its descendants, in the order of the tree.
+// Returns an empty list if there is no such category.
+func CategoryWithDescendants(categories []Category, id int64) []Category {
+	children := CategoryChildren(categories)
+	found := []Category{}
+	visited := make(map[int64]bool)
+
+	var visit func(category Category)
+	visit = func(category Category) {
+		if visited[category.ID] {
+			return
+		}
+		visited[category.ID] = true
+		found = append(found, category)
+
+		for _, child := range children[category.ID] {
+			visit(child)
+		}
+	}
+
+	for _, category := range categories {
+		if category.ID == id {
+			visit(category)
+		}
+	}
+
+	return found
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// MySQL error number of a violated unique index.
+const mysqlDuplicateEntry = 1062
+
+// Returned when a write would give a row the same value as another row, where it must be unique.
+// Field is the name of the field holding that value in the API.
+type DuplicateError struct {
+	Field string
+}
+
+func (err DuplicateError) Error() string {
+	return "another row has the same " + err.Field
+}
+
+// Helper function that checks whether err is a duplicate entry error on the unique index named index.
+// MySQL 8 names the index as Table.index in the message, older versions only give its name.
+func isDuplicate(err error, index string) bool {
+	var mysqlErr *mysql.MySQLError
+
+	if !errors.As(err, &mysqlErr) || mysqlErr.Number != mysqlDuplicateEntry {
+		return false
+	}
+
+	return strings.HasSuffix(mysqlErr.Message, "'"+index+"'") || strings.HasSuffix(mysqlErr.Message, "."+index+"'")
+}
+
+// Helper function that turns the violation of one of the unique indexes into the DuplicateError of its field.
+// fields maps the name of each index to its field.
+// Returns err unchanged if it isn't the violation of one of them.
+func duplicateError(err error, fields map[string]string) error {
+	for index, field := range fields {
+		if isDuplicate(err, index) {
+			return DuplicateError{Field: field}
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestDuplicateError(t *testing.T) {
+	// Messages of MySQL 5.7, then of MySQL 8 which prefixes the index with its table.
+	cases := []struct {
+		name   string
+		err    error
+		fields map[string]string
+		field  string
+	}{
+		{"name_per_shop on 5.7", &mysql.MySQLError{Number: 1062, Message: "Duplicate entry '5-Bread' for key 'name_per_shop'"}, productUniqueFields, "name"},
+		{"name_per_shop on 8", &mysql.MySQLError{Number: 1062, Message: "Duplicate entry '5-Bread' for key 'Products.name_per_shop'"}, productUniqueFields, "name"},
+		{"slug on 5.7", &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'bakery' for key 'slug'"}, shopUniqueFields, "slug"},
+		{"slug on 8", &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'bakery' for key 'Shops.slug'"}, shopUniqueFields, "slug"},
+		{"name_per_address on 8", &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'Bakery-Paris' for key 'Shops.name_per_address'"}, shopUniqueFields, "name"},
+		{"sku_per_shop on 5.7", &mysql.MySQLError{Number: 1062, Message: "Duplicate entry '5-BRD-1' for key 'sku_per_shop'"}, variantUniqueFields, "sku"},
+		{"sku_per_shop on 8", &mysql.MySQLError{Number: 1062, Message: "Duplicate entry '5-BRD-1' for key 'ProductVariants.sku_per_shop'"}, variantUniqueFields, "sku"},
+		{"options_per_product on 8", &mysql.MySQLError{Number: 1062, Message: "Duplicate entry '9-c0ffee' for key 'ProductVariants.options_per_product'"}, variantUniqueFields, "options"},
+		{"review_per_user on 5.7", &mysql.MySQLError{Number: 1062, Message: "Duplicate entry '5-2' for key 'review_per_user'"}, reviewUniqueFields, "product_id"},
+		{"review_per_user on 8", &mysql.MySQLError{Number: 1062, Message: "Duplicate entry '5-2' for key 'ProductReviews.review_per_user'"}, reviewUniqueFields, "product_id"},
+		{"wrapped", fmt.Errorf("saving: %w", &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'bakery' for key 'Shops.slug'"}), shopUniqueFields, "slug"},
+		// The entry holds the name of an index, the key doesn't.
+		{"index in the entry", &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'slug' for key 'PRIMARY'"}, shopUniqueFields, ""},
+		{"index with the same suffix", &mysql.MySQLError{Number: 1062, Message: "Duplicate entry '5-BRD-1' for key 'ProductVariants.old_sku_per_shop'"}, variantUniqueFields, ""},
+		{"index of another table", &mysql.MySQLError{Number: 1062, Message: "Duplicate entry '5-Bread' for key 'Products.name_per_shop'"}, shopUniqueFields, ""},
+		{"other MySQL error", &mysql.MySQLError{Number: 1452, Message: "Cannot add or update a child row: a foreign key constraint fails 'name_per_shop'"}, productUniqueFields, ""},
+		{"other error", errors.New("Duplicate entry 'bakery' for key 'slug'"), shopUniqueFields, ""},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := duplicateError(tc.err, tc.fields)
+
+			if tc.field == "" {
+				// Passed through unchanged.
+				if got != tc.err {
+					t.Fatalf("got %v, want %v", got, tc.err)
+				}
+				return
+			}
+
+			var duplicate DuplicateError
+
+			if !errors.As(got, &duplicate) || duplicate.Field != tc.field {
+				t.Fatalf("got %v, want a duplicate %s", got, tc.field)
+			}
+		})
+	}
+}
+
+func TestDuplicateErrorOfNil(t *testing.T) {
+	if err := duplicateError(nil, shopUniqueFields); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	DB "rabietf.me/go-assignment/db"
+)
+
+type FailedLogin struct {
+	ID          int64
+	Email       string
+	IP          string
+	Reason      string
+	AttemptedAt time.Time
+}
+
+// Method for recording a failed login attempt in database, for auditing purposes.
+// Returns (failedLoginId, nil) if successful.
+// Returns (0, err) if failed.
+func (failedLogin FailedLogin) Save() (int64, error) {
+	result, err := DB.Connection.Exec("INSERT INTO FailedLogins (email, ip, reason, attempted_at) VALUES (?, ?, ?, ?)", failedLogin.Email, failedLogin.IP, failedLogin.Reason, failedLogin.AttemptedAt)
+
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
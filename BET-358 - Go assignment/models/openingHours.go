@@ -0,0 +1,173 @@
+package models
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	// Time zones don't depend on the zoneinfo files of the server.
+	_ "time/tzdata"
+)
+
+// Minutes in a day, the latest closing time.
+const MinutesPerDay = 24 * 60
+
+// Opening period of a day, in minutes since midnight local time.
+// A period closing at or before its opening time ends the next day, like 22:00 to 02:00, and 00:00 to 00:00 lasts the whole day.
+type OpeningPeriod struct {
+	Opens  int `json:"opens"`
+	Closes int `json:"closes"`
+}
+
+// Weekly opening hours of a shop in its time zone, with exceptions on given dates.
+type OpeningHours struct {
+	// IANA name, like Europe/Paris.
+	TimeZone string `json:"time_zone"`
+	// Periods opening on each day, indexed by time.Weekday.
+	Weekly [7][]OpeningPeriod `json:"weekly"`
+	// Periods opening on a date (2006-01-02) replacing the weekly ones of that day, none when the shop is closed all day.
+	Exceptions map[string][]OpeningPeriod `json:"exceptions"`
+}
+
+var (
+	locationsMu sync.Mutex
+	locations   = map[string]*time.Location{}
+)
+
+// Helper function that loads a time zone once.
+// Returns (location, nil) if name is a known IANA time zone.
+// Returns (nil, err) otherwise.
+func loadLocation(name string) (*time.Location, error) {
+	locationsMu.Lock()
+	defer locationsMu.Unlock()
+
+	if location, ok := locations[name]; ok {
+		return location, nil
+	}
+
+	location, err := time.LoadLocation(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	locations[name] = location
+	return location, nil
+}
+
+// Helper function that checks whether name is a time zone opening hours can use: an IANA name or UTC, not the zone of the server.
+func ValidTimeZone(name string) bool {
+	if name == "" || name == "Local" {
+		return false
+	}
+
+	_, err := loadLocation(name)
+
+	return err == nil
+}
+
+// Helper function that returns the instant the clocks of location show minutes after midnight on the given date.
+// A time the clocks show twice, when they move back, is its first occurrence.
+// A time the clocks skip, when they move forward, is moved forward by the jump: 02:30 is 03:30 when they go from 02:00 to 03:00.
+// time.Date doesn't guarantee either, so the offsets of the day before and the day after are tried, zones never changing twice in two days.
+func localInstant(year int, month time.Month, day, minutes int, location *time.Location) time.Time {
+	wall := time.Date(year, month, day, 0, minutes, 0, 0, time.UTC)
+
+	_, offsetBefore := wall.Add(-24 * time.Hour).In(location).Zone()
+	_, offsetAfter := wall.Add(24 * time.Hour).In(location).Zone()
+
+	before := wall.Add(-time.Duration(offsetBefore) * time.Second)
+	after := wall.Add(-time.Duration(offsetAfter) * time.Second)
+
+	_, beforeOffset := before.In(location).Zone()
+	_, afterOffset := after.In(location).Zone()
+	beforeValid, afterValid := beforeOffset == offsetBefore, afterOffset == offsetAfter
+
+	switch {
+	case beforeValid && afterValid && after.Before(before):
+		return after.In(location)
+	case beforeValid || !afterValid:
+		return before.In(location)
+	default:
+		return after.In(location)
+	}
+}
+
+// Helper function that returns the periods opening on the given date.
+func (hours OpeningHours) periodsOn(year int, month time.Month, day int) []OpeningPeriod {
+	date := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+
+	if periods, ok := hours.Exceptions[date.Format("2006-01-02")]; ok {
+		return periods
+	}
+
+	return hours.Weekly[date.Weekday()]
+}
+
+// Method that tells whether the shop is open at the given instant.
+// Periods are local times of the time zone turned into instants for their date (see localInstant), so that they follow the clocks:
+// 22:00 to 04:00 lasts 5 hours on the night the clocks move forward, and 7 hours on the night they move back.
+// Periods started the day before still end after midnight, even when the day is an exception.
+func (hours OpeningHours) OpenAt(at time.Time) bool {
+	location, err := loadLocation(hours.TimeZone)
+
+	if err != nil {
+		location = time.UTC
+	}
+
+	localYear, localMonth, localDay := at.In(location).Date()
+
+	// Periods opening the day before can still be running.
+	for offset := -1; offset <= 0; offset++ {
+		year, month, day := time.Date(localYear, localMonth, localDay+offset, 0, 0, 0, 0, time.UTC).Date()
+
+		for _, period := range hours.periodsOn(year, month, day) {
+			opens := localInstant(year, month, day, period.Opens, location)
+			closesDay := day
+
+			if period.Closes <= period.Opens {
+				closesDay++
+			}
+
+			closes := localInstant(year, month, closesDay, period.Closes, location)
+
+			if !at.Before(opens) && at.Before(closes) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Helper function that returns the opening hours as stored, NULL when there are none.
+func (hours *OpeningHours) column() (*string, error) {
+	if hours == nil {
+		return nil, nil
+	}
+
+	bytes, err := json.Marshal(hours)
+
+	if err != nil {
+		return nil, err
+	}
+
+	text := string(bytes)
+	return &text, nil
+}
+
+// Helper function that reads the opening hours as stored.
+// Returns (nil, nil) when there are none.
+func parseOpeningHours(column *string) (*OpeningHours, error) {
+	if column == nil {
+		return nil, nil
+	}
+
+	var hours OpeningHours
+
+	if err := json.Unmarshal([]byte(*column), &hours); err != nil {
+		return nil, err
+	}
+
+	return &hours, nil
+}
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+// Helper function that parses an RFC 3339 time, failing the test if it isn't one.
+func mustTime(t *testing.T, value string) time.Time {
+	at, err := time.Parse(time.RFC3339, value)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return at
+}
+
+// In Paris the clocks move from 02:00 to 03:00 on 2024-03-31, and from 03:00 back to 02:00 on 2024-10-27.
+func TestLocalInstant(t *testing.T) {
+	paris, err := loadLocation("Europe/Paris")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		date    string
+		minutes int
+		want    string
+	}{
+		{"summer", "2024-06-01", 9 * 60, "2024-06-01T07:00:00Z"},
+		{"winter", "2024-01-15", 9 * 60, "2024-01-15T08:00:00Z"},
+		{"before the clocks move forward", "2024-03-31", 1*60 + 59, "2024-03-31T00:59:00Z"},
+		{"skipped time is moved forward", "2024-03-31", 2*60 + 30, "2024-03-31T01:30:00Z"},
+		{"after the clocks move forward", "2024-03-31", 3 * 60, "2024-03-31T01:00:00Z"},
+		{"midnight before the clocks move back", "2024-10-27", 0, "2024-10-26T22:00:00Z"},
+		{"repeated time is its first occurrence", "2024-10-27", 2*60 + 30, "2024-10-27T00:30:00Z"},
+		{"after the clocks move back", "2024-10-27", 3 * 60, "2024-10-27T02:00:00Z"},
+		{"24:00 is midnight of the next day", "2024-03-30", MinutesPerDay, "2024-03-30T23:00:00Z"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			date, err := time.Parse("2006-01-02", tc.date)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := localInstant(date.Year(), date.Month(), date.Day(), tc.minutes, paris)
+
+			if want := mustTime(t, tc.want); !got.Equal(want) {
+				t.Fatalf("got %s, want %s", got.UTC().Format(time.RFC3339), tc.want)
+			}
+		})
+	}
+}
+
+func TestOpenAt(t *testing.T) {
+	// Open on Saturday nights from 22:00 to 04:00.
+	saturdayNights := OpeningHours{TimeZone: "Europe/Paris"}
+	saturdayNights.Weekly[time.Saturday] = []OpeningPeriod{{Opens: 22 * 60, Closes: 4 * 60}}
+
+	// Open on Friday nights from 22:00 to 02:00 and on Saturdays from 10:00 to 18:00, except on Saturday 2024-06-08.
+	closedSaturday := OpeningHours{TimeZone: "Europe/Paris", Exceptions: map[string][]OpeningPeriod{"2024-06-08": {}}}
+	closedSaturday.Weekly[time.Friday] = []OpeningPeriod{{Opens: 22 * 60, Closes: 2 * 60}}
+	closedSaturday.Weekly[time.Saturday] = []OpeningPeriod{{Opens: 10 * 60, Closes: 18 * 60}}
+
+	// Same, but closed on Friday 2024-06-07 instead.
+	closedFriday := closedSaturday
+	closedFriday.Exceptions = map[string][]OpeningPeriod{"2024-06-07": {}}
+
+	allDay := OpeningHours{TimeZone: "Europe/Paris"}
+	allDay.Weekly[time.Sunday] = []OpeningPeriod{{Opens: 0, Closes: 0}}
+
+	cases := []struct {
+		name  string
+		hours OpeningHours
+		at    string
+		want  bool
+	}{
+		// 22:00 CET to 04:00 CEST lasts 5 hours.
+		{"before the night the clocks move forward", saturdayNights, "2024-03-30T20:59:00Z", false},
+		{"opening the night the clocks move forward", saturdayNights, "2024-03-30T21:00:00Z", true},
+		{"at 03:59 CEST", saturdayNights, "2024-03-31T01:59:00Z", true},
+		{"closing at 04:00 CEST", saturdayNights, "2024-03-31T02:00:00Z", false},
+		// 22:00 CEST to 04:00 CET lasts 7 hours.
+		{"opening the night the clocks move back", saturdayNights, "2024-10-26T20:00:00Z", true},
+		{"at the second 02:30", saturdayNights, "2024-10-27T01:30:00Z", true},
+		{"at 03:30 CET", saturdayNights, "2024-10-27T02:30:00Z", true},
+		{"closing at 04:00 CET", saturdayNights, "2024-10-27T03:00:00Z", false},
+		// 22:00 to 02:00 CEST.
+		{"before 22:00", closedSaturday, "2024-06-14T19:59:00Z", false},
+		{"at 22:00", closedSaturday, "2024-06-14T20:00:00Z", true},
+		{"after midnight", closedSaturday, "2024-06-14T23:59:00Z", true},
+		{"at 02:00", closedSaturday, "2024-06-15T00:00:00Z", false},
+		{"on a usual Saturday", closedSaturday, "2024-06-15T10:00:00Z", true},
+		// The exception replaces the periods opening on 2024-06-08, not the one opened on Friday.
+		{"after midnight before a closed day", closedSaturday, "2024-06-07T23:00:00Z", true},
+		{"during the closed day", closedSaturday, "2024-06-08T10:00:00Z", false},
+		{"after midnight of a closed day", closedFriday, "2024-06-07T23:00:00Z", false},
+		{"the day after a closed day", closedFriday, "2024-06-08T10:00:00Z", true},
+		{"00:00 to 00:00 at midnight", allDay, "2024-06-08T22:00:00Z", true},
+		{"00:00 to 00:00 at 23:59", allDay, "2024-06-09T21:59:00Z", true},
+		{"00:00 to 00:00 the next day", allDay, "2024-06-09T22:00:00Z", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.hours.OpenAt(mustTime(t, tc.at)); got != tc.want {
+				t.Fatalf("OpenAt(%s) = %v, want %v", tc.at, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	DB "rabietf.me/go-assignment/db"
+)
+
+// Returned by Save when the product already has as many images as allowed.
+var ErrTooManyImages = errors.New("the product has too many images")
+
+type ProductImage struct {
+	ID        int64
+	ProductID int64
+	// Key of the image in the blob store.
+	BlobKey     string
+	ContentType string
+	Width       int
+	Height      int
+	Size        int64
+	// Images of a product are listed by increasing position, new ones go last.
+	Position  int
+	CreatedAt time.Time
+}
+
+const productImageColumns = "id, product_id, blob_key, content_type, width, height, size, position, created_at"
+
+func (image *ProductImage) scan(row interface{ Scan(...any) error }) error {
+	return row.Scan(&image.ID, &image.ProductID, &image.BlobKey, &image.ContentType, &image.Width, &image.Height, &image.Size, &image.Position, &image.CreatedAt)
+}
+
+func (image ProductImage) auditState() auditState {
+	return auditState{"product_id": image.ProductID, "blob_key": image.BlobKey, "content_type": image.ContentType, "width": image.Width, "height": image.Height, "size": image.Size, "position": image.Position}
+}
+
+// Helper function that bumps the version of a product whose images changed, so its ETag changes too.
+func touchProduct(tx *sql.Tx, productID int64) error {
+	_, err := tx.Exec("UPDATE Products SET version=version+1, updated_at=? WHERE id=?", now(), productID)
+
+	return err
+}
+
+// Method for inserting new image in database after the other images of its product, recorded in the audit log as done by actor.
+// The product must have less than maxPerProduct images.
+// Returns (image, nil) with its ID and position if successful.
+// Returns (ProductImage{}, ErrTooManyImages) if the product has too many images.
+// Returns (ProductImage{}, err) if failed.
+func (image ProductImage) Save(actor Actor, maxPerProduct int) (ProductImage, error) {
+	err := inTransaction(func(tx *sql.Tx) error {
+		// Locks the product so concurrent uploads get distinct positions and can't exceed the limit together.
+		var productID int64
+
+		if err := tx.QueryRow("SELECT id FROM Products WHERE id = ? FOR UPDATE", image.ProductID).Scan(&productID); err != nil {
+			return err
+		}
+
+		var count, last int
+
+		row := tx.QueryRow("SELECT COUNT(*), COALESCE(MAX(position), 0) FROM ProductImages WHERE product_id = ?", image.ProductID)
+
+		if err := row.Scan(&count, &last); err != nil {
+			return err
+		}
+
+		if count >= maxPerProduct {
+			return ErrTooManyImages
+		}
+
+		image.Position = last + 1
+		image.CreatedAt = now()
+
+		result, err := tx.Exec("INSERT INTO ProductImages (product_id, blob_key, content_type, width, height, size, position, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+			image.ProductID, image.BlobKey, image.ContentType, image.Width, image.Height, image.Size, image.Position, image.CreatedAt)
+
+		if err != nil {
+			return err
+		}
+		if image.ID, err = result.LastInsertId(); err != nil {
+			return err
+		}
+
+		if err := touchProduct(tx, image.ProductID); err != nil {
+			return err
+		}
+
+		return writeAudit(tx, actor, "product_image", image.ID, AuditCreate, nil, image.auditState())
+	})
+
+	if err != nil {
+		return ProductImage{}, err
+	}
+
+	return image, nil
+}
+
+// Method for finding image of a product in database using id.
+// Returns (true, nil) and puts image in object if it exists and belongs to the product.
+// Returns (false, nil) if it doesn't exist.
+// Returns (false, err) if something went wrong.
+func (image *ProductImage) FindByIdAndProduct(ID, productID int64) (bool, error) {
+	row := DB.Connection.QueryRow("SELECT "+productImageColumns+" FROM ProductImages WHERE id = ? AND product_id = ?", ID, productID)
+
+	if err := image.scan(row); err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Method for finding the images of a product in database, in order.
+// Returns (images, nil) if successful, an empty list if there are none.
+// Returns (nil, err) if something went wrong.
+func (image ProductImage) FindAllByProduct(productID int64) ([]ProductImage, error) {
+	images, err := findImagesOfProducts([]int64{productID})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if images[productID] == nil {
+		return []ProductImage{}, nil
+	}
+
+	return images[productID], nil
+}
+
+// Helper function that finds the images of several products at once, in order, by product ID.
+func findImagesOfProducts(productIDs []int64) (map[int64][]ProductImage, error) {
+	images := make(map[int64][]ProductImage)
+
+	if len(productIDs) == 0 {
+		return images, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(productIDs)), ",")
+	args := make([]interface{}, len(productIDs))
+	for i, id := range productIDs {
+		args[i] = id
+	}
+
+	rows, err := DB.Connection.Query("SELECT "+productImageColumns+" FROM ProductImages WHERE product_id IN ("+placeholders+") ORDER BY position, id", args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var img ProductImage
+		if err := img.scan(rows); err != nil {
+			return nil, err
+		}
+		images[img.ProductID] = append(images[img.ProductID], img)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return images, nil
+}
+
+// Function that fills the Images of the products with one query.
+// Returns nil if success.
+// Returns error otherwise
+func LoadProductImages(products []Product) error {
+	ids := make([]int64, len(products))
+	for i, product := range products {
+		ids[i] = product.ID
+	}
+
+	images, err := findImagesOfProducts(ids)
+
+	if err != nil {
+		return err
+	}
+
+	for i := range products {
+		products[i].Images = images[products[i].ID]
+
+		if products[i].Images == nil {
+			products[i].Images = []ProductImage{}
+		}
+	}
+
+	return nil
+}
+
+// Method for deleting an image in database, recorded in the audit log as done by actor.
+// The blob itself must be removed from the blob store by the caller.
+// Returns nil if success.
+// Returns error otherwise
+func (image ProductImage) Delete(actor Actor) error {
+	return inTransaction(func(tx *sql.Tx) error {
+		result, err := tx.Exec("DELETE FROM ProductImages WHERE id=?", image.ID)
+
+		if err != nil {
+			return err
+		}
+
+		if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+			return err
+		}
+
+		if err := touchProduct(tx, image.ProductID); err != nil {
+			return err
+		}
+
+		return writeAudit(tx, actor, "product_image", image.ID, AuditDelete, image.auditState(), nil)
+	})
+}
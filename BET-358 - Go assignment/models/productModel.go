@@ -2,6 +2,9 @@ package models
 
 import (
 	"database/sql"
+	"regexp"
+	"strings"
+	"time"
 
 	DB "rabietf.me/go-assignment/db"
 )
@@ -12,34 +15,121 @@ type Product struct {
 	Name        string
 	Description string
 	Categories  string
+	// Incremented by every update, used for optimistic concurrency and as ETag.
+	Version int64
+	// Number and sum of the ratings of the reviews, maintained by the reviews, which increment the version.
+	RatingCount int64
+	RatingSum   int64
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	// Not a column, filled by LoadProductImages.
+	Images []ProductImage
 }
 
-// Method for inserting new product in database.
+// Criteria of FindAllByShop, zero values are ignored except for ShopID.
+type ProductFilter struct {
+	ShopID int64
+	// Products in any of these categories.
+	Categories []string
+	// Text contained in the name.
+	Query string
+	// Only the products after this one, to get the next page.
+	AfterID int64
+	Limit   int
+}
+
+const productColumns = "id, shop_id, name, description, categories, version, rating_count, rating_sum, created_at, updated_at"
+
+func (product *Product) scan(row interface{ Scan(...any) error }) error {
+	return row.Scan(&product.ID, &product.ShopID, &product.Name, &product.Description, &product.Categories, &product.Version, &product.RatingCount, &product.RatingSum, &product.CreatedAt, &product.UpdatedAt)
+}
+
+// Fields of the unique indexes of the products.
+var productUniqueFields = map[string]string{"name_per_shop": "name"}
+
+func (product Product) auditState() auditState {
+	return auditState{"shop_id": product.ShopID, "name": product.Name, "description": product.Description, "categories": product.Categories, "version": product.Version}
+}
+
+// Method for inserting new product in database, recorded in the audit log as done by actor.
 // Returns (productId, nil) if successful.
+// Returns (0, DuplicateError) if another product of the shop has the name.
 // Returns (0, err) if failed.
-func (product Product) Save() (int64, error) {
-	result, err := DB.Connection.Exec("INSERT INTO Products (shop_id, name, description, categories) VALUES (?, ?, ?, ?)", product.ShopID, product.Name, product.Description, product.Categories)
+func (product Product) Save(actor Actor) (int64, error) {
+	var id int64
+
+	err := inTransaction(func(tx *sql.Tx) error {
+		var err error
+		id, err = product.SaveTx(tx, actor)
+		return err
+	})
+
+	return id, err
+}
+
+// Same as Save, within the transaction tx.
+func (product Product) SaveTx(tx *sql.Tx, actor Actor) (int64, error) {
+	product.CreatedAt = now()
+	product.UpdatedAt = product.CreatedAt
+
+	result, err := tx.Exec("INSERT INTO Products (shop_id, name, description, categories, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)", product.ShopID, product.Name, product.Description, product.Categories, product.CreatedAt, product.UpdatedAt)
 
 	if err != nil {
-		return 0, err
+		return 0, duplicateError(err, productUniqueFields)
 	}
 	id, err := result.LastInsertId()
 	if err != nil {
 		return 0, err
 	}
 
+	product.Version = 1
+
+	if err := writeAudit(tx, actor, "product", id, AuditCreate, nil, product.auditState()); err != nil {
+		return 0, err
+	}
+
 	return id, nil
 }
 
+// Function for inserting many products in database in one transaction, recorded in the audit log as done by actor.
+// A product having the name of another one doesn't stop the others, what is committed afterwards depends on mode (see RunBatch).
+// Returns (ids, errs, nil), ids[i] being the ID of products[i], or 0 if it wasn't saved, and errs[i] its DuplicateError if it failed.
+// Returns (nil, nil, err) if something else went wrong, nothing is saved then.
+func SaveProducts(actor Actor, products []Product, mode BatchMode) ([]int64, []error, error) {
+	ids := make([]int64, len(products))
+	writes := make([]func(tx *sql.Tx) error, len(products))
+
+	for i := range products {
+		i := i
+		writes[i] = func(tx *sql.Tx) error {
+			var err error
+			ids[i], err = products[i].SaveTx(tx, actor)
+			return err
+		}
+	}
+
+	committed, errs, err := RunBatch(writes, mode)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !committed {
+		return make([]int64, len(products)), errs, nil
+	}
+
+	return ids, errs, nil
+}
+
 // Method for finding product in database using id.
 // Returns (true, nil) and puts product in object if product exists.
 // Returns (false, nil) if product doesn't exist.
 // Returns (false, err) if something went wrong.
 func (product *Product) FindById(ID int64) (bool, error) {
 
-	row := DB.Connection.QueryRow("SELECT * FROM Products WHERE ID = ?", ID)
+	row := DB.Connection.QueryRow("SELECT "+productColumns+" FROM Products WHERE id = ?", ID)
 
-	if err := row.Scan(&product.ID, &product.ShopID, &product.Name, &product.Description, &product.Categories); err != nil {
+	if err := product.scan(row); err != nil {
 		if err == sql.ErrNoRows {
 			return false, nil
 		}
@@ -49,13 +139,86 @@ func (product *Product) FindById(ID int64) (bool, error) {
 	return true, nil
 }
 
-// Method for finding all products in database.
+// Method for finding all products in database, or only the ones updated since the given time if it isn't zero.
 // Returns (products, nil) if successful.
 // Returns (nil, err) if something went wrong.
-func (product Product) FindAll() ([]Product, error) {
-	var products []Product
+func (product Product) FindAll(updatedSince time.Time) ([]Product, error) {
+	clause, args := updatedSinceClause(updatedSince)
 
-	rows, err := DB.Connection.Query("SELECT * FROM Products")
+	return queryProducts("SELECT "+productColumns+" FROM Products"+clause, args...)
+}
+
+// Method for finding a page of the products of a shop in database, by ascending ID through the index on (shop_id, id).
+// Returns (products, nil) if successful, an empty list if there are none.
+// Returns (nil, err) if something went wrong.
+func (product Product) FindAllByShop(filter ProductFilter) ([]Product, error) {
+	conditions := []string{"shop_id = ?"}
+	args := []any{filter.ShopID}
+
+	if len(filter.Categories) > 0 {
+		// categories holds names separated by commas, possibly surrounded by spaces.
+		quoted := make([]string, len(filter.Categories))
+		for i, category := range filter.Categories {
+			quoted[i] = regexp.QuoteMeta(category)
+		}
+
+		conditions = append(conditions, "categories REGEXP ?")
+		args = append(args, "(^|,)[[:space:]]*("+strings.Join(quoted, "|")+")[[:space:]]*(,|$)")
+	}
+
+	if filter.Query != "" {
+		conditions = append(conditions, "name LIKE ?")
+		args = append(args, "%"+escapeLike(filter.Query)+"%")
+	}
+
+	if filter.AfterID != 0 {
+		conditions = append(conditions, "id > ?")
+		args = append(args, filter.AfterID)
+	}
+
+	args = append(args, filter.Limit)
+
+	return queryProducts("SELECT "+productColumns+" FROM Products WHERE "+strings.Join(conditions, " AND ")+" ORDER BY id LIMIT ?", args...)
+}
+
+// Method for going through all the products of a shop in database by ascending ID, without loading them all in memory.
+// Calls fn with each product, and stops at its first error.
+// Returns nil if successful.
+// Returns the error of fn, or err if something went wrong.
+func (product Product) ForEachInShop(shopID int64, fn func(Product) error) error {
+	rows, err := DB.Connection.Query("SELECT "+productColumns+" FROM Products WHERE shop_id = ? ORDER BY id", shopID)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var prd Product
+		if err := prd.scan(rows); err != nil {
+			return err
+		}
+		if err := fn(prd); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// Helper function that escapes the wildcards of a LIKE pattern, so that text is matched literally.
+func escapeLike(text string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(text)
+}
+
+// Helper function that runs a query selecting productColumns.
+// Returns (products, nil) if successful, an empty list if there are none.
+// Returns (nil, err) if something went wrong.
+func queryProducts(query string, args ...any) ([]Product, error) {
+	products := []Product{}
+
+	rows, err := DB.Connection.Query(query, args...)
 
 	if err != nil {
 		return nil, err
@@ -65,7 +228,7 @@ func (product Product) FindAll() ([]Product, error) {
 
 	for rows.Next() {
 		var prd Product
-		if err := rows.Scan(&prd.ID, &prd.ShopID, &prd.Name, &prd.Description, &prd.Categories); err != nil {
+		if err := prd.scan(rows); err != nil {
 			return nil, err
 		}
 		products = append(products, prd)
@@ -78,30 +241,61 @@ func (product Product) FindAll() ([]Product, error) {
 	return products, nil
 }
 
-// Method for updating an element in database
-// Takes new data as paramater, updates the data of the ID in the connected object.
+// Method for updating an element in database, recorded in the audit log as done by actor.
+// Takes new data as paramater, updates the data of the ID in the connected object, if it is still at the version of the connected object.
 // Returns nil if success.
+// Returns ErrStaleVersion if the product was updated or deleted since it was read.
+// Returns DuplicateError if another product of the shop has the name.
 // Returns error otherwise
-func (product Product) Update(newProduct Product) error {
-	_, err := DB.Connection.Exec("UPDATE Products SET name=?, description=?, categories=? WHERE id=?", newProduct.Name, newProduct.Description, newProduct.Categories, product.ID)
+func (product Product) Update(actor Actor, newProduct Product) error {
+	return inTransaction(func(tx *sql.Tx) error {
+		return product.UpdateTx(tx, actor, newProduct)
+	})
+}
+
+// Same as Update, within the transaction tx.
+func (product Product) UpdateTx(tx *sql.Tx, actor Actor, newProduct Product) error {
+	result, err := tx.Exec("UPDATE Products SET name=?, description=?, categories=?, version=version+1, updated_at=? WHERE id=? AND version=?", newProduct.Name, newProduct.Description, newProduct.Categories, now(), product.ID, product.Version)
 
 	if err != nil {
+		return duplicateError(err, productUniqueFields)
+	}
+
+	if err := checkVersionedWrite(result); err != nil {
 		return err
 	}
 
-	return nil
+	updated := product
+	updated.Name = newProduct.Name
+	updated.Description = newProduct.Description
+	updated.Categories = newProduct.Categories
+	updated.Version++
+
+	return writeAudit(tx, actor, "product", product.ID, AuditUpdate, product.auditState(), updated.auditState())
 }
 
-// Method for deleting an element in database
-// Uses ID of object to delete said data.
+// Method for deleting an element in database, recorded in the audit log as done by actor.
+// Uses ID of object to delete said data, if it is still at the version of the object.
 // Returns nil if success.
+// Returns ErrStaleVersion if the product was updated or deleted since it was read.
 // Returns error otherwise
-func (product Product) Delete() error {
-	_, err := DB.Connection.Exec("DELETE FROM Products WHERE id=?", product.ID)
+func (product Product) Delete(actor Actor) error {
+	return inTransaction(func(tx *sql.Tx) error {
+		return product.DeleteTx(tx, actor)
+	})
+}
+
+// Same as Delete, within the transaction tx.
+func (product Product) DeleteTx(tx *sql.Tx, actor Actor) error {
+	result, err := tx.Exec("DELETE FROM Products WHERE id=? AND version=?", product.ID, product.Version)
 
 	if err != nil {
 		return err
 	}
 
-	return nil
+	if err := checkVersionedWrite(result); err != nil {
+		return err
+	}
+
+	return writeAudit(tx, actor, "product", product.ID, AuditDelete, product.auditState(), nil)
 }
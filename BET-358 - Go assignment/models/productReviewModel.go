@@ -0,0 +1,268 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	DB "rabietf.me/go-assignment/db"
+)
+
+// Returned when the user already reviewed the product.
+var ErrDuplicateReview = DuplicateError{Field: "product_id"}
+
+// Orders of the reviews of a product.
+const (
+	ReviewsNewest  = "newest"
+	ReviewsOldest  = "oldest"
+	ReviewsHighest = "highest"
+	ReviewsLowest  = "lowest"
+)
+
+// A review of a product by a user, who can only review each product once.
+type ProductReview struct {
+	ID        int64
+	ProductID int64
+	UserID    int64
+	// From 1 to 5 stars.
+	Rating    int
+	Text      string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Criteria of FindAllByProduct.
+type ReviewFilter struct {
+	ProductID int64
+	// One of ReviewsNewest (default), ReviewsOldest, ReviewsHighest and ReviewsLowest, ties being broken by ID in the same direction.
+	Sort string
+	// Only the reviews after this one in the order, to get the next page. Ignored if its ID is 0.
+	After ProductReview
+	Limit int
+}
+
+const productReviewColumns = "id, product_id, user_id, rating, text, created_at, updated_at"
+
+func (review *ProductReview) scan(row interface{ Scan(...any) error }) error {
+	return row.Scan(&review.ID, &review.ProductID, &review.UserID, &review.Rating, &review.Text, &review.CreatedAt, &review.UpdatedAt)
+}
+
+func (review ProductReview) auditState() auditState {
+	return auditState{"product_id": review.ProductID, "user_id": review.UserID, "rating": review.Rating, "text": review.Text}
+}
+
+// Fields of the unique indexes of the reviews.
+var reviewUniqueFields = map[string]string{"review_per_user": "product_id"}
+
+// Helper function that adds count reviews and sum stars to the ratings of a product.
+// The rating is part of the product, so its version and updated_at change with it, like with any other update.
+func addRating(tx *sql.Tx, productID int64, count, sum int) error {
+	_, err := tx.Exec("UPDATE Products SET rating_count=rating_count+?, rating_sum=rating_sum+?, version=version+1, updated_at=? WHERE id=?", count, sum, now(), productID)
+
+	return err
+}
+
+// Helper function that locks the review with the given ID until the end of the transaction tx.
+// Returns (review, nil) with its current state if it exists.
+// Returns (ProductReview{}, ErrStaleVersion) if it was deleted since it was read.
+// Returns (ProductReview{}, err) if something went wrong.
+func lockReview(tx *sql.Tx, ID int64) (ProductReview, error) {
+	var review ProductReview
+
+	if err := review.scan(tx.QueryRow("SELECT "+productReviewColumns+" FROM ProductReviews WHERE id=? FOR UPDATE", ID)); err != nil {
+		if err == sql.ErrNoRows {
+			return ProductReview{}, ErrStaleVersion
+		}
+		return ProductReview{}, err
+	}
+
+	return review, nil
+}
+
+// Method for inserting new review in database and adding its rating to its product, recorded in the audit log as done by actor.
+// Returns (reviewId, nil) if successful.
+// Returns (0, ErrDuplicateReview) if the user already reviewed the product.
+// Returns (0, err) if failed.
+func (review ProductReview) Save(actor Actor) (int64, error) {
+	var id int64
+
+	err := inTransaction(func(tx *sql.Tx) error {
+		var err error
+		id, err = review.SaveTx(tx, actor)
+		return err
+	})
+
+	return id, err
+}
+
+// Same as Save, within the transaction tx.
+func (review ProductReview) SaveTx(tx *sql.Tx, actor Actor) (int64, error) {
+	review.CreatedAt = now()
+	review.UpdatedAt = review.CreatedAt
+
+	result, err := tx.Exec("INSERT INTO ProductReviews (product_id, user_id, rating, text, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)",
+		review.ProductID, review.UserID, review.Rating, review.Text, review.CreatedAt, review.UpdatedAt)
+
+	if err != nil {
+		return 0, duplicateError(err, reviewUniqueFields)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := addRating(tx, review.ProductID, 1, review.Rating); err != nil {
+		return 0, err
+	}
+
+	if err := writeAudit(tx, actor, "product_review", id, AuditCreate, nil, review.auditState()); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// Method for finding review of a product in database using id.
+// Returns (true, nil) and puts review in object if it exists and belongs to the product.
+// Returns (false, nil) if it doesn't exist.
+// Returns (false, err) if something went wrong.
+func (review *ProductReview) FindByIdAndProduct(ID, productID int64) (bool, error) {
+	row := DB.Connection.QueryRow("SELECT "+productReviewColumns+" FROM ProductReviews WHERE id = ? AND product_id = ?", ID, productID)
+
+	if err := review.scan(row); err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Method for finding a page of the reviews of a product in database, in the order of filter.Sort.
+// Returns (reviews, nil) if successful, an empty list if there are none.
+// Returns (nil, err) if something went wrong.
+func (review ProductReview) FindAllByProduct(filter ReviewFilter) ([]ProductReview, error) {
+	reviews := []ProductReview{}
+
+	conditions := []string{"product_id = ?"}
+	args := []any{filter.ProductID}
+	var order string
+
+	switch filter.Sort {
+	case ReviewsOldest:
+		order = "id ASC"
+		if filter.After.ID != 0 {
+			conditions = append(conditions, "id > ?")
+			args = append(args, filter.After.ID)
+		}
+	case ReviewsHighest:
+		order = "rating DESC, id DESC"
+		if filter.After.ID != 0 {
+			conditions = append(conditions, "(rating < ? OR (rating = ? AND id < ?))")
+			args = append(args, filter.After.Rating, filter.After.Rating, filter.After.ID)
+		}
+	case ReviewsLowest:
+		order = "rating ASC, id ASC"
+		if filter.After.ID != 0 {
+			conditions = append(conditions, "(rating > ? OR (rating = ? AND id > ?))")
+			args = append(args, filter.After.Rating, filter.After.Rating, filter.After.ID)
+		}
+	default:
+		order = "id DESC"
+		if filter.After.ID != 0 {
+			conditions = append(conditions, "id < ?")
+			args = append(args, filter.After.ID)
+		}
+	}
+
+	args = append(args, filter.Limit)
+
+	rows, err := DB.Connection.Query("SELECT "+productReviewColumns+" FROM ProductReviews WHERE "+strings.Join(conditions, " AND ")+" ORDER BY "+order+" LIMIT ?", args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var r ProductReview
+		if err := r.scan(rows); err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reviews, nil
+}
+
+// Method for updating a review in database and the rating of its product, recorded in the audit log as done by actor.
+// Takes new data as paramater, updates the rating and text of the ID in the connected object.
+// Returns nil if success.
+// Returns ErrStaleVersion if the review was deleted since it was read.
+// Returns error otherwise
+func (review ProductReview) Update(actor Actor, newReview ProductReview) error {
+	return inTransaction(func(tx *sql.Tx) error {
+		return review.UpdateTx(tx, actor, newReview)
+	})
+}
+
+// Same as Update, within the transaction tx.
+func (review ProductReview) UpdateTx(tx *sql.Tx, actor Actor, newReview ProductReview) error {
+	// The review may have changed since it was read: the product gets the difference with the current rating,
+	// and the audit log the current state as before.
+	current, err := lockReview(tx, review.ID)
+
+	if err != nil {
+		return err
+	}
+
+	updated := current
+	updated.Rating = newReview.Rating
+	updated.Text = newReview.Text
+	updated.UpdatedAt = now()
+
+	if _, err := tx.Exec("UPDATE ProductReviews SET rating=?, text=?, updated_at=? WHERE id=?", updated.Rating, updated.Text, updated.UpdatedAt, current.ID); err != nil {
+		return err
+	}
+
+	if err := addRating(tx, current.ProductID, 0, updated.Rating-current.Rating); err != nil {
+		return err
+	}
+
+	return writeAudit(tx, actor, "product_review", current.ID, AuditUpdate, current.auditState(), updated.auditState())
+}
+
+// Method for deleting a review in database and removing its rating from its product, recorded in the audit log as done by actor.
+// Returns nil if success.
+// Returns ErrStaleVersion if the review was deleted since it was read.
+// Returns error otherwise
+func (review ProductReview) Delete(actor Actor) error {
+	return inTransaction(func(tx *sql.Tx) error {
+		return review.DeleteTx(tx, actor)
+	})
+}
+
+// Same as Delete, within the transaction tx.
+func (review ProductReview) DeleteTx(tx *sql.Tx, actor Actor) error {
+	current, err := lockReview(tx, review.ID)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM ProductReviews WHERE id=?", current.ID); err != nil {
+		return err
+	}
+
+	if err := addRating(tx, current.ProductID, -1, -current.Rating); err != nil {
+		return err
+	}
+
+	return writeAudit(tx, actor, "product_review", current.ID, AuditDelete, current.auditState(), nil)
+}
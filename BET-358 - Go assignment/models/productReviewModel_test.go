@@ -0,0 +1,111 @@
+package models
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// Matches the changes column of an audit entry.
+type auditChanges map[string]FieldChange
+
+func (want auditChanges) Match(value driver.Value) bool {
+	raw, ok := value.([]byte)
+
+	if !ok {
+		return false
+	}
+
+	var got map[string]FieldChange
+
+	if err := json.Unmarshal(raw, &got); err != nil {
+		return false
+	}
+
+	// Numbers come back as float64 from JSON.
+	normalized, _ := json.Marshal(map[string]FieldChange(want))
+	var expected map[string]FieldChange
+	json.Unmarshal(normalized, &expected)
+
+	return reflect.DeepEqual(got, expected)
+}
+
+// Helper function that runs fn in a transaction of a mock database.
+func inMockTransaction(t *testing.T, expect func(mock sqlmock.Sqlmock), fn func(tx *sql.Tx) error) {
+	connection, mock, err := sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer connection.Close()
+
+	mock.ExpectBegin()
+	expect(mock)
+	mock.ExpectCommit()
+
+	tx, err := connection.Begin()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fn(tx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func lockedReviewRows(rating int, text string) *sqlmock.Rows {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	return sqlmock.NewRows([]string{"id", "product_id", "user_id", "rating", "text", "created_at", "updated_at"}).AddRow(int64(9), int64(5), int64(2), rating, text, now, now)
+}
+
+func TestReviewUpdateAuditsLockedState(t *testing.T) {
+	// Read before another request changed the rating to 2 and the text to "meh".
+	read := ProductReview{ID: 9, ProductID: 5, UserID: 2, Rating: 4, Text: "good"}
+
+	inMockTransaction(t, func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(regexp.QuoteMeta("FROM ProductReviews WHERE id=? FOR UPDATE")).WithArgs(int64(9)).WillReturnRows(lockedReviewRows(2, "meh"))
+		mock.ExpectExec(regexp.QuoteMeta("UPDATE ProductReviews SET rating=?, text=?, updated_at=? WHERE id=?")).
+			WithArgs(5, "great", sqlmock.AnyArg(), int64(9)).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(regexp.QuoteMeta("UPDATE Products SET rating_count=rating_count+?, rating_sum=rating_sum+?, version=version+1, updated_at=? WHERE id=?")).
+			WithArgs(0, 3, sqlmock.AnyArg(), int64(5)).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO AuditLog")).
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "product_review", int64(9), AuditUpdate,
+				auditChanges{"rating": {Before: 2, After: 5}, "text": {Before: "meh", After: "great"}}, sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+	}, func(tx *sql.Tx) error {
+		return read.UpdateTx(tx, Actor{UserID: 2}, ProductReview{Rating: 5, Text: "great"})
+	})
+}
+
+func TestReviewDeleteRemovesLockedRating(t *testing.T) {
+	read := ProductReview{ID: 9, ProductID: 5, UserID: 2, Rating: 4, Text: "good"}
+
+	inMockTransaction(t, func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery(regexp.QuoteMeta("FROM ProductReviews WHERE id=? FOR UPDATE")).WithArgs(int64(9)).WillReturnRows(lockedReviewRows(2, "meh"))
+		mock.ExpectExec(regexp.QuoteMeta("DELETE FROM ProductReviews WHERE id=?")).WithArgs(int64(9)).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(regexp.QuoteMeta("version=version+1, updated_at=?")).WithArgs(-1, -2, sqlmock.AnyArg(), int64(5)).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO AuditLog")).
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "product_review", int64(9), AuditDelete,
+				auditChanges{"product_id": {Before: 5}, "user_id": {Before: 2}, "rating": {Before: 2}, "text": {Before: "meh"}}, sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+	}, func(tx *sql.Tx) error {
+		return read.DeleteTx(tx, Actor{UserID: 2})
+	})
+}
@@ -0,0 +1,214 @@
+package models
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	DB "rabietf.me/go-assignment/db"
+)
+
+var (
+	// Returned when another variant of the shop has the same SKU.
+	ErrDuplicateSKU = DuplicateError{Field: "sku"}
+	// Returned when another variant of the product has the same option values.
+	ErrDuplicateOptions = DuplicateError{Field: "options"}
+)
+
+// A purchasable version of a product, like the M size of a red T-shirt.
+type ProductVariant struct {
+	ID        int64
+	ProductID int64
+	// Shop of the product, SKUs are unique per shop.
+	ShopID int64
+	SKU    string
+	// Value of each option of the product, like {"size": "M", "color": "red"}.
+	Options    map[string]string
+	PriceCents int64
+	Stock      int64
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+const productVariantColumns = "id, product_id, shop_id, sku, options, price_cents, stock, created_at, updated_at"
+
+func (variant *ProductVariant) scan(row interface{ Scan(...any) error }) error {
+	var options []byte
+
+	if err := row.Scan(&variant.ID, &variant.ProductID, &variant.ShopID, &variant.SKU, &options, &variant.PriceCents, &variant.Stock, &variant.CreatedAt, &variant.UpdatedAt); err != nil {
+		return err
+	}
+
+	return json.Unmarshal(options, &variant.Options)
+}
+
+func (variant ProductVariant) auditState() auditState {
+	return auditState{"product_id": variant.ProductID, "sku": variant.SKU, "options": variant.Options, "price_cents": variant.PriceCents, "stock": variant.Stock}
+}
+
+// Helper function that returns the options as stored: JSON with sorted keys, and its SHA-256 for the unique index.
+func (variant ProductVariant) optionsKey() (string, []byte, error) {
+	options := variant.Options
+
+	if options == nil {
+		options = map[string]string{}
+	}
+
+	bytes, err := json.Marshal(options)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	hash := sha256.Sum256(bytes)
+
+	return string(bytes), hash[:], nil
+}
+
+// Fields of the unique indexes of the variants.
+var variantUniqueFields = map[string]string{"sku_per_shop": "sku", "options_per_product": "options"}
+
+// Method for inserting new variant in database, recorded in the audit log as done by actor.
+// Returns (variantId, nil) if successful.
+// Returns (0, ErrDuplicateSKU or ErrDuplicateOptions) if it conflicts with another variant.
+// Returns (0, err) if failed.
+func (variant ProductVariant) Save(actor Actor) (int64, error) {
+	var id int64
+
+	err := inTransaction(func(tx *sql.Tx) error {
+		var err error
+		id, err = variant.SaveTx(tx, actor)
+		return err
+	})
+
+	return id, err
+}
+
+// Same as Save, within the transaction tx.
+func (variant ProductVariant) SaveTx(tx *sql.Tx, actor Actor) (int64, error) {
+	options, optionsHash, err := variant.optionsKey()
+
+	if err != nil {
+		return 0, err
+	}
+
+	variant.CreatedAt = now()
+	variant.UpdatedAt = variant.CreatedAt
+
+	result, err := tx.Exec("INSERT INTO ProductVariants (product_id, shop_id, sku, options, options_hash, price_cents, stock, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		variant.ProductID, variant.ShopID, variant.SKU, options, optionsHash, variant.PriceCents, variant.Stock, variant.CreatedAt, variant.UpdatedAt)
+
+	if err != nil {
+		return 0, duplicateError(err, variantUniqueFields)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := writeAudit(tx, actor, "product_variant", id, AuditCreate, nil, variant.auditState()); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// Method for finding variant of a product in database using id.
+// Returns (true, nil) and puts variant in object if it exists and belongs to the product.
+// Returns (false, nil) if it doesn't exist.
+// Returns (false, err) if something went wrong.
+func (variant *ProductVariant) FindByIdAndProduct(ID, productID int64) (bool, error) {
+	row := DB.Connection.QueryRow("SELECT "+productVariantColumns+" FROM ProductVariants WHERE id = ? AND product_id = ?", ID, productID)
+
+	if err := variant.scan(row); err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Method for finding the variants of a product in database.
+// Returns (variants, nil) if successful, an empty list if there are none.
+// Returns (nil, err) if something went wrong.
+func (variant ProductVariant) FindAllByProduct(productID int64) ([]ProductVariant, error) {
+	variants := []ProductVariant{}
+
+	rows, err := DB.Connection.Query("SELECT "+productVariantColumns+" FROM ProductVariants WHERE product_id = ? ORDER BY id", productID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var v ProductVariant
+		if err := v.scan(rows); err != nil {
+			return nil, err
+		}
+		variants = append(variants, v)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return variants, nil
+}
+
+// Method for updating a variant in database, recorded in the audit log as done by actor.
+// Takes new data as paramater, updates the SKU, options, price and stock of the ID in the connected object.
+// Returns nil if success.
+// Returns ErrDuplicateSKU or ErrDuplicateOptions if it conflicts with another variant.
+// Returns error otherwise
+func (variant ProductVariant) Update(actor Actor, newVariant ProductVariant) error {
+	return inTransaction(func(tx *sql.Tx) error {
+		return variant.UpdateTx(tx, actor, newVariant)
+	})
+}
+
+// Same as Update, within the transaction tx.
+func (variant ProductVariant) UpdateTx(tx *sql.Tx, actor Actor, newVariant ProductVariant) error {
+	options, optionsHash, err := newVariant.optionsKey()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE ProductVariants SET sku=?, options=?, options_hash=?, price_cents=?, stock=?, updated_at=? WHERE id=?",
+		newVariant.SKU, options, optionsHash, newVariant.PriceCents, newVariant.Stock, now(), variant.ID)
+
+	if err != nil {
+		return duplicateError(err, variantUniqueFields)
+	}
+
+	updated := variant
+	updated.SKU = newVariant.SKU
+	updated.Options = newVariant.Options
+	updated.PriceCents = newVariant.PriceCents
+	updated.Stock = newVariant.Stock
+
+	return writeAudit(tx, actor, "product_variant", variant.ID, AuditUpdate, variant.auditState(), updated.auditState())
+}
+
+// Method for deleting a variant in database, recorded in the audit log as done by actor.
+// Returns nil if success.
+// Returns error otherwise
+func (variant ProductVariant) Delete(actor Actor) error {
+	return inTransaction(func(tx *sql.Tx) error {
+		return variant.DeleteTx(tx, actor)
+	})
+}
+
+// Same as Delete, within the transaction tx.
+func (variant ProductVariant) DeleteTx(tx *sql.Tx, actor Actor) error {
+	if _, err := tx.Exec("DELETE FROM ProductVariants WHERE id=?", variant.ID); err != nil {
+		return err
+	}
+
+	return writeAudit(tx, actor, "product_variant", variant.ID, AuditDelete, variant.auditState(), nil)
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+)
+
+func TestVariantOptionsKey(t *testing.T) {
+	// Same options, added in different orders.
+	first := map[string]string{}
+	first["size"] = "M"
+	first["color"] = "red"
+	first["fit"] = "slim"
+
+	second := map[string]string{}
+	second["fit"] = "slim"
+	second["color"] = "red"
+	second["size"] = "M"
+
+	want := `{"color":"red","fit":"slim","size":"M"}`
+	wantHash := sha256.Sum256([]byte(want))
+
+	for i := 0; i < 10; i++ {
+		for _, options := range []map[string]string{first, second} {
+			key, hash, err := ProductVariant{Options: options}.optionsKey()
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The unique index options_per_product is on the hash, equal options must give the same one.
+			if key != want || !bytes.Equal(hash, wantHash[:]) {
+				t.Fatalf("got %s (%x), want %s (%x)", key, hash, want, wantHash)
+			}
+		}
+	}
+
+	other, otherHash, err := ProductVariant{Options: map[string]string{"color": "red", "fit": "slim", "size": "L"}}.optionsKey()
+
+	if err != nil || other == want || bytes.Equal(otherHash, wantHash[:]) {
+		t.Fatalf("other options gave %s (%x, %v)", other, otherHash, err)
+	}
+
+	// Variants without options are stored as an empty object, not null.
+	empty := sha256.Sum256([]byte("{}"))
+
+	for _, options := range []map[string]string{nil, {}} {
+		key, hash, err := ProductVariant{Options: options}.optionsKey()
+
+		if err != nil || key != "{}" || !bytes.Equal(hash, empty[:]) {
+			t.Fatalf("%v: got %s (%x, %v), want {}", options, key, hash, err)
+		}
+	}
+}
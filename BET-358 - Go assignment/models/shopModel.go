@@ -2,31 +2,124 @@ package models
 
 import (
 	"database/sql"
+	"math"
+	"time"
 
 	DB "rabietf.me/go-assignment/db"
 )
 
 type Shop struct {
-	ID      int64
-	Name    string
+	ID   int64
+	Name string
+	// Global handle of the shop, usable instead of its ID.
+	Slug    string
 	Address string
+	// nil when the shop wasn't located.
+	Location *GeoPoint
+	// nil when the shop didn't give them.
+	Hours   *OpeningHours
 	OwnerID int64
+	// Incremented by every update, used for optimistic concurrency and as ETag.
+	Version   int64
+	CreatedAt time.Time
+	UpdatedAt time.Time
 }
 
-// Method for inserting new shop in database.
+// Coordinates on Earth, in degrees.
+type GeoPoint struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// Radius of the Earth used for distances, in kilometers.
+const earthRadiusKm = 6371.0
+
+// A shop found by FindNearby, with its distance to the searched point.
+type NearbyShop struct {
+	Shop
+	DistanceKm float64
+}
+
+// Fields of the unique indexes of the shops.
+var shopUniqueFields = map[string]string{"slug": "slug", "name_per_address": "name"}
+
+const shopColumns = "id, name, slug, address, latitude, longitude, opening_hours, owned_by, version, created_at, updated_at"
+
+// Scans shopColumns, then the extra columns of the query into extra.
+func (shop *Shop) scan(row interface{ Scan(...any) error }, extra ...any) error {
+	var latitude, longitude sql.NullFloat64
+	var hours *string
+
+	dest := append([]any{&shop.ID, &shop.Name, &shop.Slug, &shop.Address, &latitude, &longitude, &hours, &shop.OwnerID, &shop.Version, &shop.CreatedAt, &shop.UpdatedAt}, extra...)
+
+	if err := row.Scan(dest...); err != nil {
+		return err
+	}
+
+	if latitude.Valid && longitude.Valid {
+		shop.Location = &GeoPoint{Latitude: latitude.Float64, Longitude: longitude.Float64}
+	}
+
+	var err error
+	shop.Hours, err = parseOpeningHours(hours)
+
+	return err
+}
+
+// Helper function that returns the latitude and longitude columns of a location, NULL when there is none.
+func locationColumns(location *GeoPoint) (sql.NullFloat64, sql.NullFloat64) {
+	if location == nil {
+		return sql.NullFloat64{}, sql.NullFloat64{}
+	}
+
+	return sql.NullFloat64{Float64: location.Latitude, Valid: true}, sql.NullFloat64{Float64: location.Longitude, Valid: true}
+}
+
+func (shop Shop) auditState() auditState {
+	latitude, longitude := locationColumns(shop.Location)
+
+	return auditState{"name": shop.Name, "slug": shop.Slug, "address": shop.Address, "latitude": auditFloat(latitude), "longitude": auditFloat(longitude), "opening_hours": shop.Hours, "owner_id": shop.OwnerID, "version": shop.Version}
+}
+
+// Method for inserting new shop in database, recorded in the audit log as done by actor.
 // Returns (shopId, nil) if successful.
+// Returns (0, DuplicateError) if another shop has the slug, or the name at the same address.
 // Returns (0, err) if failed.
-func (shop Shop) Save() (int64, error) {
-	result, err := DB.Connection.Exec("INSERT INTO Shops (name, address, owned_by) VALUES (?, ?, ?)", shop.Name, shop.Address, shop.OwnerID)
+func (shop Shop) Save(actor Actor) (int64, error) {
+	var id int64
+
+	err := inTransaction(func(tx *sql.Tx) error {
+		var err error
+		id, err = shop.SaveTx(tx, actor)
+		return err
+	})
+
+	return id, err
+}
+
+// Same as Save, within the transaction tx.
+func (shop Shop) SaveTx(tx *sql.Tx, actor Actor) (int64, error) {
+	shop.CreatedAt = now()
+	shop.UpdatedAt = shop.CreatedAt
+
+	latitude, longitude := locationColumns(shop.Location)
+
+	result, err := tx.Exec("INSERT INTO Shops (name, slug, address, latitude, longitude, owned_by, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)", shop.Name, shop.Slug, shop.Address, latitude, longitude, shop.OwnerID, shop.CreatedAt, shop.UpdatedAt)
 
 	if err != nil {
-		return 0, err
+		return 0, duplicateError(err, shopUniqueFields)
 	}
 	id, err := result.LastInsertId()
 	if err != nil {
 		return 0, err
 	}
 
+	shop.Version = 1
+
+	if err := writeAudit(tx, actor, "shop", id, AuditCreate, nil, shop.auditState()); err != nil {
+		return 0, err
+	}
+
 	return id, nil
 }
 
@@ -36,9 +129,27 @@ func (shop Shop) Save() (int64, error) {
 // Returns (false, err) if something went wrong.
 func (shop *Shop) FindById(ID int64) (bool, error) {
 
-	row := DB.Connection.QueryRow("SELECT * FROM Shops WHERE ID = ?", ID)
+	row := DB.Connection.QueryRow("SELECT "+shopColumns+" FROM Shops WHERE id = ?", ID)
+
+	if err := shop.scan(row); err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Method for finding shop in database using its slug.
+// Returns (true, nil) and puts shop in object if shop exists.
+// Returns (false, nil) if shop doesn't exist.
+// Returns (false, err) if something went wrong.
+func (shop *Shop) FindBySlug(slug string) (bool, error) {
+
+	row := DB.Connection.QueryRow("SELECT "+shopColumns+" FROM Shops WHERE slug = ?", slug)
 
-	if err := row.Scan(&shop.ID, &shop.Name, &shop.Address, &shop.OwnerID); err != nil {
+	if err := shop.scan(row); err != nil {
 		if err == sql.ErrNoRows {
 			return false, nil
 		}
@@ -48,13 +159,93 @@ func (shop *Shop) FindById(ID int64) (bool, error) {
 	return true, nil
 }
 
-// Method for finding all shops in database.
+// Method for finding all shops in database, or only the ones updated since the given time if it isn't zero.
 // Returns (shops, nil) if successful.
 // Returns (nil, err) if something went wrong.
-func (shop Shop) FindAll() ([]Shop, error) {
-	var shops []Shop
+func (shop Shop) FindAll(updatedSince time.Time) ([]Shop, error) {
+	clause, args := updatedSinceClause(updatedSince)
 
-	rows, err := DB.Connection.Query("SELECT * FROM Shops")
+	return queryShops("SELECT "+shopColumns+" FROM Shops"+clause, args...)
+}
+
+// Method for finding the shops of an owner in database, through the index on owned_by.
+// Returns (shops, nil) if successful, an empty list if there are none.
+// Returns (nil, err) if something went wrong.
+func (shop Shop) FindAllByOwner(ownerID int64) ([]Shop, error) {
+	return queryShops("SELECT "+shopColumns+" FROM Shops WHERE owned_by = ? ORDER BY id", ownerID)
+}
+
+// Helper function that returns the SQL condition of the box around center containing the circle of radiusKm, with its arguments.
+// The box goes over the poles and the antimeridian when the circle does, so it can miss nothing.
+func boundingBox(center GeoPoint, radiusKm float64) (string, []any) {
+	angle := radiusKm / earthRadiusKm
+	deltaLat := angle * 180 / math.Pi
+	minLat, maxLat := center.Latitude-deltaLat, center.Latitude+deltaLat
+
+	// A pole is in the circle: every longitude is.
+	if minLat <= -90 || maxLat >= 90 {
+		return "latitude BETWEEN ? AND ? AND longitude IS NOT NULL", []any{math.Max(minLat, -90), math.Min(maxLat, 90)}
+	}
+
+	// Widest longitude difference of the circle, reached north or south of the center, see
+	// http://janmatuschek.de/LatitudeLongitudeBoundingCoordinates.
+	deltaLng := math.Asin(math.Sin(angle)/math.Cos(center.Latitude*math.Pi/180)) * 180 / math.Pi
+	minLng, maxLng := center.Longitude-deltaLng, center.Longitude+deltaLng
+
+	switch {
+	case minLng < -180:
+		return "latitude BETWEEN ? AND ? AND (longitude >= ? OR longitude <= ?)", []any{minLat, maxLat, minLng + 360, maxLng}
+	case maxLng > 180:
+		return "latitude BETWEEN ? AND ? AND (longitude >= ? OR longitude <= ?)", []any{minLat, maxLat, minLng, maxLng - 360}
+	default:
+		return "latitude BETWEEN ? AND ? AND longitude BETWEEN ? AND ?", []any{minLat, maxLat, minLng, maxLng}
+	}
+}
+
+// Method for finding the located shops within radiusKm of center in database, nearest first.
+// The shops in the bounding box of the circle are selected through the index on (latitude, longitude),
+// then their great-circle distance is computed with the haversine formula.
+// Returns (shops, nil) if successful, at most limit, an empty list if there are none.
+// Returns (nil, err) if something went wrong.
+func (shop Shop) FindNearby(center GeoPoint, radiusKm float64, limit int) ([]NearbyShop, error) {
+	shops := []NearbyShop{}
+
+	box, boxArgs := boundingBox(center, radiusKm)
+
+	distance := "2 * ? * ASIN(LEAST(1, SQRT(POW(SIN(RADIANS(latitude - ?) / 2), 2) + COS(RADIANS(?)) * COS(RADIANS(latitude)) * POW(SIN(RADIANS(longitude - ?) / 2), 2))))"
+	args := append([]any{earthRadiusKm, center.Latitude, center.Latitude, center.Longitude}, boxArgs...)
+	args = append(args, radiusKm, limit)
+
+	rows, err := DB.Connection.Query("SELECT "+shopColumns+", "+distance+" AS distance FROM Shops WHERE "+box+" HAVING distance <= ? ORDER BY distance, id LIMIT ?", args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var shp NearbyShop
+		if err := shp.scan(rows, &shp.DistanceKm); err != nil {
+			return nil, err
+		}
+		shops = append(shops, shp)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return shops, nil
+}
+
+// Helper function that runs a query selecting shopColumns.
+// Returns (shops, nil) if successful, an empty list if there are none.
+// Returns (nil, err) if something went wrong.
+func queryShops(query string, args ...any) ([]Shop, error) {
+	shops := []Shop{}
+
+	rows, err := DB.Connection.Query(query, args...)
 
 	if err != nil {
 		return nil, err
@@ -64,39 +255,113 @@ func (shop Shop) FindAll() ([]Shop, error) {
 
 	for rows.Next() {
 		var shp Shop
-		if err := rows.Scan(&shp.ID, &shp.Name, &shp.Address, &shp.OwnerID); err != nil {
+		if err := shp.scan(rows); err != nil {
 			return nil, err
 		}
 		shops = append(shops, shp)
 	}
 
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
 	return shops, nil
 }
 
-// Method for updating an element in database
-// Takes new data as paramater, updates the data of the ID in the connected object.
+// Method for updating an element in database, recorded in the audit log as done by actor.
+// Takes new data as paramater, updates the data of the ID in the connected object, if it is still at the version of the connected object.
+// Returns nil if success.
+// Returns ErrStaleVersion if the shop was updated or deleted since it was read.
+// Returns DuplicateError if another shop has the slug, or the name at the same address.
+// Returns error otherwise
+func (shop Shop) Update(actor Actor, newShop Shop) error {
+	return inTransaction(func(tx *sql.Tx) error {
+		return shop.UpdateTx(tx, actor, newShop)
+	})
+}
+
+// Same as Update, within the transaction tx.
+func (shop Shop) UpdateTx(tx *sql.Tx, actor Actor, newShop Shop) error {
+	latitude, longitude := locationColumns(newShop.Location)
+
+	result, err := tx.Exec("UPDATE Shops SET name=?, slug=?, address=?, latitude=?, longitude=?, version=version+1, updated_at=? WHERE id=? AND version=?", newShop.Name, newShop.Slug, newShop.Address, latitude, longitude, now(), shop.ID, shop.Version)
+
+	if err != nil {
+		return duplicateError(err, shopUniqueFields)
+	}
+
+	if err := checkVersionedWrite(result); err != nil {
+		return err
+	}
+
+	updated := shop
+	updated.Name = newShop.Name
+	updated.Slug = newShop.Slug
+	updated.Address = newShop.Address
+	updated.Location = newShop.Location
+	updated.Version++
+
+	return writeAudit(tx, actor, "shop", shop.ID, AuditUpdate, shop.auditState(), updated.auditState())
+}
+
+// Method for replacing the opening hours of a shop in database, nil removing them, recorded in the audit log as done by actor.
+// Updates the ID in the connected object, if it is still at the version of the connected object.
 // Returns nil if success.
+// Returns ErrStaleVersion if the shop was updated or deleted since it was read.
 // Returns error otherwise
-func (shop Shop) Update(newShop Shop) error {
-	_, err := DB.Connection.Exec("UPDATE Shops SET name=?, address=? WHERE id=?", newShop.Name, newShop.Address, shop.ID)
+func (shop Shop) UpdateHours(actor Actor, hours *OpeningHours) error {
+	return inTransaction(func(tx *sql.Tx) error {
+		return shop.UpdateHoursTx(tx, actor, hours)
+	})
+}
+
+// Same as UpdateHours, within the transaction tx.
+func (shop Shop) UpdateHoursTx(tx *sql.Tx, actor Actor, hours *OpeningHours) error {
+	column, err := hours.column()
+
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("UPDATE Shops SET opening_hours=?, version=version+1, updated_at=? WHERE id=? AND version=?", column, now(), shop.ID, shop.Version)
 
 	if err != nil {
 		return err
 	}
 
-	return nil
+	if err := checkVersionedWrite(result); err != nil {
+		return err
+	}
+
+	updated := shop
+	updated.Hours = hours
+	updated.Version++
+
+	return writeAudit(tx, actor, "shop", shop.ID, AuditUpdate, shop.auditState(), updated.auditState())
 }
 
-// Method for deleting an element in database
-// Uses ID of object to delete said data.
+// Method for deleting an element in database, recorded in the audit log as done by actor.
+// Uses ID of object to delete said data, if it is still at the version of the object.
 // Returns nil if success.
+// Returns ErrStaleVersion if the shop was updated or deleted since it was read.
 // Returns error otherwise
-func (shop Shop) Delete() error {
-	_, err := DB.Connection.Exec("DELETE FROM Shops WHERE id=?", shop.ID)
+func (shop Shop) Delete(actor Actor) error {
+	return inTransaction(func(tx *sql.Tx) error {
+		return shop.DeleteTx(tx, actor)
+	})
+}
+
+// Same as Delete, within the transaction tx.
+func (shop Shop) DeleteTx(tx *sql.Tx, actor Actor) error {
+	result, err := tx.Exec("DELETE FROM Shops WHERE id=? AND version=?", shop.ID, shop.Version)
 
 	if err != nil {
 		return err
 	}
 
-	return nil
+	if err := checkVersionedWrite(result); err != nil {
+		return err
+	}
+
+	return writeAudit(tx, actor, "shop", shop.ID, AuditDelete, shop.auditState(), nil)
 }
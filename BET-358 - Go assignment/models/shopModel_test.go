@@ -0,0 +1,148 @@
+package models
+
+import (
+	"database/sql/driver"
+	"math"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	DB "rabietf.me/go-assignment/db"
+)
+
+// Helper function that returns the point at distanceKm of start in the direction of bearing, in degrees from the north.
+func destination(start GeoPoint, distanceKm, bearing float64) GeoPoint {
+	angle := distanceKm / earthRadiusKm
+	lat1, lng1, theta := start.Latitude*math.Pi/180, start.Longitude*math.Pi/180, bearing*math.Pi/180
+
+	lat2 := math.Asin(math.Sin(lat1)*math.Cos(angle) + math.Cos(lat1)*math.Sin(angle)*math.Cos(theta))
+	lng2 := lng1 + math.Atan2(math.Sin(theta)*math.Sin(angle)*math.Cos(lat1), math.Cos(angle)-math.Sin(lat1)*math.Sin(lat2))
+
+	// Back between -180 and 180.
+	lng := math.Mod(lng2*180/math.Pi+540, 360) - 180
+
+	return GeoPoint{Latitude: lat2 * 180 / math.Pi, Longitude: lng}
+}
+
+// Helper function that evaluates the condition returned by boundingBox for point, like the database would.
+func inBox(t *testing.T, condition string, args []any, point GeoPoint) bool {
+	bound := func(i int) float64 { return args[i].(float64) }
+	inLatitudes := point.Latitude >= bound(0) && point.Latitude <= bound(1)
+
+	switch {
+	case strings.HasSuffix(condition, "longitude IS NOT NULL"):
+		return inLatitudes
+	case strings.HasSuffix(condition, "(longitude >= ? OR longitude <= ?)"):
+		return inLatitudes && (point.Longitude >= bound(2) || point.Longitude <= bound(3))
+	case strings.HasSuffix(condition, "longitude BETWEEN ? AND ?"):
+		return inLatitudes && point.Longitude >= bound(2) && point.Longitude <= bound(3)
+	}
+
+	t.Fatalf("unexpected condition %q", condition)
+	return false
+}
+
+func TestBoundingBox(t *testing.T) {
+	const (
+		between      = "latitude BETWEEN ? AND ? AND longitude BETWEEN ? AND ?"
+		antimeridian = "latitude BETWEEN ? AND ? AND (longitude >= ? OR longitude <= ?)"
+		pole         = "latitude BETWEEN ? AND ? AND longitude IS NOT NULL"
+	)
+
+	cases := []struct {
+		name      string
+		center    GeoPoint
+		radiusKm  float64
+		condition string
+		args      []float64
+	}{
+		// 10 km are 0.0899° of latitude, and 0.0899° / cos(48.8559°) of longitude.
+		{"Paris", GeoPoint{48.8559, 2.3580}, 10, between, []float64{48.7660, 48.9458, 2.2213, 2.4947}},
+		{"east of the antimeridian", GeoPoint{-17.7, 179.95}, 20, antimeridian, []float64{-17.8799, -17.5201, 179.7612, -179.8612}},
+		{"west of the antimeridian", GeoPoint{-17.7, -179.95}, 20, antimeridian, []float64{-17.8799, -17.5201, 179.8612, -179.7612}},
+		{"north pole in the circle", GeoPoint{89.95, 20}, 10, pole, []float64{89.8601, 90}},
+		{"south pole in the circle", GeoPoint{-89.95, -120}, 10, pole, []float64{-90, -89.8601}},
+		{"whole Earth", GeoPoint{0, 0}, 20100, pole, []float64{-90, 90}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			condition, args := boundingBox(tc.center, tc.radiusKm)
+
+			if condition != tc.condition || len(args) != len(tc.args) {
+				t.Fatalf("got %q with %v, want %q with %v", condition, args, tc.condition, tc.args)
+			}
+
+			for i, want := range tc.args {
+				if got := args[i].(float64); math.Abs(got-want) > 1e-4 {
+					t.Fatalf("got %v, want %v", args, tc.args)
+				}
+			}
+
+			// Nothing of the circle is left out of the box.
+			for bearing := 0.0; bearing < 360; bearing += 5 {
+				for _, distance := range []float64{tc.radiusKm * 0.5, tc.radiusKm * 0.999} {
+					if point := destination(tc.center, distance, bearing); !inBox(t, condition, args, point) {
+						t.Fatalf("%+v at %.0f km and %.0f° is out of the box", point, distance, bearing)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestShopFindNearby(t *testing.T) {
+	connection, mock, err := sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previous := DB.Connection
+	DB.Connection = connection
+
+	t.Cleanup(func() {
+		DB.Connection = previous
+		connection.Close()
+	})
+
+	center := GeoPoint{Latitude: 48.8559, Longitude: 2.3580}
+	_, box := boundingBox(center, 5)
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	// The distance takes the radius of the Earth, then the latitude of the center twice and its longitude, the box, the radius and the limit follow.
+	args := []driver.Value{earthRadiusKm, center.Latitude, center.Latitude, center.Longitude}
+	for _, arg := range box {
+		args = append(args, arg)
+	}
+	args = append(args, 5.0, 20)
+
+	columns := []string{"id", "name", "slug", "address", "latitude", "longitude", "opening_hours", "owned_by", "version", "created_at", "updated_at", "distance"}
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT " + shopColumns + ", 2 * ? * ASIN(LEAST(1, SQRT(POW(SIN(RADIANS(latitude - ?) / 2), 2) + COS(RADIANS(?)) * COS(RADIANS(latitude)) * POW(SIN(RADIANS(longitude - ?) / 2), 2)))) AS distance " +
+		"FROM Shops WHERE latitude BETWEEN ? AND ? AND longitude BETWEEN ? AND ? HAVING distance <= ? ORDER BY distance, id LIMIT ?")).
+		WithArgs(args...).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(int64(1), "Bakery", "bakery", "1 rue de Rivoli, 75001 Paris", 48.8559, 2.3580, nil, int64(7), int64(1), now, now, 0.0).
+			AddRow(int64(2), "Cheese", "cheese", "99 rue de Rivoli, 75001 Paris", 48.8606, 2.3376, nil, int64(7), int64(1), now, now, 1.57))
+
+	var shop Shop
+	shops, err := shop.FindNearby(center, 5, 20)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(shops) != 2 || shops[0].ID != 1 || shops[1].ID != 2 || shops[1].DistanceKm != 1.57 {
+		t.Fatalf("got %+v, want the bakery then the cheese shop at 1.57 km", shops)
+	}
+
+	if location := shops[1].Location; location == nil || *location != (GeoPoint{Latitude: 48.8606, Longitude: 2.3376}) {
+		t.Fatalf("got location %v", location)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
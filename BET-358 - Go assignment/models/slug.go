@@ -0,0 +1,67 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Maximum length of a slug.
+const MaxSlugLength = 64
+
+// Helper function that checks whether slug is made of lowercase letters and digits separated by single dashes.
+// Only digits isn't valid, so that a slug is never mistaken for an ID.
+func ValidSlug(slug string) bool {
+	if slug == "" || len(slug) > MaxSlugLength || slug[0] == '-' || slug[len(slug)-1] == '-' || strings.Contains(slug, "--") {
+		return false
+	}
+
+	for _, r := range slug {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-') {
+			return false
+		}
+	}
+
+	_, err := strconv.ParseInt(slug, 10, 64)
+
+	return err != nil
+}
+
+// Helper function that derives a valid slug from a name: "Joe's Burgers" gives "joe-s-burgers".
+// fallback is used when the name has no letter nor digit, and prefixes names made only of digits.
+func Slugify(name, fallback string) string {
+	var builder strings.Builder
+	dash := false
+
+	for _, r := range strings.ToLower(name) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			if dash && builder.Len() > 0 {
+				builder.WriteByte('-')
+			}
+			builder.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+
+	slug := builder.String()
+
+	if slug == "" {
+		return fallback
+	}
+
+	if _, err := strconv.ParseInt(slug, 10, 64); err == nil {
+		slug = fallback + "-" + slug
+	}
+
+	return TruncateSlug(slug, MaxSlugLength)
+}
+
+// Helper function that shortens slug to at most length characters, without leaving a dash at its end.
+func TruncateSlug(slug string, length int) string {
+	if len(slug) > length {
+		slug = strings.TrimRight(slug[:length], "-")
+	}
+
+	return slug
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Helper function that returns the time stored in created_at and updated_at columns, which have a precision of one second.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
+
+// Helper function that returns the WHERE and ORDER BY clauses of a list filtered on updated_at, and their arguments.
+// Lists are ordered by id, or from the least to the most recently updated row if since isn't zero,
+// so a client syncing incrementally can resume from the updated_at of the last row it got.
+// Deleted rows aren't there anymore, Deletion.FindAll lists them from the audit log.
+func updatedSinceClause(since time.Time) (string, []interface{}) {
+	if since.IsZero() {
+		return " ORDER BY id", nil
+	}
+
+	return " WHERE updated_at >= ? ORDER BY updated_at, id", []interface{}{since.UTC()}
+}
@@ -2,27 +2,102 @@ package models
 
 import (
 	"database/sql"
+	"time"
 
 	DB "rabietf.me/go-assignment/db"
 )
 
 type User struct {
-	ID       int64
-	Name     string
-	Email    string
+	ID    int64
+	Name  string
+	Email string
+	// Empty for accounts created through an OpenID Connect provider, stored as NULL.
 	Password string
+	// RoleUser or RoleAdmin, admins are only made directly in the database.
+	Role string
+	// Issuer and subject (sub) of the OpenID Connect identity linked to the account, empty if there is none, stored as NULL.
+	OIDCIssuer  string
+	OIDCSubject string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
 }
 
-// Method for inserting new user in database.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+const userColumns = "id, name, email, password, role, oidc_issuer, oidc_subject, created_at, updated_at"
+
+func (user *User) scan(row interface{ Scan(...any) error }) error {
+	var password, issuer, subject sql.NullString
+
+	if err := row.Scan(&user.ID, &user.Name, &user.Email, &password, &user.Role, &issuer, &subject, &user.CreatedAt, &user.UpdatedAt); err != nil {
+		return err
+	}
+
+	user.Password = password.String
+	user.OIDCIssuer = issuer.String
+	user.OIDCSubject = subject.String
+
+	return nil
+}
+
+// Helper function that returns a string column, NULL when it is empty.
+func nullString(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
+
+func (user User) auditState() auditState {
+	return auditState{"name": user.Name, "email": user.Email, "password": redacted(user.Password), "role": user.Role, "oidc_issuer": user.OIDCIssuer, "oidc_subject": user.OIDCSubject}
+}
+
+// Helper function that finds one user in database.
+// Returns (true, nil) and puts user data in object if user exists.
+// Returns (false, nil) if user doesn't exist.
+// Returns (false, err) if something went wrong.
+func (user *User) findOne(query string, args ...any) (bool, error) {
+	if err := user.scan(DB.Connection.QueryRow("SELECT "+userColumns+" FROM Users WHERE "+query, args...)); err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Method for inserting new user in database, recorded in the audit log as done by actor, or by the user himself if actor is anonymous.
 // Returns (userId, nil) if successful.
 // Returns (0, err) if failed.
-func (user User) Save() (int64, error) {
-	result, err := DB.Connection.Exec("INSERT INTO Users (name, email, password) VALUES (?, ?, ?)", user.Name, user.Email, user.Password)
-
-	if err != nil {
-		return 0, err
+func (user User) Save(actor Actor) (int64, error) {
+	if user.Role == "" {
+		user.Role = RoleUser
 	}
-	id, err := result.LastInsertId()
+
+	user.CreatedAt = now()
+	user.UpdatedAt = user.CreatedAt
+
+	var id int64
+
+	err := inTransaction(func(tx *sql.Tx) error {
+		result, err := tx.Exec("INSERT INTO Users (name, email, password, role, oidc_issuer, oidc_subject, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+			user.Name, user.Email, nullString(user.Password), user.Role, nullString(user.OIDCIssuer), nullString(user.OIDCSubject), user.CreatedAt, user.UpdatedAt)
+
+		if err != nil {
+			return err
+		}
+		if id, err = result.LastInsertId(); err != nil {
+			return err
+		}
+
+		if actor.UserID == 0 {
+			actor.UserID = id
+		}
+
+		return writeAudit(tx, actor, "user", id, AuditCreate, nil, user.auditState())
+	})
+
 	if err != nil {
 		return 0, err
 	}
@@ -35,15 +110,63 @@ func (user User) Save() (int64, error) {
 // Returns (false, nil) if user doesn't exist.
 // Returns (false, err) if something went wrong.
 func (user *User) Find(email string) (bool, error) {
+	return user.findOne("email = ?", email)
+}
 
-	row := DB.Connection.QueryRow("SELECT * FROM Users WHERE email = ?", email)
+// Method for finding user in database using id.
+// Returns (true, nil) and puts user data in object if user exists.
+// Returns (false, nil) if user doesn't exist.
+// Returns (false, err) if something went wrong.
+func (user *User) FindById(ID int64) (bool, error) {
+	return user.findOne("id = ?", ID)
+}
 
-	if err := row.Scan(&user.ID, &user.Name, &user.Email, &user.Password); err != nil {
-		if err == sql.ErrNoRows {
-			return false, nil
+// Method for finding the user linked to an OpenID Connect identity, by the issuer and subject of the provider.
+// Returns (true, nil) and puts user data in object if user exists.
+// Returns (false, nil) if no user is linked to it.
+// Returns (false, err) if something went wrong.
+func (user *User) FindByOIDCSubject(issuer, subject string) (bool, error) {
+	return user.findOne("oidc_issuer = ? AND oidc_subject = ?", issuer, subject)
+}
+
+// Method for replacing the password hash of the user in database, used when the hash must be upgraded.
+// Recorded in the audit log as done by actor, the hashes themselves aren't.
+// Returns nil if success.
+// Returns error otherwise
+func (user User) UpdatePassword(actor Actor, hashedPassword string) error {
+	return inTransaction(func(tx *sql.Tx) error {
+		if _, err := tx.Exec("UPDATE Users SET password=?, updated_at=? WHERE id=?", hashedPassword, now(), user.ID); err != nil {
+			return err
 		}
-		return false, err
-	}
 
-	return true, nil
+		updated := user
+		updated.Password = hashedPassword
+
+		return writeAudit(tx, actor, "user", user.ID, AuditUpdate, user.auditState(), updated.auditState())
+	})
+}
+
+// Method for linking an OpenID Connect identity to the account in database, if it isn't linked to one yet.
+// Recorded in the audit log as done by actor.
+// Returns nil if success.
+// Returns ErrStaleVersion if the account was linked to an identity since it was read.
+// Returns error otherwise
+func (user User) LinkOIDC(actor Actor, issuer, subject string) error {
+	return inTransaction(func(tx *sql.Tx) error {
+		result, err := tx.Exec("UPDATE Users SET oidc_issuer=?, oidc_subject=?, updated_at=? WHERE id=? AND oidc_subject IS NULL", issuer, subject, now(), user.ID)
+
+		if err != nil {
+			return err
+		}
+
+		if err := checkVersionedWrite(result); err != nil {
+			return err
+		}
+
+		updated := user
+		updated.OIDCIssuer = issuer
+		updated.OIDCSubject = subject
+
+		return writeAudit(tx, actor, "user", user.ID, AuditUpdate, user.auditState(), updated.auditState())
+	})
 }
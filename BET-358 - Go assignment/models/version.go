@@ -0,0 +1,25 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// Returned when updating or deleting a row that changed since it was read.
+var ErrStaleVersion = errors.New("the row was modified since it was read")
+
+// Helper function that checks that an update or delete guarded by "AND version=?" found its row.
+// Returns ErrStaleVersion if it didn't.
+func checkVersionedWrite(result sql.Result) error {
+	affected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrStaleVersion
+	}
+
+	return nil
+}
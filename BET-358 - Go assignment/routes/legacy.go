@@ -0,0 +1,51 @@
+package routes
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Date the legacy unprefixed paths were deprecated, when the API was mounted under /v1.
+var legacyDeprecation = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+
+// Date after which the legacy unprefixed paths may be removed, can be changed with LEGACY_ROUTES_SUNSET (YYYY-MM-DD).
+var legacySunset = time.Date(2027, time.June, 30, 0, 0, 0, 0, time.UTC)
+
+func init() {
+	if value := os.Getenv("LEGACY_ROUTES_SUNSET"); value != "" {
+		sunset, err := time.Parse("2006-01-02", value)
+
+		if err != nil {
+			log.Fatalf("LEGACY_ROUTES_SUNSET must look like 2006-01-02, got %q", value)
+		}
+
+		legacySunset = sunset
+	}
+}
+
+// Serves the paths of the API from before versioning (/shops...) with the routes of the given version, as a compatibility shim.
+// register is called again on the root, so a legacy request runs the middlewares and the handler of its route once,
+// with the same rate limiters as the versioned path.
+// Their responses carry the Deprecation and Sunset headers, and a Link to the versioned path. Paths that don't exist get the usual 404.
+func registerLegacy(router *gin.Engine, version string, register func(*gin.RouterGroup, groups), shared groups) {
+	register(router.Group("", deprecated(version)), shared)
+}
+
+// Middleware for the legacy paths, announces their deprecation and their versioned path (RFC 9745 and RFC 8594).
+func deprecated(version string) gin.HandlerFunc {
+	deprecation := "@" + strconv.FormatInt(legacyDeprecation.Unix(), 10)
+	sunset := legacySunset.Format(http.TimeFormat)
+
+	return func(c *gin.Context) {
+		c.Header("Deprecation", deprecation)
+		c.Header("Sunset", sunset)
+		c.Header("Link", "<"+version+c.Request.URL.Path+`>; rel="successor-version"`)
+
+		c.Next()
+	}
+}
@@ -0,0 +1,74 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Helper function that returns a router with a global middleware counting the requests it sees, serving GET /v1/ping and its legacy path.
+func legacyRouter(calls *int) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	router.Use(func(c *gin.Context) {
+		*calls++
+		c.Next()
+	})
+
+	register := func(group *gin.RouterGroup, shared groups) {
+		group.GET("/ping", func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"message": "pong"})
+		})
+	}
+
+	register(router.Group("/v1"), groups{})
+	registerLegacy(router, "/v1", register, groups{})
+
+	return router
+}
+
+func TestLegacyPath(t *testing.T) {
+	var calls int
+	w := httptest.NewRecorder()
+	legacyRouter(&calls).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ping", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d, want 200", w.Code)
+	}
+
+	if calls != 1 {
+		t.Fatalf("global middleware ran %d times, want once", calls)
+	}
+
+	if got, want := w.Header().Get("Deprecation"), "@"+strconv.FormatInt(legacyDeprecation.Unix(), 10); got != want {
+		t.Fatalf("got Deprecation %q, want %q", got, want)
+	}
+
+	if got, want := w.Header().Get("Link"), `</v1/ping>; rel="successor-version"`; got != want {
+		t.Fatalf("got Link %q, want %q", got, want)
+	}
+
+	if w.Header().Get("Sunset") == "" {
+		t.Fatal("no Sunset header")
+	}
+}
+
+func TestLegacyHeadersOnlyOnLegacyRoutes(t *testing.T) {
+	for _, path := range []string{"/v1/ping", "/nonexistent", "/v1/nonexistent"} {
+		var calls int
+		w := httptest.NewRecorder()
+		legacyRouter(&calls).ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+		if w.Header().Get("Deprecation") != "" || w.Header().Get("Sunset") != "" || w.Header().Get("Link") != "" {
+			t.Fatalf("%s got deprecation headers %v", path, w.Header())
+		}
+
+		if calls != 1 {
+			t.Fatalf("%s: global middleware ran %d times, want once", path, calls)
+		}
+	}
+}
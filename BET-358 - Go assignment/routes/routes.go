@@ -0,0 +1,114 @@
+package routes
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"rabietf.me/go-assignment/handlers"
+	"rabietf.me/go-assignment/middlewares"
+	"rabietf.me/go-assignment/models"
+	"rabietf.me/go-assignment/services"
+)
+
+// Authentication and rate limiting middlewares shared by all the versions of the API,
+// so a client has the same limits whichever version it calls.
+type groups struct {
+	// Every signup and login hashes a password, which is slow on purpose, so they get the strictest limit.
+	accounts []gin.HandlerFunc
+	public   []gin.HandlerFunc
+	// Authenticated with a JWT.
+	authenticated []gin.HandlerFunc
+	// Authenticated with a JWT or an API key with the products:write scope.
+	productWriters []gin.HandlerFunc
+	// Authenticated with the JWT of an admin.
+	admins []gin.HandlerFunc
+}
+
+func newGroups() groups {
+	return groups{
+		accounts: []gin.HandlerFunc{
+			middlewares.RateLimit(middlewares.RateLimitConfig{Rate: 1.0 / 6, Burst: 10, KeyFunc: middlewares.KeyByIP}),
+		},
+		public: []gin.HandlerFunc{
+			middlewares.RateLimit(middlewares.RateLimitConfig{Rate: 10, Burst: 50, KeyFunc: middlewares.KeyByIP}),
+		},
+		authenticated: []gin.HandlerFunc{
+			middlewares.VerifyAuth(),
+			middlewares.RateLimit(middlewares.RateLimitConfig{Rate: 2, Burst: 20, KeyFunc: middlewares.KeyByUserOrIP}),
+		},
+		productWriters: []gin.HandlerFunc{
+			middlewares.VerifyAPIKeyOrAuth(),
+			middlewares.RequireScope(services.ScopeProductsWrite),
+			middlewares.RateLimit(middlewares.RateLimitConfig{Rate: 5, Burst: 50, KeyFunc: middlewares.KeyByUserOrIP}),
+		},
+		admins: []gin.HandlerFunc{
+			middlewares.VerifyAuth(),
+			middlewares.RequireRole(models.RoleAdmin),
+			middlewares.RateLimit(middlewares.RateLimitConfig{Rate: 2, Burst: 20, KeyFunc: middlewares.KeyByUserOrIP}),
+		},
+	}
+}
+
+// Middleware for the routes whose last segment holds a colon, like /products:batch, which gin reads as a parameter:
+// the route would also match /productsxyz, so anything else than the exact value of the parameter gets the usual 404.
+func exactParam(name, value string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Param(name) != value {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"message": "This route doesn't exist."})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// Helper function that returns the proxies whose X-Forwarded-For and X-Real-IP headers give the IP of the client,
+// from TRUSTED_PROXIES (comma separated IPs or CIDRs like 10.0.0.0/8). None by default: the IP is the one of the connection,
+// otherwise any client could pick the IP the login guard and the rate limits count it under.
+func trustedProxies() []string {
+	var proxies []string
+
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+
+	return proxies
+}
+
+// Registers the middlewares and routes of the API.
+// Every version is mounted under its own prefix (/v1...), the legacy unprefixed paths are served by the v1 handlers (see registerLegacy).
+func Setup() *gin.Engine {
+	router := gin.Default()
+
+	if err := router.SetTrustedProxies(trustedProxies()); err != nil {
+		log.Fatalf("TRUSTED_PROXIES must be comma separated IPs or CIDRs: %v", err)
+	}
+
+	router.Use(middlewares.RequestID())
+	router.Use(middlewares.SecurityHeaders(middlewares.NewSecurityHeadersConfigFromEnv()))
+	router.Use(middlewares.CORS(middlewares.CORSSettings))
+
+	shared := newGroups()
+
+	registerV1(router.Group("/v1"), shared)
+
+	// Routes that aren't part of a version of the API.
+	unversioned := router.Group("", shared.public...)
+	unversioned.GET("/.well-known/jwks.json", handlers.GetJWKS)
+	unversioned.GET("/openapi.json", handlers.GetOpenAPI)
+	unversioned.GET("/docs", handlers.GetSwaggerUI)
+	unversioned.GET("/docs/:file", handlers.GetSwaggerUIFile)
+
+	registerLegacy(router, "/v1", registerV1, shared)
+
+	router.NoRoute(func(c *gin.Context) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "This route doesn't exist."})
+	})
+
+	return router
+}
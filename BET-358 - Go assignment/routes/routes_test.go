@@ -0,0 +1,114 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	DB "rabietf.me/go-assignment/db"
+	"rabietf.me/go-assignment/services"
+)
+
+// Helper function that returns the IP the router of Setup sees for a request from remoteAddr with the given X-Forwarded-For.
+func clientIP(t *testing.T, remoteAddr, forwardedFor string) string {
+	gin.SetMode(gin.TestMode)
+	router := Setup()
+	router.GET("/client-ip", func(c *gin.Context) {
+		c.String(http.StatusOK, c.ClientIP())
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/client-ip", nil)
+	req.RemoteAddr = remoteAddr
+	req.Header.Set("X-Forwarded-For", forwardedFor)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	return w.Body.String()
+}
+
+func TestForwardedForIgnoredByDefault(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "")
+
+	if got := clientIP(t, "192.0.2.1:4321", "203.0.113.9"); got != "192.0.2.1" {
+		t.Fatalf("got client IP %q, want the one of the connection", got)
+	}
+}
+
+func TestForwardedForOfTrustedProxies(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8, 192.0.2.1")
+
+	if got := clientIP(t, "192.0.2.1:4321", "203.0.113.9"); got != "203.0.113.9" {
+		t.Fatalf("got client IP %q, want the one forwarded by the proxy", got)
+	}
+
+	if got := clientIP(t, "198.51.100.3:4321", "203.0.113.9"); got != "198.51.100.3" {
+		t.Fatalf("got client IP %q, want the one of the connection, which isn't a trusted proxy", got)
+	}
+}
+
+// A client changing its X-Forwarded-For on every attempt still gets locked out of the account.
+func TestLoginLockoutWithChangingForwardedFor(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "")
+
+	if err := services.LoadPasswords(); err != nil {
+		t.Fatal(err)
+	}
+
+	connection, mock, err := sqlmock.New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previous := DB.Connection
+	DB.Connection = connection
+
+	t.Cleanup(func() {
+		DB.Connection = previous
+		connection.Close()
+	})
+
+	gin.SetMode(gin.TestMode)
+	router := Setup()
+	// The lockout starts with the failure after the free ones.
+	failures := services.NewLoginGuard(nil).AccountIPPolicy.FreeAttempts + 1
+	columns := []string{"id", "name", "email", "password", "role", "oidc_issuer", "oidc_subject", "created_at", "updated_at"}
+
+	for attempt := 1; ; attempt++ {
+		if attempt <= failures {
+			mock.ExpectQuery(regexp.QuoteMeta("FROM Users WHERE email = ?")).WillReturnRows(sqlmock.NewRows(columns))
+			mock.ExpectExec(regexp.QuoteMeta("INSERT INTO FailedLogins")).WillReturnResult(sqlmock.NewResult(int64(attempt), 1))
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "/v1/login", strings.NewReader(`{"email":"xff-victim@example.com","password":"guess"}`))
+		req.RemoteAddr = "192.0.2.1:4321"
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Forwarded-For", fmt.Sprintf("203.0.113.%d", attempt))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if attempt <= failures {
+			if w.Code != http.StatusUnauthorized {
+				t.Fatalf("attempt %d: got %d, want 401: %s", attempt, w.Code, w.Body)
+			}
+			continue
+		}
+
+		if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+			t.Fatalf("attempt %d: got %d, want 429 with Retry-After", attempt, w.Code)
+		}
+
+		break
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,66 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"rabietf.me/go-assignment/handlers"
+	"rabietf.me/go-assignment/middlewares"
+)
+
+// Registers the routes of the version 1 of the API, mounted at /v1.
+func registerV1(v1 *gin.RouterGroup, shared groups) {
+	accounts := v1.Group("", shared.accounts...)
+	public := v1.Group("", shared.public...)
+	authenticated := v1.Group("", shared.authenticated...)
+	productWriters := v1.Group("", shared.productWriters...)
+	admins := v1.Group("", shared.admins...)
+
+	accounts.POST("/users", handlers.SignUp)
+	accounts.POST("/login", handlers.SignIn)
+	public.POST("/logout", middlewares.VerifyCSRF(), handlers.SignOut)
+	accounts.GET("/auth/oidc/login", handlers.OIDCLogin)
+	accounts.GET("/auth/oidc/callback", handlers.OIDCCallback)
+
+	authenticated.POST("/users/me/api-keys", handlers.CreateApiKey)
+	authenticated.GET("/users/me/api-keys", handlers.GetApiKeys)
+	authenticated.DELETE("/users/me/api-keys/:id", handlers.RevokeApiKey)
+
+	authenticated.POST("/shops", handlers.CreateShop)
+	public.GET("/shops", middlewares.VerifyAuthWhen(handlers.WantsOwnShops), handlers.GetShops)
+	public.GET("/shops/nearby", handlers.GetNearbyShops)
+	public.GET("/shops/:id", handlers.GetShopById)
+	public.GET("/shops/:id/hours", handlers.GetShopHours)
+	public.GET("/shops/:id/products", handlers.GetShopProducts)
+	productWriters.POST("/shops/:id/products/import", handlers.ImportProducts)
+	public.GET("/shops/:id/products/export", handlers.ExportProducts)
+	public.GET("/users/:id/shops", handlers.GetUserShops)
+	authenticated.PUT("/shops/:id", handlers.EditShop)
+	authenticated.DELETE("/shops/:id", handlers.DeleteShop)
+	authenticated.PUT("/shops/:id/hours", handlers.EditShopHours)
+	authenticated.DELETE("/shops/:id/hours", handlers.DeleteShopHours)
+
+	productWriters.POST("/products", handlers.CreateProduct)
+	public.GET("/products", handlers.GetProducts)
+	public.GET("/products/:id", handlers.GetProductById)
+	productWriters.PUT("/products/:id", handlers.EditProduct)
+	productWriters.DELETE("/products/:id", handlers.DeleteProduct)
+	batches := v1.Group("", append([]gin.HandlerFunc{exactParam("batch", ":batch")}, shared.productWriters...)...)
+	batches.POST("/products:batch", handlers.BatchProducts)
+
+	productWriters.POST("/products/:id/images", handlers.UploadProductImage)
+	public.GET("/products/:id/images/:image_id", handlers.GetProductImage)
+	productWriters.DELETE("/products/:id/images/:image_id", handlers.DeleteProductImage)
+	productWriters.POST("/products/:id/variants", handlers.CreateProductVariant)
+	public.GET("/products/:id/variants", handlers.GetProductVariants)
+	public.GET("/products/:id/variants/:variant_id", handlers.GetProductVariant)
+	productWriters.PUT("/products/:id/variants/:variant_id", handlers.EditProductVariant)
+	productWriters.DELETE("/products/:id/variants/:variant_id", handlers.DeleteProductVariant)
+	authenticated.POST("/products/:id/reviews", handlers.CreateProductReview)
+	public.GET("/products/:id/reviews", handlers.GetProductReviews)
+	authenticated.PUT("/products/:id/reviews/:review_id", handlers.EditProductReview)
+	authenticated.DELETE("/products/:id/reviews/:review_id", handlers.DeleteProductReview)
+
+	public.GET("/categories", handlers.GetCategories)
+	public.GET("/deletions", handlers.GetDeletions)
+
+	admins.GET("/admin/audit-log", handlers.GetAuditLog)
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"rabietf.me/go-assignment/models"
+)
+
+// Scopes an API key can be granted.
+const (
+	ScopeProductsWrite = "products:write"
+)
+
+var (
+	KnownScopes = []string{ScopeProductsWrite}
+
+	ErrInvalidAPIKey = errors.New("invalid API key")
+)
+
+// API keys look like ak_<prefix>_<secret>, the prefix being the visible and indexed part.
+const apiKeyTag = "ak"
+
+// Helper function that returns the SHA-256 of an API key, in hexadecimal.
+// The key is long and random, a slow password hash isn't needed.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Returns true if scope is one of the known scopes.
+func IsKnownScope(scope string) bool {
+	for _, known := range KnownScopes {
+		if scope == known {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Helper function that generates a new random API key.
+// The secret is base64url, which can contain underscores: see parseAPIKey.
+// Returns (prefix, key, nil) if successful.
+// Returns ("", "", err) if something went wrong.
+func newAPIKey() (string, string, error) {
+	prefixBytes := make([]byte, 6)
+	secretBytes := make([]byte, 32)
+
+	if _, err := rand.Read(prefixBytes); err != nil {
+		return "", "", err
+	}
+
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", "", err
+	}
+
+	prefix := apiKeyTag + "_" + hex.EncodeToString(prefixBytes)
+
+	return prefix, prefix + "_" + base64.RawURLEncoding.EncodeToString(secretBytes), nil
+}
+
+// Helper function that returns the prefix of an API key, everything after the second underscore being the secret.
+// Returns (prefix, true) if key looks like an API key.
+// Returns ("", false) otherwise.
+func parseAPIKey(key string) (string, bool) {
+	parts := strings.SplitN(key, "_", 3)
+
+	if len(parts) != 3 || parts[0] != apiKeyTag || parts[1] == "" || parts[2] == "" {
+		return "", false
+	}
+
+	return parts[0] + "_" + parts[1], true
+}
+
+// Helper function that checks key against the stored API key with its prefix.
+// Returns true if key hashes to it and it isn't revoked.
+func matchesAPIKey(key string, apiKey models.ApiKey) bool {
+	return !apiKey.RevokedAt.Valid && subtle.ConstantTimeCompare([]byte(hashAPIKey(key)), []byte(apiKey.KeyHash)) == 1
+}
+
+// Service function that creates a new API key for a shop of the user, recorded in the audit log as done by actor.
+// The key is only returned here, only its hash is stored.
+// Returns (key, apiKey, nil) if successful.
+// Returns ("", ApiKey{}, err) if something went wrong.
+func CreateAPIKey(actor models.Actor, userID, shopID int64, name string, scopes []string) (string, models.ApiKey, error) {
+	prefix, key, err := newAPIKey()
+
+	if err != nil {
+		return "", models.ApiKey{}, err
+	}
+
+	apiKey := models.ApiKey{
+		UserID:  userID,
+		ShopID:  shopID,
+		Name:    name,
+		Prefix:  prefix,
+		KeyHash: hashAPIKey(key),
+		Scopes:  strings.Join(scopes, ","),
+		// Stored with a precision of one second.
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+	}
+
+	id, err := apiKey.Save(actor)
+
+	if err != nil {
+		return "", models.ApiKey{}, err
+	}
+
+	apiKey.ID = id
+	apiKey.UpdatedAt = apiKey.CreatedAt
+
+	return key, apiKey, nil
+}
+
+// Service function that authenticates a request made with an API key.
+// Returns (principal, nil) if the key exists, matches and isn't revoked.
+// Returns (Principal{}, ErrInvalidAPIKey) if it doesn't.
+// Returns (Principal{}, err) if something went wrong.
+func AuthenticateAPIKey(key string) (Principal, error) {
+	prefix, ok := parseAPIKey(key)
+
+	if !ok {
+		return Principal{}, ErrInvalidAPIKey
+	}
+
+	var apiKey models.ApiKey
+
+	ok, err := apiKey.FindByPrefix(prefix)
+
+	if err != nil {
+		return Principal{}, err
+	}
+
+	if !ok || !matchesAPIKey(key, apiKey) {
+		return Principal{}, ErrInvalidAPIKey
+	}
+
+	if err := apiKey.Touch(); err != nil {
+		return Principal{}, err
+	}
+
+	return Principal{
+		UserID:   apiKey.UserID,
+		Roles:    []string{"api_key"},
+		APIKeyID: apiKey.ID,
+		ShopID:   apiKey.ShopID,
+		Scopes:   strings.Split(apiKey.Scopes, ","),
+	}, nil
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"rabietf.me/go-assignment/models"
+)
+
+func TestGeneratedAPIKeysAuthenticate(t *testing.T) {
+	withUnderscore := 0
+
+	for i := 0; i < 10000; i++ {
+		prefix, key, err := newAPIKey()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if strings.Contains(strings.TrimPrefix(key, prefix+"_"), "_") {
+			withUnderscore++
+		}
+
+		parsed, ok := parseAPIKey(key)
+
+		if !ok || parsed != prefix {
+			t.Fatalf("key %q: got prefix %q, %v, want %q", key, parsed, ok, prefix)
+		}
+
+		if !matchesAPIKey(key, models.ApiKey{Prefix: prefix, KeyHash: hashAPIKey(key)}) {
+			t.Fatalf("key %q doesn't match its own hash", key)
+		}
+	}
+
+	// Keys with an underscore in their secret are the ones a naive split rejects.
+	if withUnderscore == 0 {
+		t.Fatal("no generated secret contained an underscore")
+	}
+}
+
+func TestParseAPIKey(t *testing.T) {
+	cases := []struct {
+		key    string
+		prefix string
+		ok     bool
+	}{
+		{"ak_0123456789ab_secret", "ak_0123456789ab", true},
+		{"ak_0123456789ab_sec_r_et", "ak_0123456789ab", true},
+		{"ak_0123456789ab", "", false},
+		{"ak__secret", "", false},
+		{"ak_0123456789ab_", "", false},
+		{"sk_0123456789ab_secret", "", false},
+		{"", "", false},
+	}
+
+	for _, tc := range cases {
+		prefix, ok := parseAPIKey(tc.key)
+
+		if prefix != tc.prefix || ok != tc.ok {
+			t.Errorf("parseAPIKey(%q) = %q, %v, want %q, %v", tc.key, prefix, ok, tc.prefix, tc.ok)
+		}
+	}
+}
+
+func TestMatchesAPIKeyRejects(t *testing.T) {
+	_, key, err := newAPIKey()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored := models.ApiKey{KeyHash: hashAPIKey(key)}
+
+	if matchesAPIKey(key+"x", stored) {
+		t.Error("another key matched")
+	}
+
+	stored.RevokedAt = sql.NullTime{Time: time.Now(), Valid: true}
+
+	if matchesAPIKey(key, stored) {
+		t.Error("revoked key matched")
+	}
+}
@@ -1,36 +1,143 @@
 package services
 
 import (
-	"os"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"rabietf.me/go-assignment/models"
 )
 
-var (
-	secretKey = []byte(os.Getenv("SECRET_TOKEN"))
-)
+// Claims of the tokens created by CreateToken.
+// The user ID is carried by the standard sub claim, as a string.
+type Claims struct {
+	Roles []string `json:"roles,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Authenticated caller of a request, either a user with a JWT or a machine client with an API key.
+type Principal struct {
+	UserID  int64
+	Roles   []string
+	TokenID string
+	// Set when authenticated with an API key, which only grants its scopes on its shop.
+	APIKeyID int64
+	ShopID   int64
+	Scopes   []string
+}
+
+// Returns true if the principal is allowed to use scope.
+// Users authenticated with a JWT have every scope.
+func (principal Principal) HasScope(scope string) bool {
+	if principal.APIKeyID == 0 {
+		return true
+	}
+
+	for _, s := range principal.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns true if the principal may act on the shop, on top of the ownership checks.
+// API keys are restricted to the shop they were created for.
+func (principal Principal) CanAccessShop(shopID int64) bool {
+	return principal.APIKeyID == 0 || principal.ShopID == shopID
+}
+
+// Returns true if the principal has the given role.
+func (principal Principal) HasRole(role string) bool {
+	for _, r := range principal.Roles {
+		if r == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns the principal as author of the changes made by the request requestID, for the audit log.
+func (principal Principal) Actor(requestID string) models.Actor {
+	return models.Actor{UserID: principal.UserID, APIKeyID: principal.APIKeyID, RequestID: requestID}
+}
+
+// Builds the principal the claims were issued to.
+// Returns (principal, nil) if successful.
+// Returns (Principal{}, err) if the sub claim isn't a valid user ID.
+func (claims Claims) Principal() (Principal, error) {
+	userID, err := strconv.ParseInt(claims.Subject, 10, 64)
+
+	if err != nil || userID <= 0 {
+		return Principal{}, fmt.Errorf("invalid sub claim: %q", claims.Subject)
+	}
 
-// Service function that creates JWT for signed in user, using HS256 signing method.
+	return Principal{UserID: userID, Roles: claims.Roles, TokenID: claims.ID}, nil
+}
+
+// Helper function that generates a random token ID (jti claim).
+func newTokenID() (string, error) {
+	bytes := make([]byte, 16)
+
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(bytes), nil
+}
+
+// How long the tokens created by CreateToken are valid.
+const TokenLifetime = 6 * time.Hour
+
+// Service function that creates JWT for signed in user, using the signing key of the key manager.
 // Returns "", error if something went wrong.
 // Returns tokenString, nil if success.
 func CreateToken(user models.User) (string, error) {
-	expirationTime := time.Now().Add(6 * time.Hour)
+	now := time.Now()
+	expirationTime := now.Add(TokenLifetime)
+
+	tokenID, err := newTokenID()
 
-	token := jwt.New(jwt.SigningMethodHS256)
-	claims := token.Claims.(jwt.MapClaims)
+	if err != nil {
+		return "", err
+	}
+
+	// Admins keep the permissions of regular users.
+	roles := []string{models.RoleUser}
+
+	if user.Role != "" && user.Role != models.RoleUser {
+		roles = append(roles, user.Role)
+	}
 
-	user.Password = ""
+	claims := Claims{
+		Roles: roles,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    Keys.Issuer,
+			Audience:  jwt.ClaimStrings{Keys.Audience},
+			Subject:   strconv.FormatInt(user.ID, 10),
+			ID:        tokenID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expirationTime),
+		},
+	}
 
-	claims["userID"] = user.ID
-	claims["exp"] = expirationTime.Unix()
+	return Keys.Sign(claims)
+}
 
-	tokenString, err := token.SignedString(secretKey)
+// Service function that parses and validates a JWT created by CreateToken.
+// Returns (principal, nil) if the token is valid.
+// Returns (Principal{}, err) otherwise.
+func ParseToken(tokenString string) (Principal, error) {
+	var claims Claims
 
-	if err != nil {
-		return "", err
+	if _, err := Keys.Parse(tokenString, &claims); err != nil {
+		return Principal{}, err
 	}
 
-	return tokenString, nil
+	return claims.Principal()
 }
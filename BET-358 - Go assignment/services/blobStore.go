@@ -0,0 +1,352 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+var ErrBlobNotFound = errors.New("blob not found")
+
+// Stores the uploaded files (product images...) under keys like products/12/3f9c.png.
+type BlobStore interface {
+	// Stores data under key, replacing what was there.
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Returns the content of key, or ErrBlobNotFound if there is none. The caller must close it.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Removes key, does nothing if it doesn't exist.
+	Delete(ctx context.Context, key string) error
+}
+
+// Helper function that checks that a key can't escape the root of the store.
+func validBlobKey(key string) bool {
+	return key != "" && !strings.HasPrefix(key, "/") && path.Clean(key) == key && !strings.HasPrefix(key, "../") && key != ".."
+}
+
+// Stores the blobs as files in a directory of the local filesystem.
+type LocalBlobStore struct {
+	Dir string
+}
+
+func (store LocalBlobStore) path(key string) (string, error) {
+	if !validBlobKey(key) {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+
+	return filepath.Join(store.Dir, filepath.FromSlash(key)), nil
+}
+
+func (store LocalBlobStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	name, err := store.path(key)
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+
+	// Written next to its final name then renamed, so a blob is never seen half written.
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), name)
+}
+
+func (store LocalBlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	name, err := store.path(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(name)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrBlobNotFound
+	}
+
+	return file, err
+}
+
+func (store LocalBlobStore) Delete(ctx context.Context, key string) error {
+	name, err := store.path(key)
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// Stores the blobs in a bucket of an S3-compatible service (AWS S3, MinIO...), requests are signed with AWS Signature Version 4.
+type S3BlobStore struct {
+	// Base URL of the service, like https://s3.eu-west-3.amazonaws.com or http://localhost:9000.
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// Puts the bucket in the path (endpoint/bucket/key) instead of the host name (bucket.endpoint/key), as MinIO expects.
+	PathStyle bool
+	Client    *http.Client
+}
+
+// Helper function that returns the URL of key.
+func (store S3BlobStore) objectURL(key string) (*url.URL, error) {
+	if !validBlobKey(key) {
+		return nil, fmt.Errorf("invalid blob key %q", key)
+	}
+
+	u, err := url.Parse(strings.TrimSuffix(store.Endpoint, "/"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if store.PathStyle {
+		u.Path += "/" + store.Bucket + "/" + key
+	} else {
+		u.Host = store.Bucket + "." + u.Host
+		u.Path += "/" + key
+	}
+
+	return u, nil
+}
+
+// Helper function that sends a signed request for key.
+// Returns the response if its status is 2xx, the caller must close its body.
+// Returns ErrBlobNotFound on a 404, an error with the status otherwise.
+func (store S3BlobStore) do(ctx context.Context, method, key string, body []byte, contentType string) (*http.Response, error) {
+	u, err := store.objectURL(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	signS3Request(req, body, store.Region, store.AccessKey, store.SecretKey, time.Now())
+
+	client := store.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrBlobNotFound
+	}
+
+	return nil, fmt.Errorf("s3 %s %s: %s", method, key, resp.Status)
+}
+
+func (store S3BlobStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	resp, err := store.do(ctx, http.MethodPut, key, data, contentType)
+
+	if err != nil {
+		return err
+	}
+
+	resp.Body.Close()
+	return nil
+}
+
+func (store S3BlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := store.do(ctx, http.MethodGet, key, nil, "")
+
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+func (store S3BlobStore) Delete(ctx context.Context, key string) error {
+	resp, err := store.do(ctx, http.MethodDelete, key, nil, "")
+
+	if err != nil && err != ErrBlobNotFound {
+		return err
+	}
+
+	if resp != nil {
+		resp.Body.Close()
+	}
+
+	return nil
+}
+
+// Helper function that escapes a path like S3 expects in canonical requests: every byte but unreserved characters and "/".
+func s3EscapePath(p string) string {
+	var builder strings.Builder
+
+	for _, b := range []byte(p) {
+		if ('A' <= b && b <= 'Z') || ('a' <= b && b <= 'z') || ('0' <= b && b <= '9') || strings.IndexByte("-_.~/", b) >= 0 {
+			builder.WriteByte(b)
+		} else {
+			fmt.Fprintf(&builder, "%%%02X", b)
+		}
+	}
+
+	return builder.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// Helper function that signs a request to S3 with AWS Signature Version 4, see
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html.
+// The host and every header already set on the request are signed.
+func signS3Request(req *http.Request, body []byte, region, accessKey, secretKey string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	payloadHash := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3EscapePath(req.URL.Path),
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	signingKey := hmacSHA256(hmacSHA256(hmacSHA256(hmacSHA256([]byte("AWS4"+secretKey), date), region), "s3"), "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", accessKey, scope, signedHeaders, signature))
+}
+
+// Service function that builds the blob store from the environment: BLOB_STORE (local or s3, defaults to local),
+// BLOB_LOCAL_DIR (directory of the local store, defaults to data/blobs),
+// S3_ENDPOINT, S3_REGION (defaults to us-east-1), S3_BUCKET, S3_ACCESS_KEY_ID, S3_SECRET_ACCESS_KEY and S3_PATH_STYLE (true or false).
+// Returns an error if the configuration is incomplete.
+func NewBlobStoreFromEnv() (BlobStore, error) {
+	switch kind := os.Getenv("BLOB_STORE"); kind {
+	case "", "local":
+		dir := os.Getenv("BLOB_LOCAL_DIR")
+		if dir == "" {
+			dir = filepath.Join("data", "blobs")
+		}
+
+		return LocalBlobStore{Dir: dir}, nil
+	case "s3":
+		store := S3BlobStore{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Region:    os.Getenv("S3_REGION"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			PathStyle: os.Getenv("S3_PATH_STYLE") == "true",
+			Client:    &http.Client{Timeout: 30 * time.Second},
+		}
+
+		if store.Region == "" {
+			store.Region = "us-east-1"
+		}
+
+		if store.Endpoint == "" || store.Bucket == "" || store.AccessKey == "" || store.SecretKey == "" {
+			return nil, errors.New("S3_ENDPOINT, S3_BUCKET, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY are required with BLOB_STORE=s3")
+		}
+
+		return store, nil
+	default:
+		return nil, fmt.Errorf("BLOB_STORE must be local or s3, got %q", kind)
+	}
+}
+
+// Blob store used by the application, set by LoadBlobStore.
+var Blobs BlobStore
+
+// Service function that loads the blob store configuration, see NewBlobStoreFromEnv.
+// Returns an error if the configuration is incomplete.
+func LoadBlobStore() error {
+	store, err := NewBlobStoreFromEnv()
+
+	if err != nil {
+		return err
+	}
+
+	Blobs = store
+	return nil
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"rabietf.me/go-assignment/models"
+)
+
+var ErrAddressNotFound = errors.New("address not found")
+
+// Finds the coordinates of the free-text addresses of the shops.
+type Geocoder interface {
+	// Returns the coordinates of address, or ErrAddressNotFound if it can't be located.
+	Geocode(ctx context.Context, address string) (models.GeoPoint, error)
+}
+
+// Helper function that normalizes an address for comparisons: lowercase, with single spaces.
+func normalizeAddress(address string) string {
+	return strings.Join(strings.Fields(strings.ToLower(address)), " ")
+}
+
+// Geocoder answering from a fixed list of addresses, for development and tests.
+// Addresses are compared in lowercase and with single spaces.
+type FixtureGeocoder struct {
+	Addresses map[string]models.GeoPoint
+}
+
+// Function that builds a fixture geocoder from a JSON file like {"1 rue de Rivoli, Paris": {"latitude": 48.8556, "longitude": 2.3579}}.
+// Returns an error if the file can't be read or parsed.
+func NewFixtureGeocoder(path string) (FixtureGeocoder, error) {
+	var entries map[string]struct {
+		Latitude  float64 `json:"latitude"`
+		Longitude float64 `json:"longitude"`
+	}
+
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return FixtureGeocoder{}, err
+	}
+
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return FixtureGeocoder{}, fmt.Errorf("geocoder fixture %s: %w", path, err)
+	}
+
+	geocoder := FixtureGeocoder{Addresses: map[string]models.GeoPoint{}}
+
+	for address, entry := range entries {
+		geocoder.Addresses[normalizeAddress(address)] = models.GeoPoint{Latitude: entry.Latitude, Longitude: entry.Longitude}
+	}
+
+	return geocoder, nil
+}
+
+func (geocoder FixtureGeocoder) Geocode(ctx context.Context, address string) (models.GeoPoint, error) {
+	point, ok := geocoder.Addresses[normalizeAddress(address)]
+
+	if !ok {
+		return models.GeoPoint{}, ErrAddressNotFound
+	}
+
+	return point, nil
+}
+
+// Geocoder using the search API of a Nominatim server (OpenStreetMap), see https://nominatim.org/release-docs/latest/api/Search/.
+// The public server asks for an identifying User-Agent and at most one request per second.
+type NominatimGeocoder struct {
+	// Base URL of the server, like https://nominatim.openstreetmap.org.
+	Endpoint  string
+	UserAgent string
+	Client    *http.Client
+}
+
+func (geocoder NominatimGeocoder) Geocode(ctx context.Context, address string) (models.GeoPoint, error) {
+	query := url.Values{"q": {address}, "format": {"jsonv2"}, "limit": {"1"}}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(geocoder.Endpoint, "/")+"/search?"+query.Encode(), nil)
+
+	if err != nil {
+		return models.GeoPoint{}, err
+	}
+
+	req.Header.Set("User-Agent", geocoder.UserAgent)
+	req.Header.Set("Accept", "application/json")
+
+	client := geocoder.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+
+	if err != nil {
+		return models.GeoPoint{}, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		return models.GeoPoint{}, fmt.Errorf("nominatim search: %s", resp.Status)
+	}
+
+	// Coordinates are given as strings.
+	var results []struct {
+		Lat string `json:"lat"`
+		Lon string `json:"lon"`
+	}
+
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&results); err != nil {
+		return models.GeoPoint{}, err
+	}
+
+	if len(results) == 0 {
+		return models.GeoPoint{}, ErrAddressNotFound
+	}
+
+	latitude, err := strconv.ParseFloat(results[0].Lat, 64)
+
+	if err != nil {
+		return models.GeoPoint{}, err
+	}
+
+	longitude, err := strconv.ParseFloat(results[0].Lon, 64)
+
+	if err != nil {
+		return models.GeoPoint{}, err
+	}
+
+	return models.GeoPoint{Latitude: latitude, Longitude: longitude}, nil
+}
+
+// Geocoder used by the application, set by LoadGeocoder, nil when geocoding is disabled.
+var Geocoding Geocoder
+
+// Service function that configures the geocoder from the environment: GEOCODER (none, fixture or nominatim, defaults to none),
+// GEOCODER_FIXTURE_FILE (JSON file of the fixture geocoder, see NewFixtureGeocoder),
+// GEOCODER_URL (server of the nominatim geocoder, defaults to https://nominatim.openstreetmap.org) and GEOCODER_USER_AGENT.
+// Returns an error if the configuration is incomplete.
+func LoadGeocoder() error {
+	switch kind := os.Getenv("GEOCODER"); kind {
+	case "", "none":
+		Geocoding = nil
+	case "fixture":
+		path := os.Getenv("GEOCODER_FIXTURE_FILE")
+
+		if path == "" {
+			return errors.New("GEOCODER_FIXTURE_FILE is required with GEOCODER=fixture")
+		}
+
+		geocoder, err := NewFixtureGeocoder(path)
+
+		if err != nil {
+			return err
+		}
+
+		Geocoding = geocoder
+	case "nominatim":
+		geocoder := NominatimGeocoder{
+			Endpoint:  os.Getenv("GEOCODER_URL"),
+			UserAgent: os.Getenv("GEOCODER_USER_AGENT"),
+			Client:    &http.Client{Timeout: 10 * time.Second},
+		}
+
+		if geocoder.Endpoint == "" {
+			geocoder.Endpoint = "https://nominatim.openstreetmap.org"
+		}
+
+		if geocoder.UserAgent == "" {
+			return errors.New("GEOCODER_USER_AGENT is required with GEOCODER=nominatim")
+		}
+
+		Geocoding = geocoder
+	default:
+		return fmt.Errorf("GEOCODER must be none, fixture or nominatim, got %q", kind)
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"rabietf.me/go-assignment/models"
+)
+
+const geocoderFixture = "../data/geocoder-fixture.json"
+
+func TestFixtureGeocoder(t *testing.T) {
+	geocoder, err := NewFixtureGeocoder(geocoderFixture)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		address string
+		want    models.GeoPoint
+		err     error
+	}{
+		{"1 rue de Rivoli, 75001 Paris", models.GeoPoint{Latitude: 48.8559, Longitude: 2.3580}, nil},
+		// Compared in lowercase and with single spaces.
+		{"  221B BAKER   street,\tLondon ", models.GeoPoint{Latitude: 51.5238, Longitude: -0.1586}, nil},
+		{"12 place Bellecour, 69002 Lyon", models.GeoPoint{Latitude: 45.7578, Longitude: 4.8320}, nil},
+		{"2 rue de Rivoli, 75001 Paris", models.GeoPoint{}, ErrAddressNotFound},
+		{"", models.GeoPoint{}, ErrAddressNotFound},
+	}
+
+	for _, tc := range cases {
+		got, err := geocoder.Geocode(context.Background(), tc.address)
+
+		if got != tc.want || err != tc.err {
+			t.Fatalf("%q: got (%+v, %v), want (%+v, %v)", tc.address, got, err, tc.want, tc.err)
+		}
+	}
+}
+
+func TestNewFixtureGeocoderRejectsInvalidFiles(t *testing.T) {
+	invalid := filepath.Join(t.TempDir(), "invalid.json")
+
+	if err := os.WriteFile(invalid, []byte(`{"1 rue de Rivoli": [48.8559, 2.3580]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{invalid, filepath.Join(t.TempDir(), "missing.json")} {
+		if _, err := NewFixtureGeocoder(path); err == nil {
+			t.Fatalf("%s was accepted", path)
+		}
+	}
+}
+
+func TestLoadGeocoder(t *testing.T) {
+	t.Cleanup(func() { Geocoding = nil })
+
+	t.Setenv("GEOCODER", "fixture")
+	t.Setenv("GEOCODER_FIXTURE_FILE", geocoderFixture)
+
+	if err := LoadGeocoder(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := Geocoding.(FixtureGeocoder); !ok {
+		t.Fatalf("got geocoder %T, want FixtureGeocoder", Geocoding)
+	}
+
+	cases := map[string]map[string]string{
+		"fixture without file":        {"GEOCODER": "fixture", "GEOCODER_FIXTURE_FILE": ""},
+		"nominatim without UserAgent": {"GEOCODER": "nominatim", "GEOCODER_USER_AGENT": ""},
+		"unknown geocoder":            {"GEOCODER": "google"},
+	}
+
+	for name, env := range cases {
+		for key, value := range env {
+			t.Setenv(key, value)
+		}
+
+		if err := LoadGeocoder(); err == nil {
+			t.Fatalf("%s: configuration was accepted", name)
+		}
+	}
+
+	t.Setenv("GEOCODER", "none")
+
+	if err := LoadGeocoder(); err != nil || Geocoding != nil {
+		t.Fatalf("got (%v, %v), want no geocoder", Geocoding, err)
+	}
+}
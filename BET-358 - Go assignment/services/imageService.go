@@ -0,0 +1,111 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"net/http"
+
+	// Decoders of the accepted formats, registered for image.DecodeConfig.
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+var (
+	ErrImageTooLarge    = errors.New("image too large")
+	ErrUnsupportedImage = errors.New("unsupported image format")
+	ErrImageDimensions  = errors.New("image dimensions out of bounds")
+)
+
+// Accepted content types, with the extension of their blobs.
+var acceptedImageTypes = map[string]string{"image/jpeg": ".jpg", "image/png": ".png", "image/gif": ".gif"}
+
+// Content type of each format reported by image.DecodeConfig.
+var imageFormatContentType = map[string]string{"jpeg": "image/jpeg", "png": "image/png", "gif": "image/gif"}
+
+// Limits of the uploaded images.
+type ImageLimits struct {
+	MaxBytes int64
+	// Maximum width and height in pixels.
+	MaxDimension int
+	// Maximum number of images of a product.
+	MaxPerProduct int
+}
+
+// What ValidateImage found out about an image.
+type ImageInfo struct {
+	ContentType string
+	// Extension matching the content type, like .png.
+	Extension string
+	Width     int
+	Height    int
+}
+
+// Checks an uploaded image: its type is sniffed from its content (the one announced by the client is ignored),
+// it must be a JPEG, PNG or GIF whose header decodes, and fit in the limits.
+// Returns (info, nil) if the image is accepted.
+// Returns (ImageInfo{}, ErrImageTooLarge, ErrUnsupportedImage or ErrImageDimensions) otherwise.
+func (limits ImageLimits) ValidateImage(data []byte) (ImageInfo, error) {
+	if int64(len(data)) > limits.MaxBytes {
+		return ImageInfo{}, ErrImageTooLarge
+	}
+
+	contentType := http.DetectContentType(data)
+	extension, ok := acceptedImageTypes[contentType]
+
+	if !ok {
+		return ImageInfo{}, ErrUnsupportedImage
+	}
+
+	// Only the header is decoded, so huge images are refused before allocating their pixels.
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+
+	if err != nil || imageFormatContentType[format] != contentType {
+		return ImageInfo{}, ErrUnsupportedImage
+	}
+
+	if config.Width < 1 || config.Height < 1 || config.Width > limits.MaxDimension || config.Height > limits.MaxDimension {
+		return ImageInfo{}, ErrImageDimensions
+	}
+
+	return ImageInfo{ContentType: contentType, Extension: extension, Width: config.Width, Height: config.Height}, nil
+}
+
+// Service function that builds the image limits from the environment: IMAGE_MAX_BYTES (defaults to 5 MiB),
+// IMAGE_MAX_DIMENSION (in pixels, defaults to 4096) and IMAGE_MAX_PER_PRODUCT (defaults to 10).
+// Returns an error if one of them is invalid.
+func NewImageLimitsFromEnv() (ImageLimits, error) {
+	maxBytes, err := envInt("IMAGE_MAX_BYTES", 5<<20)
+	if err != nil {
+		return ImageLimits{}, err
+	}
+
+	maxDimension, err := envInt("IMAGE_MAX_DIMENSION", 4096)
+	if err != nil {
+		return ImageLimits{}, err
+	}
+
+	maxPerProduct, err := envInt("IMAGE_MAX_PER_PRODUCT", 10)
+	if err != nil {
+		return ImageLimits{}, err
+	}
+
+	return ImageLimits{MaxBytes: int64(maxBytes), MaxDimension: maxDimension, MaxPerProduct: maxPerProduct}, nil
+}
+
+// Image limits used by the application, set by LoadImageLimits.
+var Images ImageLimits
+
+// Service function that loads the image limits, see NewImageLimitsFromEnv.
+// Returns an error if the configuration is invalid.
+func LoadImageLimits() error {
+	limits, err := NewImageLimitsFromEnv()
+
+	if err != nil {
+		return err
+	}
+
+	Images = limits
+	return nil
+}
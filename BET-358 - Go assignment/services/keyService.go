@@ -0,0 +1,317 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// HMAC secrets shorter than this are refused.
+const minSecretLength = 32
+
+// Prefix of the HS256 secrets in JWT_VERIFICATION_KEYS, the other entries being paths of PEM public keys.
+const hmacPrefix = "hmac:"
+
+// A key used to sign or verify tokens, identified by the kid header of the tokens.
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+	// Key used to sign tokens, nil for keys only kept to verify tokens signed before a rotation.
+	signKey interface{}
+	// Key used to verify tokens.
+	verifyKey interface{}
+}
+
+// JSON Web Key, as served by the JWKS endpoint.
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// Holds the key tokens are signed with, and all the keys tokens are accepted from.
+// Several verification keys can be active at once so tokens signed before a key rotation stay valid until they expire.
+type KeyManager struct {
+	Issuer   string
+	Audience string
+	signing  *Key
+	keys     map[string]*Key
+}
+
+// Creates a key manager signing with signing, and also accepting tokens signed by the verification keys.
+func NewKeyManager(issuer, audience string, signing *Key, verification ...*Key) *KeyManager {
+	manager := &KeyManager{Issuer: issuer, Audience: audience, signing: signing, keys: make(map[string]*Key)}
+
+	manager.keys[signing.ID] = signing
+	for _, key := range verification {
+		manager.keys[key.ID] = key
+	}
+
+	return manager
+}
+
+// Creates an HS256 key from a shared secret.
+// Returns an error if the secret is empty or shorter than 32 bytes.
+func NewHMACKey(id string, secret []byte) (*Key, error) {
+	if len(secret) < minSecretLength {
+		return nil, fmt.Errorf("the HMAC secret must be at least %d bytes long", minSecretLength)
+	}
+
+	if id == "" {
+		id = "hs256-" + fingerprint(secret)
+	}
+
+	return &Key{ID: id, Method: jwt.SigningMethodHS256, signKey: secret, verifyKey: secret}, nil
+}
+
+// Creates an RS256 or EdDSA key from a PEM encoded private key, the algorithm depends on the type of the key.
+// Returns an error if the key can't be parsed or isn't an RSA or Ed25519 key.
+func NewPrivateKey(id string, pemData []byte) (*Key, error) {
+	if private, err := jwt.ParseRSAPrivateKeyFromPEM(pemData); err == nil {
+		if private.N.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must be at least 2048 bits long")
+		}
+		return newAsymmetricKey(id, jwt.SigningMethodRS256, private, &private.PublicKey)
+	}
+
+	if private, err := jwt.ParseEdPrivateKeyFromPEM(pemData); err == nil {
+		if edPrivate, ok := private.(ed25519.PrivateKey); ok {
+			return newAsymmetricKey(id, jwt.SigningMethodEdDSA, edPrivate, edPrivate.Public())
+		}
+	}
+
+	return nil, errors.New("the private key must be a PEM encoded RSA or Ed25519 key")
+}
+
+// Creates an RS256 or EdDSA verification-only key from a PEM encoded public key.
+// Returns an error if the key can't be parsed or isn't an RSA or Ed25519 key.
+func NewPublicKey(id string, pemData []byte) (*Key, error) {
+	if public, err := jwt.ParseRSAPublicKeyFromPEM(pemData); err == nil {
+		return newAsymmetricKey(id, jwt.SigningMethodRS256, nil, public)
+	}
+
+	if public, err := jwt.ParseEdPublicKeyFromPEM(pemData); err == nil {
+		return newAsymmetricKey(id, jwt.SigningMethodEdDSA, nil, public)
+	}
+
+	return nil, errors.New("the public key must be a PEM encoded RSA or Ed25519 key")
+}
+
+func newAsymmetricKey(id string, method jwt.SigningMethod, private interface{}, public crypto.PublicKey) (*Key, error) {
+	if id == "" {
+		switch public := public.(type) {
+		case *rsa.PublicKey:
+			id = "rs256-" + fingerprint(public.N.Bytes())
+		case ed25519.PublicKey:
+			id = "eddsa-" + fingerprint(public)
+		}
+	}
+
+	return &Key{ID: id, Method: method, signKey: private, verifyKey: public}, nil
+}
+
+// Helper function that derives a short key ID from key material.
+func fingerprint(material []byte) string {
+	sum := sha256.Sum256(material)
+	return base64.RawURLEncoding.EncodeToString(sum[:8])
+}
+
+// Signs claims with the current signing key, and sets the kid header.
+// Returns "", error if something went wrong.
+// Returns tokenString, nil if success.
+func (manager *KeyManager) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(manager.signing.Method, claims)
+	token.Header["kid"] = manager.signing.ID
+
+	return token.SignedString(manager.signing.signKey)
+}
+
+// Parses and validates a token: its kid must be one of the known keys, the algorithm must be the one of that key,
+// and the exp, iss and aud claims must be valid.
+// Returns (token, nil) if the token is valid.
+// Returns (nil, err) otherwise.
+func (manager *KeyManager) Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	parser := jwt.NewParser(
+		jwt.WithIssuer(manager.Issuer),
+		jwt.WithAudience(manager.Audience),
+		jwt.WithIssuedAt(),
+	)
+
+	return parser.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+
+		key, ok := manager.keys[kid]
+
+		if !ok {
+			return nil, fmt.Errorf("unknown key id: %q", kid)
+		}
+
+		if t.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+
+		return key.verifyKey, nil
+	})
+}
+
+// Returns the public keys tokens are accepted from, in JWK format.
+// HMAC keys are secret and never listed.
+func (manager *KeyManager) JWKS() []JWK {
+	jwks := []JWK{}
+
+	for _, key := range manager.keys {
+		switch public := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwks = append(jwks, JWK{
+				Kty: "RSA",
+				Use: "sig",
+				Alg: key.Method.Alg(),
+				Kid: key.ID,
+				N:   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			jwks = append(jwks, JWK{
+				Kty: "OKP",
+				Use: "sig",
+				Alg: key.Method.Alg(),
+				Kid: key.ID,
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(public),
+			})
+		}
+	}
+
+	sort.Slice(jwks, func(i, j int) bool { return jwks[i].Kid < jwks[j].Kid })
+
+	return jwks
+}
+
+// Helper function that reads an entry of JWT_VERIFICATION_KEYS: kid=path of a PEM public key, kid=hmac:secret of an HS256 secret,
+// or hmac:secret to use the kid derived from the secret, like the signing key without JWT_KEY_ID.
+// Returns an error if the entry is malformed, the key can't be read or the secret is weak.
+func parseVerificationKey(entry string) (*Key, error) {
+	kid, value := "", entry
+
+	if !strings.HasPrefix(entry, hmacPrefix) {
+		var ok bool
+		if kid, value, ok = strings.Cut(entry, "="); !ok || kid == "" || value == "" {
+			return nil, fmt.Errorf("JWT_VERIFICATION_KEYS entries must look like kid=path or kid=hmac:secret, got %q", entry)
+		}
+	}
+
+	if strings.HasPrefix(value, hmacPrefix) {
+		key, err := NewHMACKey(kid, []byte(strings.TrimPrefix(value, hmacPrefix)))
+		if err != nil {
+			return nil, fmt.Errorf("verification key %s: %w", kid, err)
+		}
+		return key, nil
+	}
+
+	pemData, err := os.ReadFile(value)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := NewPublicKey(kid, pemData)
+	if err != nil {
+		return nil, fmt.Errorf("verification key %s: %w", kid, err)
+	}
+
+	return key, nil
+}
+
+// Service function that builds the key manager from the environment:
+// JWT_ALG (HS256, RS256 or EdDSA, defaults to HS256), SECRET_TOKEN (HS256 secret, at least 32 bytes),
+// JWT_PRIVATE_KEY_FILE (PEM private key for RS256 and EdDSA), JWT_KEY_ID (kid of the signing key, derived from the key if empty),
+// JWT_VERIFICATION_KEYS (comma separated kid=path of PEM public keys or kid=hmac:secret of HS256 secrets still accepted after a rotation),
+// JWT_ISSUER and JWT_AUDIENCE (default to go-assignment and go-assignment-api).
+// Returns an error if the configuration is missing or weak.
+func NewKeyManagerFromEnv() (*KeyManager, error) {
+	var signing *Key
+	var err error
+
+	switch alg := os.Getenv("JWT_ALG"); alg {
+	case "", "HS256":
+		signing, err = NewHMACKey(os.Getenv("JWT_KEY_ID"), []byte(os.Getenv("SECRET_TOKEN")))
+	case "RS256", "EdDSA":
+		path := os.Getenv("JWT_PRIVATE_KEY_FILE")
+		if path == "" {
+			return nil, fmt.Errorf("JWT_PRIVATE_KEY_FILE is required with JWT_ALG=%s", alg)
+		}
+
+		var pemData []byte
+		if pemData, err = os.ReadFile(path); err != nil {
+			return nil, err
+		}
+
+		if signing, err = NewPrivateKey(os.Getenv("JWT_KEY_ID"), pemData); err == nil && signing.Method.Alg() != alg {
+			err = fmt.Errorf("JWT_PRIVATE_KEY_FILE doesn't contain a %s key", alg)
+		}
+	default:
+		return nil, fmt.Errorf("JWT_ALG must be HS256, RS256 or EdDSA, got %q", alg)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var verification []*Key
+
+	for _, entry := range strings.Split(os.Getenv("JWT_VERIFICATION_KEYS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		key, err := parseVerificationKey(entry)
+		if err != nil {
+			return nil, err
+		}
+
+		verification = append(verification, key)
+	}
+
+	issuer := os.Getenv("JWT_ISSUER")
+	if issuer == "" {
+		issuer = "go-assignment"
+	}
+
+	audience := os.Getenv("JWT_AUDIENCE")
+	if audience == "" {
+		audience = "go-assignment-api"
+	}
+
+	return NewKeyManager(issuer, audience, signing, verification...), nil
+}
+
+// Key manager used by the application, set by LoadKeys.
+var Keys *KeyManager
+
+// Service function that loads the token keys configuration, see NewKeyManagerFromEnv.
+// Returns an error if the configuration is missing or weak, the application must not start in that case.
+func LoadKeys() error {
+	manager, err := NewKeyManagerFromEnv()
+
+	if err != nil {
+		return err
+	}
+
+	Keys = manager
+	return nil
+}
@@ -0,0 +1,289 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	testSecret    = []byte(strings.Repeat("s", minSecretLength))
+	testOldSecret = []byte(strings.Repeat("o", minSecretLength))
+)
+
+// Helper function that returns valid claims for a manager with the default issuer and audience.
+func testClaims() jwt.RegisteredClaims {
+	now := time.Now()
+
+	return jwt.RegisteredClaims{
+		Subject:   "7",
+		Issuer:    "go-assignment",
+		Audience:  jwt.ClaimStrings{"go-assignment-api"},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+	}
+}
+
+// Helper function that returns the key created by one of the constructors, panics if it failed.
+func mustKey(key *Key, err error) *Key {
+	if err != nil {
+		panic(err)
+	}
+
+	return key
+}
+
+// Helper function that generates RSA and Ed25519 keys.
+// Returns their private keys and the PEM encoding of their public keys.
+func generateKeys(t *testing.T) (*rsa.PrivateKey, ed25519.PrivateKey, []byte, []byte) {
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encode := func(public interface{}) []byte {
+		der, err := x509.MarshalPKIXPublicKey(public)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	}
+
+	return rsaPrivate, edPrivate, encode(&rsaPrivate.PublicKey), encode(edPublic)
+}
+
+func TestKeyManagerSignAndParse(t *testing.T) {
+	rsaPrivate, edPrivate, _, _ := generateKeys(t)
+
+	rsaKey := mustKey(newAsymmetricKey("", jwt.SigningMethodRS256, rsaPrivate, &rsaPrivate.PublicKey))
+	edKey := mustKey(newAsymmetricKey("", jwt.SigningMethodEdDSA, edPrivate, edPrivate.Public()))
+	hmacKey := mustKey(NewHMACKey("", testSecret))
+
+	for _, key := range []*Key{hmacKey, rsaKey, edKey} {
+		t.Run(key.Method.Alg(), func(t *testing.T) {
+			manager := NewKeyManager("go-assignment", "go-assignment-api", key)
+
+			tokenString, err := manager.Sign(testClaims())
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var claims jwt.RegisteredClaims
+			token, err := manager.Parse(tokenString, &claims)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if token.Header["kid"] != key.ID || claims.Subject != "7" {
+				t.Fatalf("got kid %v and subject %q, want %s and 7", token.Header["kid"], claims.Subject, key.ID)
+			}
+		})
+	}
+}
+
+func TestKeyManagerSelectsKeyByKid(t *testing.T) {
+	old := NewKeyManager("go-assignment", "go-assignment-api", mustKey(NewHMACKey("old", testOldSecret)))
+	oldToken, err := old.Sign(testClaims())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated := NewKeyManager("go-assignment", "go-assignment-api", mustKey(NewHMACKey("new", testSecret)), mustKey(NewHMACKey("old", testOldSecret)))
+
+	if _, err := rotated.Parse(oldToken, &jwt.RegisteredClaims{}); err != nil {
+		t.Fatalf("token of the previous key: %v", err)
+	}
+
+	newToken, err := rotated.Sign(testClaims())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := old.Parse(newToken, &jwt.RegisteredClaims{}); err == nil {
+		t.Fatal("token of an unknown kid was accepted")
+	}
+
+	// Same kid, but not the same secret anymore.
+	forged := NewKeyManager("go-assignment", "go-assignment-api", mustKey(NewHMACKey("old", testSecret)))
+	forgedToken, err := forged.Sign(testClaims())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := rotated.Parse(forgedToken, &jwt.RegisteredClaims{}); err == nil {
+		t.Fatal("token signed with another secret was accepted")
+	}
+}
+
+func TestKeyManagerRejectsWrongAlgorithm(t *testing.T) {
+	rsaPrivate, _, rsaPEM, _ := generateKeys(t)
+	manager := NewKeyManager("go-assignment", "go-assignment-api", mustKey(newAsymmetricKey("rsa", jwt.SigningMethodRS256, rsaPrivate, &rsaPrivate.PublicKey)))
+
+	// HS256 signed with the public key, which is no secret.
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims())
+	token.Header["kid"] = "rsa"
+	confused, err := token.SignedString(rsaPEM)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token = jwt.NewWithClaims(jwt.SigningMethodNone, testClaims())
+	token.Header["kid"] = "rsa"
+	unsigned, err := token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, tokenString := range map[string]string{"HS256": confused, "none": unsigned} {
+		if _, err := manager.Parse(tokenString, &jwt.RegisteredClaims{}); err == nil {
+			t.Fatalf("%s token was accepted for an RS256 key", name)
+		}
+	}
+}
+
+func TestKeyManagerRejectsWrongClaims(t *testing.T) {
+	manager := NewKeyManager("go-assignment", "go-assignment-api", mustKey(NewHMACKey("", testSecret)))
+
+	cases := map[string]func(claims *jwt.RegisteredClaims){
+		"audience": func(claims *jwt.RegisteredClaims) { claims.Audience = jwt.ClaimStrings{"another-api"} },
+		"issuer":   func(claims *jwt.RegisteredClaims) { claims.Issuer = "another-issuer" },
+		"expired": func(claims *jwt.RegisteredClaims) {
+			claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+		},
+		"future": func(claims *jwt.RegisteredClaims) { claims.IssuedAt = jwt.NewNumericDate(time.Now().Add(time.Hour)) },
+	}
+
+	for name, change := range cases {
+		t.Run(name, func(t *testing.T) {
+			claims := testClaims()
+			change(&claims)
+
+			tokenString, err := manager.Sign(claims)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := manager.Parse(tokenString, &jwt.RegisteredClaims{}); err == nil {
+				t.Fatal("token was accepted")
+			}
+		})
+	}
+}
+
+func TestNewKeyManagerFromEnvRefusesWeakSecrets(t *testing.T) {
+	short := strings.Repeat("s", minSecretLength-1)
+
+	cases := []struct {
+		name, secret, verification string
+	}{
+		{"empty", "", ""},
+		{"short", short, ""},
+		{"short verification secret", string(testSecret), "old=hmac:" + short},
+		{"verification secret without kid", string(testSecret), "hmac:" + short},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("JWT_ALG", "HS256")
+			t.Setenv("SECRET_TOKEN", tc.secret)
+			t.Setenv("JWT_VERIFICATION_KEYS", tc.verification)
+
+			if _, err := NewKeyManagerFromEnv(); err == nil {
+				t.Fatal("weak secret was accepted")
+			}
+		})
+	}
+}
+
+func TestNewKeyManagerFromEnvVerificationKeys(t *testing.T) {
+	_, _, rsaPEM, _ := generateKeys(t)
+	path := filepath.Join(t.TempDir(), "old.pem")
+
+	if err := os.WriteFile(path, rsaPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	old := mustKey(NewHMACKey("", testOldSecret))
+
+	t.Setenv("JWT_ALG", "HS256")
+	t.Setenv("SECRET_TOKEN", string(testSecret))
+	t.Setenv("JWT_KEY_ID", "current")
+	// The old secret contains "=", only the first one separates the kid.
+	t.Setenv("JWT_VERIFICATION_KEYS", "rsa-old="+path+", hs-old=hmac:"+string(testOldSecret)+"==, hmac:"+string(testOldSecret))
+
+	manager, err := NewKeyManagerFromEnv()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, kid := range []string{"current", "rsa-old", "hs-old", old.ID} {
+		if _, ok := manager.keys[kid]; !ok {
+			t.Fatalf("key %s is missing", kid)
+		}
+	}
+
+	if got := string(manager.keys["hs-old"].verifyKey.([]byte)); got != string(testOldSecret)+"==" {
+		t.Fatalf("got secret %q for hs-old", got)
+	}
+
+	for _, entry := range []string{"=" + path, "rsa-old=", "rsa-old", "rsa-old=" + path + ".missing"} {
+		t.Setenv("JWT_VERIFICATION_KEYS", entry)
+
+		if _, err := NewKeyManagerFromEnv(); err == nil {
+			t.Fatalf("entry %q was accepted", entry)
+		}
+	}
+}
+
+func TestKeyManagerJWKS(t *testing.T) {
+	rsaPrivate, edPrivate, _, _ := generateKeys(t)
+
+	manager := NewKeyManager("go-assignment", "go-assignment-api",
+		mustKey(newAsymmetricKey("b-rsa", jwt.SigningMethodRS256, rsaPrivate, &rsaPrivate.PublicKey)),
+		mustKey(newAsymmetricKey("a-eddsa", jwt.SigningMethodEdDSA, nil, edPrivate.Public())),
+		mustKey(NewHMACKey("c-hmac", testSecret)),
+	)
+
+	jwks := manager.JWKS()
+
+	// Secrets are never published.
+	if len(jwks) != 2 || jwks[0].Kid != "a-eddsa" || jwks[1].Kid != "b-rsa" {
+		t.Fatalf("got %+v, want a-eddsa and b-rsa", jwks)
+	}
+
+	if got := jwks[0]; got.Kty != "OKP" || got.Crv != "Ed25519" || got.Alg != "EdDSA" || got.Use != "sig" || len(got.X) != 43 {
+		t.Fatalf("got Ed25519 key %+v", got)
+	}
+
+	// 65537, and 2048 bits in base64url without padding.
+	if got := jwks[1]; got.Kty != "RSA" || got.Alg != "RS256" || got.E != "AQAB" || len(got.N) != 342 {
+		t.Fatalf("got RSA key %+v", got)
+	}
+}
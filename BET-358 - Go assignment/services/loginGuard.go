@@ -0,0 +1,260 @@
+package services
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Failed login counter for one key (an account email from a client IP, an account email, or a client IP).
+type Attempts struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+	// Last successful login, only set for an account from a client IP: the IP is then known for the account.
+	LastSuccess time.Time
+}
+
+// Storage used by LoginGuard to keep failed login counters.
+// The in-memory implementation below is enough for a single instance, a shared backend (Redis, database...)
+// only has to implement this interface to be used when running several instances.
+type AttemptStore interface {
+	// Returns the current counters for key, the zero value if there are none.
+	Get(key string) (Attempts, error)
+	// Stores the counters for key, they can be forgotten after ttl.
+	Set(key string, attempts Attempts, ttl time.Duration) error
+	// Forgets the counters for key.
+	Reset(key string) error
+}
+
+type memoryAttempt struct {
+	attempts  Attempts
+	expiresAt time.Time
+}
+
+// In-memory AttemptStore, safe for concurrent use.
+type MemoryAttemptStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryAttempt
+}
+
+// Creates an empty in-memory attempt store.
+func NewMemoryAttemptStore() *MemoryAttemptStore {
+	return &MemoryAttemptStore{entries: make(map[string]memoryAttempt)}
+}
+
+func (store *MemoryAttemptStore) Get(key string) (Attempts, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	entry, ok := store.entries[key]
+
+	if !ok {
+		return Attempts{}, nil
+	}
+
+	if time.Now().After(entry.expiresAt) {
+		delete(store.entries, key)
+		return Attempts{}, nil
+	}
+
+	return entry.attempts, nil
+}
+
+func (store *MemoryAttemptStore) Set(key string, attempts Attempts, ttl time.Duration) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	now := time.Now()
+
+	// Drop expired entries from time to time so the map doesn't grow forever.
+	if len(store.entries) > 10000 {
+		for k, v := range store.entries {
+			if now.After(v.expiresAt) {
+				delete(store.entries, k)
+			}
+		}
+	}
+
+	store.entries[key] = memoryAttempt{attempts: attempts, expiresAt: now.Add(ttl)}
+	return nil
+}
+
+func (store *MemoryAttemptStore) Reset(key string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	delete(store.entries, key)
+	return nil
+}
+
+// Limits applied to one kind of key (account from an IP, account, or IP).
+// The first FreeAttempts failures are not penalized, after that the key is locked for
+// BaseLockout, doubled on every new failure and capped at MaxLockout.
+type LockoutPolicy struct {
+	FreeAttempts int
+	BaseLockout  time.Duration
+	MaxLockout   time.Duration
+	// Counters are forgotten after this long without a new failure.
+	Window time.Duration
+}
+
+// Guards the login endpoint against brute-force, with failed attempts counted per account and IP, per account, and per IP.
+// The account counter bounds the guesses on an account however many IPs they come from. It only delays the IPs that
+// haven't logged in to the account within KnownIPWindow, so an attack from elsewhere doesn't lock the owner out of their usual devices.
+type LoginGuard struct {
+	Store AttemptStore
+	// Failures on an account from one IP.
+	AccountIPPolicy LockoutPolicy
+	// Failures on an account from any IP.
+	AccountPolicy LockoutPolicy
+	IPPolicy      LockoutPolicy
+	// How long an IP stays known for an account after a successful login.
+	KnownIPWindow time.Duration
+}
+
+// Creates a login guard with the default policies: 5 free attempts per account from an IP, 10 per account and 20 per IP,
+// then a lockout starting at 30 seconds and going up to 15 minutes per account and 1 hour per IP.
+// IPs stay known for an account 30 days after a successful login.
+func NewLoginGuard(store AttemptStore) *LoginGuard {
+	return &LoginGuard{
+		Store: store,
+		AccountIPPolicy: LockoutPolicy{
+			FreeAttempts: 5,
+			BaseLockout:  30 * time.Second,
+			MaxLockout:   15 * time.Minute,
+			Window:       time.Hour,
+		},
+		AccountPolicy: LockoutPolicy{
+			FreeAttempts: 10,
+			BaseLockout:  30 * time.Second,
+			MaxLockout:   15 * time.Minute,
+			Window:       time.Hour,
+		},
+		IPPolicy: LockoutPolicy{
+			FreeAttempts: 20,
+			BaseLockout:  30 * time.Second,
+			MaxLockout:   time.Hour,
+			Window:       time.Hour,
+		},
+		KnownIPWindow: 30 * 24 * time.Hour,
+	}
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func accountIPKey(email, ip string) string {
+	return "account:" + normalizeEmail(email) + "|" + ip
+}
+
+func accountKey(email string) string {
+	return "account:" + normalizeEmail(email)
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Checks if a login attempt for this email from this IP is currently allowed.
+// Returns (0, nil) if the attempt can go on.
+// Returns (retryAfter, nil) if the account is locked for this IP, the account is locked and the IP isn't known for it, or the IP is locked.
+// Returns (0, err) if the store failed.
+func (guard *LoginGuard) Check(email, ip string) (time.Duration, error) {
+	accountIP, err := guard.Store.Get(accountIPKey(email, ip))
+
+	if err != nil {
+		return 0, err
+	}
+
+	keys := []string{ipKey(ip)}
+
+	if !guard.known(accountIP) {
+		keys = append(keys, accountKey(email))
+	}
+
+	now := time.Now()
+	wait := accountIP.LockedUntil.Sub(now)
+
+	for _, key := range keys {
+		attempts, err := guard.Store.Get(key)
+
+		if err != nil {
+			return 0, err
+		}
+
+		if remaining := attempts.LockedUntil.Sub(now); remaining > wait {
+			wait = remaining
+		}
+	}
+
+	if wait < 0 {
+		wait = 0
+	}
+
+	return wait, nil
+}
+
+// Helper function that tells whether the counters of an account from an IP say the IP logged in to the account recently.
+func (guard *LoginGuard) known(accountIP Attempts) bool {
+	return !accountIP.LastSuccess.IsZero() && time.Since(accountIP.LastSuccess) < guard.KnownIPWindow
+}
+
+// Records a failed login for this email and IP, locking them if their policy says so.
+// Returns an error if the store failed.
+func (guard *LoginGuard) RegisterFailure(email, ip string) error {
+	if err := guard.registerFailure(accountIPKey(email, ip), guard.AccountIPPolicy); err != nil {
+		return err
+	}
+
+	if err := guard.registerFailure(accountKey(email), guard.AccountPolicy); err != nil {
+		return err
+	}
+
+	return guard.registerFailure(ipKey(ip), guard.IPPolicy)
+}
+
+func (guard *LoginGuard) registerFailure(key string, policy LockoutPolicy) error {
+	attempts, err := guard.Store.Get(key)
+
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	attempts.Failures++
+	attempts.LastFailure = now
+
+	if over := attempts.Failures - policy.FreeAttempts; over > 0 {
+		lockout := policy.BaseLockout
+		for i := 1; i < over && lockout < policy.MaxLockout; i++ {
+			lockout *= 2
+		}
+		if lockout > policy.MaxLockout {
+			lockout = policy.MaxLockout
+		}
+		attempts.LockedUntil = now.Add(lockout)
+	}
+
+	ttl := policy.Window
+	if untilUnlock := attempts.LockedUntil.Sub(now); untilUnlock > ttl {
+		ttl = untilUnlock
+	}
+	if !attempts.LastSuccess.IsZero() {
+		if untilForgotten := attempts.LastSuccess.Add(guard.KnownIPWindow).Sub(now); untilForgotten > ttl {
+			ttl = untilForgotten
+		}
+	}
+
+	return guard.Store.Set(key, attempts, ttl)
+}
+
+// Clears the counters of the account from this IP after a successful login, and remembers the IP as known for the account.
+// The account and IP counters are kept: a single valid account can't be used to reset the IP ones,
+// and the owner logging in doesn't give an attacker elsewhere new guesses.
+// Returns an error if the store failed.
+func (guard *LoginGuard) RegisterSuccess(email, ip string) error {
+	return guard.Store.Set(accountIPKey(email, ip), Attempts{LastSuccess: time.Now()}, guard.KnownIPWindow)
+}
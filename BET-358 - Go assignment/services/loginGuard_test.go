@@ -0,0 +1,114 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestLoginGuardLocksAccountPerIP(t *testing.T) {
+	guard := NewLoginGuard(NewMemoryAttemptStore())
+
+	for i := 0; i < guard.AccountIPPolicy.FreeAttempts+1; i++ {
+		if err := guard.RegisterFailure("victim@example.com", "203.0.113.1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if wait, err := guard.Check("Victim@example.com ", "203.0.113.1"); err != nil || wait <= 0 {
+		t.Fatalf("attacker IP: got wait %v, err %v, want a lockout", wait, err)
+	}
+
+	if wait, err := guard.Check("victim@example.com", "198.51.100.7"); err != nil || wait != 0 {
+		t.Fatalf("other IP: got wait %v, err %v, want no lockout", wait, err)
+	}
+}
+
+func TestLoginGuardLocksIP(t *testing.T) {
+	guard := NewLoginGuard(NewMemoryAttemptStore())
+
+	for i := 0; i < guard.IPPolicy.FreeAttempts+1; i++ {
+		if err := guard.RegisterFailure("user"+string(rune('a'+i))+"@example.com", "203.0.113.1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if wait, err := guard.Check("someone@example.com", "203.0.113.1"); err != nil || wait <= 0 {
+		t.Fatalf("got wait %v, err %v, want the IP locked", wait, err)
+	}
+}
+
+func TestLoginGuardSuccessResetsAccountOnly(t *testing.T) {
+	guard := NewLoginGuard(NewMemoryAttemptStore())
+
+	for i := 0; i < guard.AccountIPPolicy.FreeAttempts+1; i++ {
+		guard.RegisterFailure("user@example.com", "203.0.113.1")
+	}
+
+	if err := guard.RegisterSuccess("user@example.com", "203.0.113.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if wait, _ := guard.Check("user@example.com", "203.0.113.1"); wait != 0 {
+		t.Fatalf("got wait %v after a success, want none", wait)
+	}
+}
+
+// Helper function that fails a login on email from as many different IPs as the account allows, and one more.
+func failFromManyIPs(t *testing.T, guard *LoginGuard, email string) {
+	for i := 0; i < guard.AccountPolicy.FreeAttempts+1; i++ {
+		if err := guard.RegisterFailure(email, fmt.Sprintf("203.0.113.%d", i+1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoginGuardLimitsAccountAcrossIPs(t *testing.T) {
+	guard := NewLoginGuard(NewMemoryAttemptStore())
+
+	failFromManyIPs(t, guard, "victim@example.com")
+
+	// A new IP gets no free guesses on the account anymore.
+	if wait, err := guard.Check("victim@example.com", "198.51.100.7"); err != nil || wait <= 0 {
+		t.Fatalf("new IP: got wait %v, err %v, want the account locked", wait, err)
+	}
+
+	if wait, err := guard.Check("someone@example.com", "198.51.100.7"); err != nil || wait != 0 {
+		t.Fatalf("other account: got wait %v, err %v, want no lockout", wait, err)
+	}
+}
+
+func TestLoginGuardExemptsKnownIPs(t *testing.T) {
+	guard := NewLoginGuard(NewMemoryAttemptStore())
+
+	if err := guard.RegisterSuccess("victim@example.com", "192.0.2.10"); err != nil {
+		t.Fatal(err)
+	}
+
+	failFromManyIPs(t, guard, "victim@example.com")
+
+	if wait, err := guard.Check("victim@example.com", "192.0.2.10"); err != nil || wait != 0 {
+		t.Fatalf("known IP: got wait %v, err %v, want no lockout", wait, err)
+	}
+
+	// The owner logging in doesn't reset the account counter for the attacker.
+	if wait, err := guard.Check("victim@example.com", "198.51.100.7"); err != nil || wait <= 0 {
+		t.Fatalf("unknown IP: got wait %v, err %v, want the account locked", wait, err)
+	}
+}
+
+func TestLoginGuardForgetsKnownIPs(t *testing.T) {
+	guard := NewLoginGuard(NewMemoryAttemptStore())
+	guard.KnownIPWindow = time.Millisecond
+
+	if err := guard.RegisterSuccess("victim@example.com", "192.0.2.10"); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	failFromManyIPs(t, guard, "victim@example.com")
+
+	if wait, _ := guard.Check("victim@example.com", "192.0.2.10"); wait <= 0 {
+		t.Fatal("IP still known after KnownIPWindow")
+	}
+}
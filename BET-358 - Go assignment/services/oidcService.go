@@ -0,0 +1,459 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrOIDCEmailNotVerified = errors.New("the identity provider didn't verify the email")
+
+// How long the user has to log in at the provider.
+const OIDCLoginLifetime = 10 * time.Minute
+
+// Identity of a user, as asserted by the ID token of the provider.
+// Issuer and Subject identify the user at the provider, the email can change or be given to someone else.
+type OIDCIdentity struct {
+	Issuer  string
+	Subject string
+	Email   string
+	Name    string
+}
+
+// Login started with the provider, waiting for its callback.
+type OIDCPendingLogin struct {
+	CodeVerifier string
+	Nonce        string
+	Session      string
+	expiresAt    time.Time
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type oidcJWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type oidcClaims struct {
+	Email         string      `json:"email"`
+	EmailVerified interface{} `json:"email_verified"`
+	Name          string      `json:"name"`
+	Nonce         string      `json:"nonce"`
+	jwt.RegisteredClaims
+}
+
+// External OpenID Connect provider, used with the authorization-code flow and PKCE.
+// Its endpoints and keys are discovered from the issuer on first use.
+type OIDCProvider struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	Client       *http.Client
+
+	mu          sync.Mutex
+	discovery   *oidcDiscovery
+	keys        map[string]interface{}
+	keysFetched time.Time
+	pending     map[string]OIDCPendingLogin
+}
+
+// Creates a provider for issuer, whose ID tokens must be issued to clientID.
+func NewOIDCProvider(issuer, clientID, clientSecret, redirectURL string) *OIDCProvider {
+	return &OIDCProvider{
+		Issuer:       strings.TrimSuffix(issuer, "/"),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		Scopes:       []string{"openid", "email", "profile"},
+		Client:       &http.Client{Timeout: 10 * time.Second},
+		pending:      make(map[string]OIDCPendingLogin),
+	}
+}
+
+// Helper function that generates a random URL-safe string.
+func randomURLString(size int) (string, error) {
+	bytes := make([]byte, size)
+
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+// Helper function that fetches a JSON document.
+func (provider *OIDCProvider) getJSON(endpoint string, target interface{}) error {
+	response, err := provider.Client.Get(endpoint)
+
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: unexpected status %s", endpoint, response.Status)
+	}
+
+	return json.NewDecoder(response.Body).Decode(target)
+}
+
+// Returns the discovery document of the provider, fetching it the first time.
+func (provider *OIDCProvider) discover() (*oidcDiscovery, error) {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+
+	if provider.discovery != nil {
+		return provider.discovery, nil
+	}
+
+	var discovery oidcDiscovery
+
+	if err := provider.getJSON(provider.Issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSuffix(discovery.Issuer, "/") != provider.Issuer {
+		return nil, fmt.Errorf("discovery document is for issuer %q, expected %q", discovery.Issuer, provider.Issuer)
+	}
+
+	provider.discovery = &discovery
+
+	return provider.discovery, nil
+}
+
+// Helper function that decodes a base64url encoded big integer of a JWK.
+func decodeJWKInt(value string) (*big.Int, error) {
+	bytes, err := base64.RawURLEncoding.DecodeString(value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(bytes), nil
+}
+
+// Helper function that converts an RSA or P-256 JWK to a public key.
+func (jwk oidcJWK) publicKey() (interface{}, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeJWKInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeJWKInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if jwk.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %s", jwk.Crv)
+		}
+
+		x, err := decodeJWKInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decodeJWKInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %s", jwk.Kty)
+}
+
+// Returns the key of the provider with this kid.
+// The keys are fetched again when kid is unknown, at most once a minute, to follow the key rotations of the provider.
+func (provider *OIDCProvider) key(kid string) (interface{}, error) {
+	discovery, err := provider.discover()
+
+	if err != nil {
+		return nil, err
+	}
+
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+
+	if key, ok := provider.keys[kid]; ok {
+		return key, nil
+	}
+
+	if time.Since(provider.keysFetched) < time.Minute {
+		return nil, fmt.Errorf("unknown key id: %q", kid)
+	}
+
+	var jwks struct {
+		Keys []oidcJWK `json:"keys"`
+	}
+
+	if err := provider.getJSON(discovery.JWKSURI, &jwks); err != nil {
+		return nil, err
+	}
+
+	provider.keys = make(map[string]interface{})
+	provider.keysFetched = time.Now()
+
+	for _, jwk := range jwks.Keys {
+		if key, err := jwk.publicKey(); err == nil {
+			provider.keys[jwk.Kid] = key
+		}
+	}
+
+	if key, ok := provider.keys[kid]; ok {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("unknown key id: %q", kid)
+}
+
+// Starts a login: creates the state, nonce and PKCE verifier, and remembers them until the callback, for OIDCLoginLifetime.
+// session is given back by FinishLogin, so the callback can answer the same way /login does.
+// The state must also be bound to the browser, so that the callback can check it comes from the same one.
+// Returns (authorizationURL, state, nil) where the user must be redirected.
+// Returns ("", "", err) if something went wrong.
+func (provider *OIDCProvider) StartLogin(session string) (string, string, error) {
+	discovery, err := provider.discover()
+
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err := randomURLString(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	nonce, err := randomURLString(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	verifier, err := randomURLString(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+
+	provider.mu.Lock()
+	now := time.Now()
+	for key, login := range provider.pending {
+		if now.After(login.expiresAt) {
+			delete(provider.pending, key)
+		}
+	}
+	provider.pending[state] = OIDCPendingLogin{CodeVerifier: verifier, Nonce: nonce, Session: session, expiresAt: now.Add(OIDCLoginLifetime)}
+	provider.mu.Unlock()
+
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {provider.ClientID},
+		"redirect_uri":          {provider.RedirectURL},
+		"scope":                 {strings.Join(provider.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return discovery.AuthorizationEndpoint + separator + query.Encode(), state, nil
+}
+
+// Helper function that returns and forgets the pending login of state.
+func (provider *OIDCProvider) takePending(state string) (OIDCPendingLogin, bool) {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+
+	login, ok := provider.pending[state]
+	delete(provider.pending, state)
+
+	if !ok || time.Now().After(login.expiresAt) {
+		return OIDCPendingLogin{}, false
+	}
+
+	return login, true
+}
+
+// Helper function that exchanges the authorization code for the ID token of the user.
+func (provider *OIDCProvider) exchange(code, verifier string) (string, error) {
+	discovery, err := provider.discover()
+
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {provider.RedirectURL},
+		"client_id":     {provider.ClientID},
+		"code_verifier": {verifier},
+	}
+
+	request, err := http.NewRequest(http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+
+	if err != nil {
+		return "", err
+	}
+
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+
+	if provider.ClientSecret != "" {
+		request.SetBasicAuth(url.QueryEscape(provider.ClientID), url.QueryEscape(provider.ClientSecret))
+	}
+
+	response, err := provider.Client.Do(request)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint: unexpected status %s", response.Status)
+	}
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+
+	if err := json.NewDecoder(response.Body).Decode(&tokens); err != nil {
+		return "", err
+	}
+
+	if tokens.IDToken == "" {
+		return "", errors.New("token endpoint didn't return an id_token")
+	}
+
+	return tokens.IDToken, nil
+}
+
+// Helper function that verifies the signature, issuer, audience, expiration and nonce of an ID token.
+func (provider *OIDCProvider) verifyIDToken(rawIDToken, nonce string) (OIDCIdentity, error) {
+	var claims oidcClaims
+
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{"RS256", "ES256"}),
+		jwt.WithIssuer(provider.Issuer),
+		jwt.WithAudience(provider.ClientID),
+	)
+
+	_, err := parser.ParseWithClaims(rawIDToken, &claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return provider.key(kid)
+	})
+
+	if err != nil {
+		return OIDCIdentity{}, err
+	}
+
+	if claims.Nonce != nonce {
+		return OIDCIdentity{}, errors.New("id_token nonce doesn't match")
+	}
+
+	// Some providers send email_verified as a string.
+	verified := claims.EmailVerified == true || claims.EmailVerified == "true"
+
+	if claims.Email == "" || !verified {
+		return OIDCIdentity{}, ErrOIDCEmailNotVerified
+	}
+
+	if claims.Subject == "" {
+		return OIDCIdentity{}, errors.New("id_token has no subject")
+	}
+
+	return OIDCIdentity{Issuer: provider.Issuer, Subject: claims.Subject, Email: strings.ToLower(claims.Email), Name: claims.Name}, nil
+}
+
+// Finishes a login started by StartLogin, from the parameters the provider redirected the user with.
+// Returns (identity, pendingLogin, nil) if the user authenticated and his email is verified.
+// Returns (OIDCIdentity{}, OIDCPendingLogin{}, err) otherwise.
+func (provider *OIDCProvider) FinishLogin(state, code string) (OIDCIdentity, OIDCPendingLogin, error) {
+	login, ok := provider.takePending(state)
+
+	if !ok {
+		return OIDCIdentity{}, OIDCPendingLogin{}, errors.New("unknown or expired state")
+	}
+
+	rawIDToken, err := provider.exchange(code, login.CodeVerifier)
+
+	if err != nil {
+		return OIDCIdentity{}, OIDCPendingLogin{}, err
+	}
+
+	identity, err := provider.verifyIDToken(rawIDToken, login.Nonce)
+
+	if err != nil {
+		return OIDCIdentity{}, OIDCPendingLogin{}, err
+	}
+
+	return identity, login, nil
+}
+
+// Provider used by the application, set by LoadOIDC, nil when OpenID Connect login is disabled.
+var OIDC *OIDCProvider
+
+// Service function that configures the OpenID Connect provider from the environment:
+// OIDC_ISSUER (login is disabled when empty), OIDC_CLIENT_ID, OIDC_CLIENT_SECRET (optional with PKCE),
+// and OIDC_REDIRECT_URL (the public URL of GET /auth/oidc/callback).
+// Returns an error if the configuration is incomplete.
+func LoadOIDC() error {
+	issuer := os.Getenv("OIDC_ISSUER")
+
+	if issuer == "" {
+		OIDC = nil
+		return nil
+	}
+
+	clientID := os.Getenv("OIDC_CLIENT_ID")
+	redirectURL := os.Getenv("OIDC_REDIRECT_URL")
+
+	if clientID == "" || redirectURL == "" {
+		return errors.New("OIDC_CLIENT_ID and OIDC_REDIRECT_URL are required with OIDC_ISSUER")
+	}
+
+	OIDC = NewOIDCProvider(issuer, clientID, os.Getenv("OIDC_CLIENT_SECRET"), redirectURL)
+	return nil
+}
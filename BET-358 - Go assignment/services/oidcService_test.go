@@ -0,0 +1,275 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Local OpenID Connect issuer: serves its discovery document and keys, and exchanges the code "good-code" for an ID token
+// if the PKCE verifier matches the challenge of the authorization request.
+type stubIssuer struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	// Set from the authorization URL by authorize.
+	challenge string
+	nonce     string
+
+	// Changes the claims of the ID token the token endpoint returns.
+	editClaims func(claims jwt.MapClaims)
+	// Issuer of the discovery document, the URL of the server if empty.
+	discoveryIssuer string
+	tokenRequests   int
+}
+
+func newStubIssuer(t *testing.T) *stubIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stub := &stubIssuer{t: t, key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", stub.discovery)
+	mux.HandleFunc("/jwks", stub.jwks)
+	mux.HandleFunc("/token", stub.token)
+
+	stub.server = httptest.NewServer(mux)
+	t.Cleanup(stub.server.Close)
+
+	return stub
+}
+
+func (stub *stubIssuer) discovery(w http.ResponseWriter, r *http.Request) {
+	issuer := stub.discoveryIssuer
+	if issuer == "" {
+		issuer = stub.server.URL
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"issuer":                 issuer,
+		"authorization_endpoint": stub.server.URL + "/authorize",
+		"token_endpoint":         stub.server.URL + "/token",
+		"jwks_uri":               stub.server.URL + "/jwks",
+	})
+}
+
+func (stub *stubIssuer) jwks(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": "stub",
+		"n":   base64.RawURLEncoding.EncodeToString(stub.key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(stub.key.E)).Bytes()),
+	}}})
+}
+
+func (stub *stubIssuer) token(w http.ResponseWriter, r *http.Request) {
+	stub.tokenRequests++
+
+	if err := r.ParseForm(); err != nil || r.Method != http.MethodPost {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+
+	if r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("code") != "good-code" ||
+		r.PostForm.Get("client_id") != "client" || r.PostForm.Get("redirect_uri") != "https://app.example/callback" ||
+		base64.RawURLEncoding.EncodeToString(verifier[:]) != stub.challenge {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":            stub.server.URL,
+		"aud":            "client",
+		"sub":            "subject-1",
+		"exp":            time.Now().Add(time.Minute).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          stub.nonce,
+		"email":          "Jane@Example.com",
+		"email_verified": true,
+		"name":           "Jane",
+	}
+
+	if stub.editClaims != nil {
+		stub.editClaims(claims)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "stub"
+
+	idToken, err := token.SignedString(stub.key)
+
+	if err != nil {
+		stub.t.Error(err)
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"access_token": "unused", "token_type": "Bearer", "id_token": idToken})
+}
+
+// Starts a login with provider and plays the part of the user at the provider: checks the authorization URL and
+// remembers its PKCE challenge and nonce.
+// Returns the state to call back with.
+func (stub *stubIssuer) authorize(provider *OIDCProvider) string {
+	authorizationURL, state, err := provider.StartLogin("cookie")
+
+	if err != nil {
+		stub.t.Fatal(err)
+	}
+
+	parsed, err := url.Parse(authorizationURL)
+
+	if err != nil {
+		stub.t.Fatal(err)
+	}
+
+	query := parsed.Query()
+
+	if parsed.Path != "/authorize" || query.Get("response_type") != "code" || query.Get("client_id") != "client" ||
+		query.Get("redirect_uri") != "https://app.example/callback" || query.Get("code_challenge_method") != "S256" ||
+		query.Get("state") != state || query.Get("nonce") == "" || query.Get("code_challenge") == "" {
+		stub.t.Fatalf("unexpected authorization URL %s", authorizationURL)
+	}
+
+	stub.challenge = query.Get("code_challenge")
+	stub.nonce = query.Get("nonce")
+
+	return state
+}
+
+func (stub *stubIssuer) provider() *OIDCProvider {
+	return NewOIDCProvider(stub.server.URL, "client", "", "https://app.example/callback")
+}
+
+func TestOIDCLogin(t *testing.T) {
+	stub := newStubIssuer(t)
+	provider := stub.provider()
+
+	state := stub.authorize(provider)
+
+	identity, login, err := provider.FinishLogin(state, "good-code")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := OIDCIdentity{Issuer: stub.server.URL, Subject: "subject-1", Email: "jane@example.com", Name: "Jane"}
+
+	if identity != want {
+		t.Fatalf("got identity %+v, want %+v", identity, want)
+	}
+
+	if login.Session != "cookie" {
+		t.Fatalf("got session %q, want cookie", login.Session)
+	}
+
+	// A state can only be used once.
+	if _, _, err := provider.FinishLogin(state, "good-code"); err == nil {
+		t.Fatal("state was accepted twice")
+	}
+}
+
+func TestOIDCLoginRejectsUnknownState(t *testing.T) {
+	stub := newStubIssuer(t)
+	provider := stub.provider()
+
+	stub.authorize(provider)
+
+	if _, _, err := provider.FinishLogin("forged-state", "good-code"); err == nil {
+		t.Fatal("unknown state was accepted")
+	}
+
+	if stub.tokenRequests != 0 {
+		t.Fatal("code was exchanged for an unknown state")
+	}
+}
+
+func TestOIDCLoginRejectsWrongVerifier(t *testing.T) {
+	stub := newStubIssuer(t)
+	provider := stub.provider()
+
+	state := stub.authorize(provider)
+	// The code was requested by another login, with another challenge.
+	stub.challenge = "another-challenge"
+
+	if _, _, err := provider.FinishLogin(state, "good-code"); err == nil {
+		t.Fatal("code was exchanged without the matching verifier")
+	}
+}
+
+func TestOIDCLoginRejectsIDTokens(t *testing.T) {
+	cases := []struct {
+		name       string
+		editClaims func(claims jwt.MapClaims)
+		wantErr    error
+	}{
+		{"wrong nonce", func(claims jwt.MapClaims) { claims["nonce"] = "replayed" }, nil},
+		{"missing nonce", func(claims jwt.MapClaims) { delete(claims, "nonce") }, nil},
+		{"email not verified", func(claims jwt.MapClaims) { claims["email_verified"] = false }, ErrOIDCEmailNotVerified},
+		{"email_verified missing", func(claims jwt.MapClaims) { delete(claims, "email_verified") }, ErrOIDCEmailNotVerified},
+		{"email_verified false string", func(claims jwt.MapClaims) { claims["email_verified"] = "false" }, ErrOIDCEmailNotVerified},
+		{"no email", func(claims jwt.MapClaims) { delete(claims, "email") }, ErrOIDCEmailNotVerified},
+		{"wrong issuer", func(claims jwt.MapClaims) { claims["iss"] = "https://evil.example" }, nil},
+		{"wrong audience", func(claims jwt.MapClaims) { claims["aud"] = "another-client" }, nil},
+		{"expired", func(claims jwt.MapClaims) { claims["exp"] = time.Now().Add(-time.Hour).Unix() }, nil},
+		{"no subject", func(claims jwt.MapClaims) { delete(claims, "sub") }, nil},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			stub := newStubIssuer(t)
+			stub.editClaims = tc.editClaims
+			provider := stub.provider()
+
+			state := stub.authorize(provider)
+
+			_, _, err := provider.FinishLogin(state, "good-code")
+
+			if err == nil {
+				t.Fatal("ID token was accepted")
+			}
+
+			if tc.wantErr != nil && err != tc.wantErr {
+				t.Fatalf("got error %v, want %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestOIDCLoginAcceptsEmailVerifiedString(t *testing.T) {
+	stub := newStubIssuer(t)
+	stub.editClaims = func(claims jwt.MapClaims) { claims["email_verified"] = "true" }
+	provider := stub.provider()
+
+	state := stub.authorize(provider)
+
+	if _, _, err := provider.FinishLogin(state, "good-code"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOIDCDiscoveryRejectsOtherIssuer(t *testing.T) {
+	stub := newStubIssuer(t)
+	stub.discoveryIssuer = "https://evil.example"
+
+	if _, _, err := stub.provider().StartLogin(""); err == nil {
+		t.Fatal("discovery document of another issuer was accepted")
+	}
+}
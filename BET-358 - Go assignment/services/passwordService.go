@@ -0,0 +1,273 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrPasswordMismatch = errors.New("password doesn't match")
+	ErrUnknownHash      = errors.New("unknown password hash format")
+)
+
+// Hashes and verifies passwords with one algorithm.
+// The algorithm and its parameters are encoded in the hash itself so it can be verified later
+// even if the configuration changed in the meantime.
+type PasswordHasher interface {
+	// Returns the encoded hash of password.
+	Hash(password string) (string, error)
+	// Returns true if hash was produced by this algorithm and can be verified by it.
+	Handles(hash string) bool
+	// Returns nil if password matches hash, ErrPasswordMismatch if it doesn't.
+	Verify(hash, password string) error
+	// Returns true if hash was produced with other parameters than the current ones.
+	NeedsRehash(hash string) bool
+}
+
+// bcrypt hasher, hashes look like $2a$<cost>$<salt and hash>.
+type BcryptHasher struct {
+	Cost int
+}
+
+func (hasher BcryptHasher) Hash(password string) (string, error) {
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), hasher.Cost)
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(bytes), nil
+}
+
+func (hasher BcryptHasher) Handles(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+func (hasher BcryptHasher) Verify(hash, password string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return ErrPasswordMismatch
+	}
+
+	return err
+}
+
+func (hasher BcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+
+	return err != nil || cost != hasher.Cost
+}
+
+// argon2id hasher, hashes use the PHC string format: $argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<hash>.
+type Argon2idHasher struct {
+	// Memory in KiB.
+	Memory  uint32
+	Time    uint32
+	Threads uint8
+	SaltLen uint32
+	KeyLen  uint32
+}
+
+type argon2idParams struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+func (hasher Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, hasher.SaltLen)
+
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, hasher.Time, hasher.Memory, hasher.Threads, hasher.KeyLen)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, hasher.Memory, hasher.Time, hasher.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (hasher Argon2idHasher) Handles(hash string) bool {
+	return strings.HasPrefix(hash, "$argon2id$")
+}
+
+// Helper function that decodes an argon2id PHC string.
+func decodeArgon2id(hash string) (argon2idParams, error) {
+	var params argon2idParams
+	var version int
+
+	parts := strings.Split(hash, "$")
+
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, ErrUnknownHash
+	}
+
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, ErrUnknownHash
+	}
+
+	// argon2 panics without memory, iterations or threads.
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads); err != nil ||
+		params.memory == 0 || params.time == 0 || params.threads == 0 {
+		return params, ErrUnknownHash
+	}
+
+	var err error
+
+	if params.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return params, ErrUnknownHash
+	}
+
+	if params.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(params.key) == 0 {
+		return params, ErrUnknownHash
+	}
+
+	return params, nil
+}
+
+func (hasher Argon2idHasher) Verify(hash, password string) error {
+	params, err := decodeArgon2id(hash)
+
+	if err != nil {
+		return err
+	}
+
+	key := argon2.IDKey([]byte(password), params.salt, params.time, params.memory, params.threads, uint32(len(params.key)))
+
+	if subtle.ConstantTimeCompare(key, params.key) != 1 {
+		return ErrPasswordMismatch
+	}
+
+	return nil
+}
+
+func (hasher Argon2idHasher) NeedsRehash(hash string) bool {
+	params, err := decodeArgon2id(hash)
+
+	if err != nil {
+		return true
+	}
+
+	return params.memory != hasher.Memory || params.time != hasher.Time || params.threads != hasher.Threads ||
+		uint32(len(params.salt)) != hasher.SaltLen || uint32(len(params.key)) != hasher.KeyLen
+}
+
+// Hashes new passwords with the configured hasher, and verifies existing hashes with whichever
+// known hasher produced them.
+type Passwords struct {
+	Current PasswordHasher
+	Known   []PasswordHasher
+}
+
+// Hashes password with the current hasher.
+func (passwords Passwords) Hash(password string) (string, error) {
+	return passwords.Current.Hash(password)
+}
+
+// Verifies password against hash.
+// Returns (needsRehash, nil) if the password matches, needsRehash being true if hash wasn't produced by the
+// current hasher with its current parameters.
+// Returns (false, ErrPasswordMismatch) if it doesn't match.
+// Returns (false, err) if the hash can't be verified.
+func (passwords Passwords) Verify(hash, password string) (bool, error) {
+	for _, hasher := range append([]PasswordHasher{passwords.Current}, passwords.Known...) {
+		if !hasher.Handles(hash) {
+			continue
+		}
+
+		if err := hasher.Verify(hash, password); err != nil {
+			return false, err
+		}
+
+		return hasher != passwords.Current || hasher.NeedsRehash(hash), nil
+	}
+
+	return false, ErrUnknownHash
+}
+
+// Helper function that reads a positive integer from an environment variable, or returns def if it's not set.
+func envInt(name string, def int) (int, error) {
+	value := os.Getenv(name)
+
+	if value == "" {
+		return def, nil
+	}
+
+	n, err := strconv.Atoi(value)
+
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("%s must be a positive integer, got %q", name, value)
+	}
+
+	return n, nil
+}
+
+// Service function that builds the password hashers from the environment:
+// PASSWORD_HASHER (argon2id or bcrypt, defaults to argon2id), BCRYPT_COST (defaults to 12),
+// ARGON2_MEMORY_KIB (defaults to 65536), ARGON2_TIME (defaults to 3) and ARGON2_THREADS (defaults to 2).
+// Returns an error if one of them is invalid.
+func NewPasswordsFromEnv() (Passwords, error) {
+	cost, err := envInt("BCRYPT_COST", 12)
+	if err != nil {
+		return Passwords{}, err
+	}
+
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return Passwords{}, fmt.Errorf("BCRYPT_COST must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+
+	memory, err := envInt("ARGON2_MEMORY_KIB", 64*1024)
+	if err != nil {
+		return Passwords{}, err
+	}
+
+	iterations, err := envInt("ARGON2_TIME", 3)
+	if err != nil {
+		return Passwords{}, err
+	}
+
+	threads, err := envInt("ARGON2_THREADS", 2)
+	if err != nil || threads > 255 {
+		return Passwords{}, fmt.Errorf("ARGON2_THREADS must be between 1 and 255")
+	}
+
+	bcryptHasher := BcryptHasher{Cost: cost}
+	argon2idHasher := Argon2idHasher{Memory: uint32(memory), Time: uint32(iterations), Threads: uint8(threads), SaltLen: 16, KeyLen: 32}
+
+	switch os.Getenv("PASSWORD_HASHER") {
+	case "", "argon2id":
+		return Passwords{Current: argon2idHasher, Known: []PasswordHasher{bcryptHasher}}, nil
+	case "bcrypt":
+		return Passwords{Current: bcryptHasher, Known: []PasswordHasher{argon2idHasher}}, nil
+	default:
+		return Passwords{}, fmt.Errorf("PASSWORD_HASHER must be argon2id or bcrypt, got %q", os.Getenv("PASSWORD_HASHER"))
+	}
+}
+
+// Hashers used by the application, set by LoadPasswords.
+var Password Passwords
+
+// Service function that loads the password hashers configuration, see NewPasswordsFromEnv.
+// Returns an error if the configuration is invalid.
+func LoadPasswords() error {
+	passwords, err := NewPasswordsFromEnv()
+
+	if err != nil {
+		return err
+	}
+
+	Password = passwords
+	return nil
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Parameters small enough to keep the tests fast.
+var (
+	testBcrypt   = BcryptHasher{Cost: bcrypt.MinCost}
+	testArgon2id = Argon2idHasher{Memory: 64, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 32}
+)
+
+// Helper function that hashes password, failing the test if it can't.
+func mustHash(t *testing.T, hasher PasswordHasher, password string) string {
+	hash, err := hasher.Hash(password)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return hash
+}
+
+func TestPasswordHashersRoundTrip(t *testing.T) {
+	cases := []struct {
+		name   string
+		hasher PasswordHasher
+		prefix string
+	}{
+		{"bcrypt", testBcrypt, "$2a$04$"},
+		{"argon2id", testArgon2id, "$argon2id$v=19$m=64,t=1,p=1$"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			hash := mustHash(t, tc.hasher, "correct horse")
+
+			if !strings.HasPrefix(hash, tc.prefix) || !tc.hasher.Handles(hash) {
+				t.Fatalf("got hash %q, want it to start with %q", hash, tc.prefix)
+			}
+
+			if hash == mustHash(t, tc.hasher, "correct horse") {
+				t.Fatal("two hashes of the same password are the same, the salt isn't random")
+			}
+
+			if err := tc.hasher.Verify(hash, "correct horse"); err != nil {
+				t.Fatalf("got %v for the right password", err)
+			}
+
+			if err := tc.hasher.Verify(hash, "battery staple"); err != ErrPasswordMismatch {
+				t.Fatalf("got %v for a wrong password, want ErrPasswordMismatch", err)
+			}
+
+			if tc.hasher.NeedsRehash(hash) {
+				t.Fatal("a hash of the current parameters needs a rehash")
+			}
+		})
+	}
+}
+
+func TestPasswordHashersNeedRehash(t *testing.T) {
+	bcryptHash := mustHash(t, testBcrypt, "correct horse")
+	argon2idHash := mustHash(t, testArgon2id, "correct horse")
+
+	changed := func(change func(hasher *Argon2idHasher)) Argon2idHasher {
+		hasher := testArgon2id
+		change(&hasher)
+		return hasher
+	}
+
+	cases := []struct {
+		name   string
+		hasher PasswordHasher
+		hash   string
+	}{
+		{"bcrypt cost", BcryptHasher{Cost: bcrypt.MinCost + 1}, bcryptHash},
+		{"argon2id memory", changed(func(hasher *Argon2idHasher) { hasher.Memory = 128 }), argon2idHash},
+		{"argon2id time", changed(func(hasher *Argon2idHasher) { hasher.Time = 2 }), argon2idHash},
+		{"argon2id threads", changed(func(hasher *Argon2idHasher) { hasher.Threads = 2 }), argon2idHash},
+		{"argon2id salt length", changed(func(hasher *Argon2idHasher) { hasher.SaltLen = 32 }), argon2idHash},
+		{"argon2id key length", changed(func(hasher *Argon2idHasher) { hasher.KeyLen = 64 }), argon2idHash},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if !tc.hasher.NeedsRehash(tc.hash) {
+				t.Fatal("no rehash after the parameters changed")
+			}
+
+			// The parameters are read from the hash, it still verifies.
+			if err := tc.hasher.Verify(tc.hash, "correct horse"); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestPasswordsVerifyWithKnownHashers(t *testing.T) {
+	passwords := Passwords{Current: testArgon2id, Known: []PasswordHasher{testBcrypt}}
+	stronger := Argon2idHasher{Memory: 128, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 32}
+
+	cases := []struct {
+		name        string
+		hash        string
+		password    string
+		needsRehash bool
+		err         error
+	}{
+		{"current hasher", mustHash(t, testArgon2id, "correct horse"), "correct horse", false, nil},
+		{"current hasher with other parameters", mustHash(t, stronger, "correct horse"), "correct horse", true, nil},
+		{"known hasher", mustHash(t, testBcrypt, "correct horse"), "correct horse", true, nil},
+		{"known hasher with a wrong password", mustHash(t, testBcrypt, "correct horse"), "battery staple", false, ErrPasswordMismatch},
+		{"unknown algorithm", "$scrypt$ln=15,r=8,p=1$c2FsdA$aGFzaA", "correct horse", false, ErrUnknownHash},
+		{"plain text", "correct horse", "correct horse", false, ErrUnknownHash},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			needsRehash, err := passwords.Verify(tc.hash, tc.password)
+
+			if needsRehash != tc.needsRehash || err != tc.err {
+				t.Fatalf("got (%v, %v), want (%v, %v)", needsRehash, err, tc.needsRehash, tc.err)
+			}
+		})
+	}
+}
+
+func TestPasswordHashersRejectMalformedHashes(t *testing.T) {
+	valid := mustHash(t, testArgon2id, "correct horse")
+	parts := strings.Split(valid, "$")
+	salt, key := parts[4], parts[5]
+
+	argon2idHashes := map[string]string{
+		"missing key":     "$argon2id$v=19$m=64,t=1,p=1$" + salt,
+		"empty key":       "$argon2id$v=19$m=64,t=1,p=1$" + salt + "$",
+		"other version":   "$argon2id$v=16$m=64,t=1,p=1$" + salt + "$" + key,
+		"no parameters":   "$argon2id$v=19$$" + salt + "$" + key,
+		"no memory":       "$argon2id$v=19$m=0,t=1,p=1$" + salt + "$" + key,
+		"no iterations":   "$argon2id$v=19$m=64,t=0,p=1$" + salt + "$" + key,
+		"no threads":      "$argon2id$v=19$m=64,t=1,p=0$" + salt + "$" + key,
+		"invalid salt":    "$argon2id$v=19$m=64,t=1,p=1$not base64!$" + key,
+		"padded key":      "$argon2id$v=19$m=64,t=1,p=1$" + salt + "$" + key + "==",
+		"argon2i instead": "$argon2i$v=19$m=64,t=1,p=1$" + salt + "$" + key,
+	}
+
+	for name, hash := range argon2idHashes {
+		t.Run(name, func(t *testing.T) {
+			if err := testArgon2id.Verify(hash, "correct horse"); err != ErrUnknownHash {
+				t.Fatalf("got %v, want ErrUnknownHash", err)
+			}
+
+			if !testArgon2id.NeedsRehash(hash) {
+				t.Fatal("a malformed hash doesn't need a rehash")
+			}
+		})
+	}
+
+	bcryptHash := mustHash(t, testBcrypt, "correct horse")
+
+	for _, hash := range []string{"$2a$04$", "$2a$04$tooshort", "$2a$xx$" + bcryptHash[7:]} {
+		if err := testBcrypt.Verify(hash, "correct horse"); err == nil || err == ErrPasswordMismatch {
+			t.Fatalf("%q: got %v, want a malformed hash error", hash, err)
+		}
+	}
+}